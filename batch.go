@@ -0,0 +1,65 @@
+package json2xml
+
+import (
+	"fmt"
+	"math/rand"
+	"runtime"
+	"sync"
+)
+
+// ConvertBatch converts each of inputs like DictToXMLErr, spreading the
+// work over workers goroutines, and returns the documents in input order.
+// Zero or fewer workers means runtime.GOMAXPROCS(0).
+//
+// When opts.IDSource is set, one seed per input is drawn from it before
+// any conversion starts and each input gets its own source, so the IDs do
+// not depend on scheduling. Callbacks such as OnElement, NameValidator and
+// TypeHandlers are called from several goroutines at once and must be
+// safe for concurrent use.
+//
+// The first failing input, by position, is reported with its index; all
+// inputs are still converted.
+func ConvertBatch(inputs []any, opts Options, workers int) ([][]byte, error) {
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	workers = min(workers, len(inputs))
+
+	var seeds []int64
+	if opts.IDSource != nil {
+		seeds = make([]int64, len(inputs))
+		for i := range seeds {
+			seeds[i] = opts.IDSource.Int63()
+		}
+	}
+
+	results := make([][]byte, len(inputs))
+	errs := make([]error, len(inputs))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				itemOpts := opts
+				if seeds != nil {
+					itemOpts.IDSource = rand.New(rand.NewSource(seeds[i]))
+				}
+				results[i], errs[i] = DictToXMLErr(inputs[i], itemOpts)
+			}
+		}()
+	}
+	for i := range inputs {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	for i, err := range errs {
+		if err != nil {
+			return nil, fmt.Errorf("input %d: %w", i, err)
+		}
+	}
+	return results, nil
+}
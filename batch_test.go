@@ -0,0 +1,82 @@
+package json2xml
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+func TestConvertBatch(t *testing.T) {
+	inputs := make([]any, 200)
+	for i := range inputs {
+		inputs[i] = map[string]any{"id": i, "tags": []any{"a", fmt.Sprint(i)}}
+	}
+
+	opts := DefaultOptions()
+	outputs, err := ConvertBatch(inputs, opts, 8)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(outputs) != len(inputs) {
+		t.Fatalf("expected %d outputs, got %d", len(inputs), len(outputs))
+	}
+	for i, output := range outputs {
+		want, err := DictToXMLErr(inputs[i], opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(output) != string(want) {
+			t.Errorf("output %d = %s, want %s", i, output, want)
+		}
+	}
+
+	t.Run("default workers", func(t *testing.T) {
+		outputs, err := ConvertBatch(inputs[:3], opts, 0)
+		if err != nil || len(outputs) != 3 {
+			t.Fatalf("got %d outputs, err %v", len(outputs), err)
+		}
+	})
+
+	t.Run("empty", func(t *testing.T) {
+		outputs, err := ConvertBatch(nil, opts, 4)
+		if err != nil || len(outputs) != 0 {
+			t.Errorf("got %v, %v", outputs, err)
+		}
+	})
+
+	t.Run("seeded ids", func(t *testing.T) {
+		idOpts := DefaultOptions()
+		idOpts.IDs = true
+		idOpts.IDSource = rand.New(rand.NewSource(1))
+		first, err := ConvertBatch(inputs, idOpts, 8)
+		if err != nil {
+			t.Fatal(err)
+		}
+		idOpts.IDSource = rand.New(rand.NewSource(1))
+		second, err := ConvertBatch(inputs, idOpts, 3)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := range first {
+			if !strings.Contains(string(first[i]), `id="`) {
+				t.Fatalf("output %d has no ids: %s", i, first[i])
+			}
+			if string(first[i]) != string(second[i]) {
+				t.Errorf("output %d differs between runs:\n%s\n%s", i, first[i], second[i])
+			}
+		}
+	})
+
+	t.Run("error names input", func(t *testing.T) {
+		bad := []any{map[string]any{"a": 1}, map[string]any{"f": func() {}}, map[string]any{"b": 2}}
+		_, err := ConvertBatch(bad, opts, 2)
+		if !errors.Is(err, ErrInvalidData) {
+			t.Fatalf("expected ErrInvalidData, got %v", err)
+		}
+		if !strings.HasPrefix(err.Error(), "input 1: ") {
+			t.Errorf("expected error to name input 1, got %v", err)
+		}
+	})
+}
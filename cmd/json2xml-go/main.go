@@ -2,19 +2,30 @@
 //
 // Usage:
 //
-//	json2xml-go [flags] [input-file]
+//	json2xml-go [command] [flags] [input-file...]
+//
+// Commands:
+//
+//	convert     Convert JSON to XML (default when no command is given)
+//	validate    Check that JSON input converts to well-formed XML
+//	reformat    Pretty-print an existing XML document
 //
 // Flags:
 //
 //	-w, --wrapper string    Wrapper element name (default "all")
 //	-r, --root              Include root element (default true)
 //	-p, --pretty            Pretty print output (default true)
+//	-m, --minify            Omit the XML declaration and all whitespace
 //	-t, --type              Include type attributes (default true)
 //	-i, --item-wrap         Wrap list items in <item> elements (default true)
 //	-x, --xpath             Use XPath 3.1 json-to-xml format
+//	    --ids               Add unique id attributes to elements
+//	    --stream            Stream a file to --output without loading it into memory
 //	-o, --output string     Output file (default: stdout)
 //	-u, --url string        Read JSON from URL
 //	-s, --string string     Read JSON from string
+//	-f, --format string     Input format: json or yaml (default "json")
+//	    --stats             Print conversion statistics to stderr
 //	-h, --help              Show help message
 //	-v, --version           Show version information
 //
@@ -37,13 +48,18 @@
 //
 //	# Use XPath 3.1 format
 //	json2xml-go -x data.json
+//
+//	# Stream a large file
+//	json2xml-go --stream -o output.xml huge.json
 package main
 
 import (
+	"bytes"
 	"flag"
 	"fmt"
 	"io"
 	"os"
+	"path/filepath"
 	"strings"
 
 	json2xml "github.com/vinitkumar/json2xml-go"
@@ -55,6 +71,7 @@ var (
 	// Input options
 	inputURL    string
 	inputString string
+	inputFormat string
 
 	// Output options
 	outputFile string
@@ -63,13 +80,17 @@ var (
 	wrapper     string
 	root        bool
 	pretty      bool
+	minify      bool
 	attrType    bool
 	itemWrap    bool
 	xpathFormat bool
 	cdata       bool
 	listHeaders bool
+	ids         bool
+	stream      bool
 
 	// Other options
+	showStats   bool
 	showVersion bool
 	showHelp    bool
 )
@@ -80,6 +101,8 @@ func init() {
 	flag.StringVar(&inputURL, "url", "", "Read JSON from URL")
 	flag.StringVar(&inputString, "s", "", "Read JSON from string")
 	flag.StringVar(&inputString, "string", "", "Read JSON from string")
+	flag.StringVar(&inputFormat, "f", formatJSON, "Input format: json or yaml")
+	flag.StringVar(&inputFormat, "format", formatJSON, "Input format: json or yaml")
 
 	// Output options
 	flag.StringVar(&outputFile, "o", "", "Output file (default: stdout)")
@@ -92,6 +115,8 @@ func init() {
 	flag.BoolVar(&root, "root", true, "Include root element")
 	flag.BoolVar(&pretty, "p", true, "Pretty print output")
 	flag.BoolVar(&pretty, "pretty", true, "Pretty print output")
+	flag.BoolVar(&minify, "m", false, "Omit the XML declaration and all whitespace")
+	flag.BoolVar(&minify, "minify", false, "Omit the XML declaration and all whitespace")
 	flag.BoolVar(&attrType, "t", true, "Include type attributes")
 	flag.BoolVar(&attrType, "type", true, "Include type attributes")
 	flag.BoolVar(&itemWrap, "i", true, "Wrap list items in <item> elements")
@@ -102,8 +127,11 @@ func init() {
 	flag.BoolVar(&cdata, "cdata", false, "Wrap string values in CDATA sections")
 	flag.BoolVar(&listHeaders, "l", false, "Repeat headers for each list item")
 	flag.BoolVar(&listHeaders, "list-headers", false, "Repeat headers for each list item")
+	flag.BoolVar(&ids, "ids", false, "Add unique id attributes to elements")
+	flag.BoolVar(&stream, "stream", false, "Stream a file to --output without loading it into memory")
 
 	// Other options
+	flag.BoolVar(&showStats, "stats", false, "Print conversion statistics to stderr")
 	flag.BoolVar(&showVersion, "v", false, "Show version information")
 	flag.BoolVar(&showVersion, "version", false, "Show version information")
 	flag.BoolVar(&showHelp, "h", false, "Show help message")
@@ -120,12 +148,22 @@ func usageTo(writer io.Writer) {
 	fmt.Fprintf(writer, `json2xml-go - Convert JSON to XML
 
 Usage:
-  json2xml-go [flags] [input-file]
+  json2xml-go [command] [flags] [input-file...]
+
+Commands:
+  convert                 Convert JSON to XML (default)
+  validate                Check that JSON input converts to well-formed XML
+  reformat                Pretty-print an existing XML document
 
 Input Options:
   -u, --url string        Read JSON from URL
   -s, --string string     Read JSON from string
-  [input-file]            Read JSON from file (use - for stdin)
+  -f, --format string     Input format: json or yaml (default "json");
+                          YAML is read from a string, file or stdin
+  [input-file]            Read JSON from file (use - for stdin);
+                          .jsonc files may contain comments; several
+                          files are combined, each under an element
+                          named after the file
 
 Output Options:
   -o, --output string     Output file (default: stdout)
@@ -134,13 +172,20 @@ Conversion Options:
   -w, --wrapper string    Wrapper element name (default "all")
   -r, --root              Include root element (default true)
   -p, --pretty            Pretty print output (default true)
+  -m, --minify            Omit the XML declaration and all whitespace
+                          (overrides --pretty)
   -t, --type              Include type attributes (default true)
   -i, --item-wrap         Wrap list items in <item> elements (default true)
   -x, --xpath             Use XPath 3.1 json-to-xml format
   -c, --cdata             Wrap string values in CDATA sections
   -l, --list-headers      Repeat headers for each list item
+      --ids               Add unique id attributes to elements
+      --stream            Stream a file to --output without loading it
+                          into memory (output is not pretty-printed)
 
 Other Options:
+      --stats             Print conversion statistics to stderr after
+                          writing the output
   -v, --version           Show version information
   -h, --help              Show help message
 
@@ -160,6 +205,12 @@ Examples:
   # Read from stdin
   cat data.json | json2xml-go -
 
+  # Convert a YAML file
+  json2xml-go -f yaml config.yaml
+
+  # Combine files into <all><users>...</users><orders>...</orders></all>
+  json2xml-go users.json orders.json
+
   # Output to file
   json2xml-go -o output.xml data.json
 
@@ -169,12 +220,57 @@ Examples:
   # Disable pretty printing and type attributes
   json2xml-go -p=false -t=false data.json
 
+  # Stream a large file
+  json2xml-go --stream -o output.xml huge.json
+
+  # Check that a file converts cleanly
+  json2xml-go validate data.json
+
+  # Pretty-print an XML file
+  json2xml-go reformat output.xml
+
 `)
 }
 
+// Input formats accepted by --format.
+const (
+	formatJSON = "json"
+	formatYAML = "yaml"
+)
+
+// Subcommand names. A bare invocation runs commandConvert.
+const (
+	commandConvert  = "convert"
+	commandValidate = "validate"
+	commandReformat = "reformat"
+)
+
 func main() {
-	flag.Parse()
-	os.Exit(run(os.Stdout, os.Stderr))
+	command, args := splitCommand(os.Args[1:])
+	_ = flag.CommandLine.Parse(args)
+	os.Exit(dispatch(command, os.Stdout, os.Stderr))
+}
+
+// splitCommand separates a leading subcommand from the flag arguments.
+func splitCommand(args []string) (string, []string) {
+	if len(args) > 0 {
+		switch args[0] {
+		case commandConvert, commandValidate, commandReformat:
+			return args[0], args[1:]
+		}
+	}
+	return commandConvert, args
+}
+
+func dispatch(command string, stdout io.Writer, stderr io.Writer) int {
+	switch command {
+	case commandValidate:
+		return runValidate(stdout, stderr)
+	case commandReformat:
+		return runReformat(stdout, stderr)
+	default:
+		return run(stdout, stderr)
+	}
 }
 
 func run(stdout io.Writer, stderr io.Writer) int {
@@ -189,23 +285,27 @@ func run(stdout io.Writer, stderr io.Writer) int {
 		return 0
 	}
 
+	if stream {
+		if inputFormat != formatJSON {
+			fmt.Fprintln(stderr, "Error: --stream only reads JSON")
+			return 1
+		}
+		return runStream(stderr)
+	}
+
 	data, err := readInput()
 	if err != nil {
 		fmt.Fprintf(stderr, "Error reading input: %v\n", err)
 		return 1
 	}
 
-	converter := json2xml.New(data).
-		WithWrapper(wrapper).
-		WithRoot(root).
-		WithPretty(pretty).
-		WithAttrType(attrType).
-		WithItemWrap(itemWrap).
-		WithXPathFormat(xpathFormat).
-		WithCDATA(cdata).
-		WithListHeaders(listHeaders)
-
-	xmlOutput, err := converter.ToXMLString()
+	var xmlOutput string
+	var stats json2xml.Stats
+	if showStats {
+		xmlOutput, stats, err = newConverter(data).ToXMLStringWithStats()
+	} else {
+		xmlOutput, err = newConverter(data).ToXMLString()
+	}
 	if err != nil {
 		fmt.Fprintf(stderr, "Error converting to XML: %v\n", err)
 		return 1
@@ -216,10 +316,117 @@ func run(stdout io.Writer, stderr io.Writer) int {
 		return 1
 	}
 
+	if showStats {
+		writeStats(stderr, stats)
+	}
+
+	return 0
+}
+
+// writeStats prints the conversion statistics, summarizing the list sizes.
+func writeStats(writer io.Writer, stats json2xml.Stats) {
+	items, largest := 0, 0
+	for _, size := range stats.ListSizes {
+		items += size
+		largest = max(largest, size)
+	}
+	fmt.Fprintf(writer, "Elements:   %d\n", stats.Elements)
+	fmt.Fprintf(writer, "Attributes: %d\n", stats.Attributes)
+	fmt.Fprintf(writer, "Max depth:  %d\n", stats.MaxDepth)
+	fmt.Fprintf(writer, "Lists:      %d (%d items, largest %d)\n", len(stats.ListSizes), items, largest)
+	fmt.Fprintf(writer, "Bytes:      %d\n", stats.Bytes)
+}
+
+// conversionOptions builds library options from the conversion flags. It
+// is the single source of options for every conversion the CLI runs.
+func conversionOptions() json2xml.Options {
+	return json2xml.Options{
+		Root:        root,
+		CustomRoot:  wrapper,
+		AttrType:    attrType,
+		ItemWrap:    itemWrap,
+		ItemFunc:    json2xml.DefaultItemFunc,
+		CDATA:       cdata,
+		ListHeaders: listHeaders,
+		XPathFormat: xpathFormat,
+		IDs:         ids,
+		Minify:      minify,
+		SortKeys:    true,
+	}
+}
+
+// newConverter builds a converter for data from the conversion flags.
+func newConverter(data any) *json2xml.JSON2xml {
+	return json2xml.NewWithOptions(data, conversionOptions()).WithPretty(pretty)
+}
+
+func runValidate(stdout io.Writer, stderr io.Writer) int {
+	data, err := readInput()
+	if err != nil {
+		fmt.Fprintf(stderr, "Error reading input: %v\n", err)
+		return 1
+	}
+
+	if _, err := newConverter(data).WithPretty(false).ToXMLValidated(); err != nil {
+		fmt.Fprintf(stderr, "Invalid: %v\n", err)
+		return 1
+	}
+
+	fmt.Fprintln(stdout, "valid")
+	return 0
+}
+
+func runReformat(stdout io.Writer, stderr io.Writer) int {
+	data, err := readRawInput()
+	if err != nil {
+		fmt.Fprintf(stderr, "Error reading input: %v\n", err)
+		return 1
+	}
+
+	xmlOutput, err := json2xml.PrettyPrint(data)
+	if err != nil {
+		fmt.Fprintf(stderr, "Error reformatting XML: %v\n", err)
+		return 1
+	}
+
+	if err := writeOutputTo(stdout, xmlOutput); err != nil {
+		fmt.Fprintf(stderr, "Error writing output: %v\n", err)
+		return 1
+	}
+
+	return 0
+}
+
+func runStream(stderr io.Writer) int {
+	args := flag.Args()
+	if len(args) != 1 || args[0] == "-" || outputFile == "" {
+		fmt.Fprintln(stderr, "Error: --stream requires a single input file and --output")
+		return 1
+	}
+
+	if err := json2xml.StreamFile(args[0], outputFile, conversionOptions()); err != nil {
+		fmt.Fprintf(stderr, "Error streaming to XML: %v\n", err)
+		return 1
+	}
+
 	return 0
 }
 
 func readInput() (any, error) {
+	switch inputFormat {
+	case formatJSON, formatYAML:
+	default:
+		return nil, fmt.Errorf("unknown input format %q (want %s or %s)", inputFormat, formatJSON, formatYAML)
+	}
+
+	args := flag.Args()
+	if len(args) > 1 && inputURL == "" && inputString == "" {
+		return readFiles(args)
+	}
+	if inputFormat == formatYAML {
+		return readYAMLInput()
+	}
+
 	// Priority: URL > String > File > Stdin
 	if inputURL != "" {
 		return json2xml.ReadFromURL(inputURL, nil)
@@ -229,14 +436,13 @@ func readInput() (any, error) {
 		return json2xml.ReadFromString(inputString)
 	}
 
-	args := flag.Args()
 	if len(args) > 0 {
 		filename := args[0]
 		if filename == "-" {
 			// Read from stdin
 			return readFromStdin()
 		}
-		return json2xml.ReadFromJSON(filename)
+		return readFile(filename)
 	}
 
 	// Check if there's data on stdin
@@ -251,18 +457,98 @@ func readInput() (any, error) {
 	return nil, fmt.Errorf("no input provided. Use -h for help")
 }
 
+// readFiles reads several input files into one document with a child per
+// file (see json2xml.MergeInputs).
+func readFiles(filenames []string) (any, error) {
+	inputs := make(map[string]any, len(filenames))
+	for _, filename := range filenames {
+		if filename == "-" {
+			return nil, fmt.Errorf("stdin cannot be combined with other input files")
+		}
+		data, err := readFile(filename)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", filename, err)
+		}
+		inputs[filename] = data
+	}
+
+	return json2xml.MergeInputs(inputs), nil
+}
+
+// readFile parses one input file in the selected format.
+func readFile(filename string) (any, error) {
+	if inputFormat == formatYAML {
+		data, err := os.ReadFile(filename)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", json2xml.ErrYAMLRead, err)
+		}
+		return json2xml.ReadFromYAML(data)
+	}
+	if strings.EqualFold(filepath.Ext(filename), ".jsonc") {
+		return readFromJSONCFile(filename)
+	}
+	return json2xml.ReadFromJSON(filename)
+}
+
 func readFromStdin() (any, error) {
+	data, err := readStdin()
+	if err != nil {
+		return nil, err
+	}
+
+	return json2xml.ReadFromString(string(data))
+}
+
+func readStdin() ([]byte, error) {
 	data, err := io.ReadAll(os.Stdin)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read from stdin: %w", err)
 	}
 
-	jsonStr := strings.TrimSpace(string(data))
-	if jsonStr == "" {
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 {
 		return nil, fmt.Errorf("empty input")
 	}
 
-	return json2xml.ReadFromString(jsonStr)
+	return data, nil
+}
+
+// readRawInput returns the unparsed input for commands that do not read JSON.
+// Priority: String > File > Stdin.
+func readRawInput() ([]byte, error) {
+	if inputString != "" {
+		return []byte(inputString), nil
+	}
+
+	args := flag.Args()
+	if len(args) > 0 && args[0] != "-" {
+		return os.ReadFile(args[0])
+	}
+
+	return readStdin()
+}
+
+// readYAMLInput parses YAML from a string, file or stdin.
+func readYAMLInput() (any, error) {
+	if inputURL != "" {
+		return nil, fmt.Errorf("YAML input cannot be read from a URL")
+	}
+
+	data, err := readRawInput()
+	if err != nil {
+		return nil, err
+	}
+
+	return json2xml.ReadFromYAML(data)
+}
+
+func readFromJSONCFile(filename string) (any, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", json2xml.ErrJSONRead, err)
+	}
+
+	return json2xml.ReadFromJSONC(data)
 }
 
 func writeOutput(output string) error {
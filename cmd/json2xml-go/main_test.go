@@ -10,22 +10,30 @@ import (
 	"os"
 	"path/filepath"
 	"reflect"
+	"strconv"
 	"strings"
 	"testing"
+
+	json2xml "github.com/vinitkumar/json2xml-go"
 )
 
 type cliState struct {
 	inputURL    string
 	inputString string
+	inputFormat string
 	outputFile  string
 	wrapper     string
 	root        bool
 	pretty      bool
+	minify      bool
 	attrType    bool
 	itemWrap    bool
 	xpathFormat bool
 	cdata       bool
 	listHeaders bool
+	ids         bool
+	stream      bool
+	showStats   bool
 	showVersion bool
 	showHelp    bool
 	stdin       *os.File
@@ -36,15 +44,20 @@ func saveCLIState(t *testing.T) cliState {
 	state := cliState{
 		inputURL:    inputURL,
 		inputString: inputString,
+		inputFormat: inputFormat,
 		outputFile:  outputFile,
 		wrapper:     wrapper,
 		root:        root,
 		pretty:      pretty,
+		minify:      minify,
 		attrType:    attrType,
 		itemWrap:    itemWrap,
 		xpathFormat: xpathFormat,
 		cdata:       cdata,
 		listHeaders: listHeaders,
+		ids:         ids,
+		stream:      stream,
+		showStats:   showStats,
 		showVersion: showVersion,
 		showHelp:    showHelp,
 		stdin:       os.Stdin,
@@ -52,15 +65,20 @@ func saveCLIState(t *testing.T) cliState {
 	t.Cleanup(func() {
 		inputURL = state.inputURL
 		inputString = state.inputString
+		inputFormat = state.inputFormat
 		outputFile = state.outputFile
 		wrapper = state.wrapper
 		root = state.root
 		pretty = state.pretty
+		minify = state.minify
 		attrType = state.attrType
 		itemWrap = state.itemWrap
 		xpathFormat = state.xpathFormat
 		cdata = state.cdata
 		listHeaders = state.listHeaders
+		ids = state.ids
+		stream = state.stream
+		showStats = state.showStats
 		showVersion = state.showVersion
 		showHelp = state.showHelp
 		os.Stdin = state.stdin
@@ -71,15 +89,20 @@ func saveCLIState(t *testing.T) cliState {
 
 	inputURL = ""
 	inputString = ""
+	inputFormat = formatJSON
 	outputFile = ""
 	wrapper = "all"
 	root = true
 	pretty = true
+	minify = false
 	attrType = true
 	itemWrap = true
 	xpathFormat = false
 	cdata = false
 	listHeaders = false
+	ids = false
+	stream = false
+	showStats = false
 	showVersion = false
 	showHelp = false
 	if err := flag.CommandLine.Parse([]string{}); err != nil {
@@ -197,6 +220,98 @@ func TestRunConvertsStringToStdout(t *testing.T) {
 	}
 }
 
+func TestRunPassesCDATAToConverter(t *testing.T) {
+	saveCLIState(t)
+	inputString = `{"note":"a < b"}`
+	pretty = false
+	attrType = false
+	cdata = true
+
+	var stdout bytes.Buffer
+	var stderr bytes.Buffer
+	if exitCode := run(&stdout, &stderr); exitCode != 0 {
+		t.Fatalf("expected exit code 0, got %d: %s", exitCode, stderr.String())
+	}
+	if !strings.Contains(stdout.String(), "<note><![CDATA[a < b]]></note>") {
+		t.Fatalf("expected CDATA output, got %s", stdout.String())
+	}
+}
+
+func TestRunPassesListHeadersToConverter(t *testing.T) {
+	saveCLIState(t)
+	inputString = `{"Bike":[{"color":"red"},{"color":"green"}]}`
+	pretty = false
+	attrType = false
+	root = false
+	itemWrap = false
+	listHeaders = true
+
+	var stdout bytes.Buffer
+	var stderr bytes.Buffer
+	if exitCode := run(&stdout, &stderr); exitCode != 0 {
+		t.Fatalf("expected exit code 0, got %d: %s", exitCode, stderr.String())
+	}
+	expected := "<Bike><color>red</color></Bike><Bike><color>green</color></Bike>\n"
+	if stdout.String() != expected {
+		t.Fatalf("expected %q, got %q", expected, stdout.String())
+	}
+}
+
+func TestRunPassesIDsToConverter(t *testing.T) {
+	saveCLIState(t)
+	inputString = `{"name":"Bike"}`
+	pretty = false
+	ids = true
+
+	var stdout bytes.Buffer
+	var stderr bytes.Buffer
+	if exitCode := run(&stdout, &stderr); exitCode != 0 {
+		t.Fatalf("expected exit code 0, got %d: %s", exitCode, stderr.String())
+	}
+	if !strings.Contains(stdout.String(), `<name id="all_`) {
+		t.Fatalf("expected id attribute, got %s", stdout.String())
+	}
+}
+
+func TestRunMinifiesOutput(t *testing.T) {
+	saveCLIState(t)
+	inputString = `{"name":"Bike"}`
+	minify = true
+
+	var stdout bytes.Buffer
+	var stderr bytes.Buffer
+	if exitCode := run(&stdout, &stderr); exitCode != 0 {
+		t.Fatalf("expected exit code 0, got %d: %s", exitCode, stderr.String())
+	}
+	if expected := "<all><name type=\"str\">Bike</name></all>\n"; stdout.String() != expected {
+		t.Fatalf("expected %q, got %q", expected, stdout.String())
+	}
+}
+
+func TestRunPrintsStats(t *testing.T) {
+	saveCLIState(t)
+	inputString = `{"name":"Bike","parts":[{"id":1},{"id":2}],"tags":["a","b","c"]}`
+	pretty = false
+	showStats = true
+
+	var stdout bytes.Buffer
+	var stderr bytes.Buffer
+	if exitCode := run(&stdout, &stderr); exitCode != 0 {
+		t.Fatalf("expected exit code 0, got %d: %s", exitCode, stderr.String())
+	}
+	for _, want := range []string{
+		"Elements:   11\n",
+		"Attributes: 10\n",
+		"Max depth:  4\n",
+		"Lists:      2 (5 items, largest 3)\n",
+		"Bytes:      " + strconv.Itoa(len(strings.TrimSuffix(stdout.String(), "\n"))) + "\n",
+	} {
+		if !strings.Contains(stderr.String(), want) {
+			t.Errorf("expected %q in stderr, got %q", want, stderr.String())
+		}
+	}
+}
+
 func TestRunReportsReadErrors(t *testing.T) {
 	saveCLIState(t)
 	inputString = `{not json}`
@@ -253,6 +368,216 @@ func TestRunReportsWriteErrors(t *testing.T) {
 	}
 }
 
+func TestRunStream(t *testing.T) {
+	saveCLIState(t)
+	dir := t.TempDir()
+	inputFile := filepath.Join(dir, "input.json")
+	if err := os.WriteFile(inputFile, []byte(`[{"name":"Bike"},{"name":"Car"}]`), 0644); err != nil {
+		t.Fatalf("failed to write input file: %v", err)
+	}
+	if err := flag.CommandLine.Parse([]string{inputFile}); err != nil {
+		t.Fatalf("failed to parse flags: %v", err)
+	}
+	stream = true
+	attrType = false
+	outputFile = filepath.Join(dir, "output.xml")
+
+	var stdout bytes.Buffer
+	var stderr bytes.Buffer
+	if exitCode := run(&stdout, &stderr); exitCode != 0 {
+		t.Fatalf("expected exit code 0, got %d: %s", exitCode, stderr.String())
+	}
+
+	contents, err := os.ReadFile(outputFile)
+	if err != nil {
+		t.Fatalf("failed to read output file: %v", err)
+	}
+	expected := `<?xml version="1.0" encoding="UTF-8" ?><all><item><name>Bike</name></item><item><name>Car</name></item></all>`
+	if string(contents) != expected {
+		t.Fatalf("expected %s, got %s", expected, contents)
+	}
+}
+
+func TestRunStreamRequiresFileAndOutput(t *testing.T) {
+	saveCLIState(t)
+	stream = true
+
+	var stdout bytes.Buffer
+	var stderr bytes.Buffer
+	if exitCode := run(&stdout, &stderr); exitCode != 1 {
+		t.Fatalf("expected exit code 1, got %d", exitCode)
+	}
+	if !strings.Contains(stderr.String(), "--stream requires") {
+		t.Fatalf("expected usage error on stderr, got %q", stderr.String())
+	}
+
+	if err := flag.CommandLine.Parse([]string{"a.json", "b.json"}); err != nil {
+		t.Fatalf("failed to parse flags: %v", err)
+	}
+	outputFile = filepath.Join(t.TempDir(), "out.xml")
+	stderr.Reset()
+	if exitCode := run(&stdout, &stderr); exitCode != 1 {
+		t.Fatalf("expected exit code 1 for several files, got %d", exitCode)
+	}
+	if !strings.Contains(stderr.String(), "single input file") {
+		t.Fatalf("expected usage error on stderr, got %q", stderr.String())
+	}
+}
+
+func TestRunStreamReportsErrors(t *testing.T) {
+	saveCLIState(t)
+	dir := t.TempDir()
+	if err := flag.CommandLine.Parse([]string{filepath.Join(dir, "missing.json")}); err != nil {
+		t.Fatalf("failed to parse flags: %v", err)
+	}
+	stream = true
+	outputFile = filepath.Join(dir, "output.xml")
+
+	var stdout bytes.Buffer
+	var stderr bytes.Buffer
+	if exitCode := run(&stdout, &stderr); exitCode != 1 {
+		t.Fatalf("expected exit code 1, got %d", exitCode)
+	}
+	if !strings.Contains(stderr.String(), "Error streaming to XML:") {
+		t.Fatalf("expected stream error on stderr, got %q", stderr.String())
+	}
+}
+
+func TestSplitCommand(t *testing.T) {
+	tests := []struct {
+		name        string
+		args        []string
+		wantCommand string
+		wantArgs    []string
+	}{
+		{"no args", nil, commandConvert, nil},
+		{"flags only", []string{"-w", "root", "data.json"}, commandConvert, []string{"-w", "root", "data.json"}},
+		{"convert", []string{"convert", "data.json"}, commandConvert, []string{"data.json"}},
+		{"validate", []string{"validate", "-s", "{}"}, commandValidate, []string{"-s", "{}"}},
+		{"reformat", []string{"reformat", "out.xml"}, commandReformat, []string{"out.xml"}},
+		{"file named like nothing", []string{"data.json"}, commandConvert, []string{"data.json"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			command, args := splitCommand(tt.args)
+			if command != tt.wantCommand {
+				t.Errorf("command = %q, want %q", command, tt.wantCommand)
+			}
+			if len(args) != len(tt.wantArgs) || (len(args) > 0 && !reflect.DeepEqual(args, tt.wantArgs)) {
+				t.Errorf("args = %v, want %v", args, tt.wantArgs)
+			}
+		})
+	}
+}
+
+func TestDispatchConvert(t *testing.T) {
+	saveCLIState(t)
+	inputString = `{"name":"Bike"}`
+	pretty = false
+
+	var stdout bytes.Buffer
+	var stderr bytes.Buffer
+	if exitCode := dispatch(commandConvert, &stdout, &stderr); exitCode != 0 {
+		t.Fatalf("expected exit code 0, got %d: %s", exitCode, stderr.String())
+	}
+	if !strings.Contains(stdout.String(), `<name type="str">Bike</name>`) {
+		t.Fatalf("unexpected output: %s", stdout.String())
+	}
+}
+
+func TestDispatchValidate(t *testing.T) {
+	saveCLIState(t)
+	inputString = `{"name":"Bike","tags":["a","b"]}`
+
+	var stdout bytes.Buffer
+	var stderr bytes.Buffer
+	if exitCode := dispatch(commandValidate, &stdout, &stderr); exitCode != 0 {
+		t.Fatalf("expected exit code 0, got %d: %s", exitCode, stderr.String())
+	}
+	if got := stdout.String(); got != "valid\n" {
+		t.Fatalf("expected valid, got %q", got)
+	}
+}
+
+func TestDispatchValidateReportsErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		wrapper string
+		want    string
+	}{
+		{"bad json", `{not json}`, "all", "Error reading input:"},
+		{"bad xml", `{"name":"Bike"}`, "bad name", "Invalid:"},
+		{"undeclared prefix", `{"ns1:a":1}`, "all", "Invalid:"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			saveCLIState(t)
+			inputString = tt.input
+			wrapper = tt.wrapper
+
+			var stdout bytes.Buffer
+			var stderr bytes.Buffer
+			if exitCode := dispatch(commandValidate, &stdout, &stderr); exitCode != 1 {
+				t.Fatalf("expected exit code 1, got %d", exitCode)
+			}
+			if !strings.Contains(stderr.String(), tt.want) {
+				t.Fatalf("expected %q in stderr, got %q", tt.want, stderr.String())
+			}
+		})
+	}
+}
+
+func TestDispatchReformat(t *testing.T) {
+	saveCLIState(t)
+	inputString = `<all><name>Bike</name></all>`
+
+	var stdout bytes.Buffer
+	var stderr bytes.Buffer
+	if exitCode := dispatch(commandReformat, &stdout, &stderr); exitCode != 0 {
+		t.Fatalf("expected exit code 0, got %d: %s", exitCode, stderr.String())
+	}
+	if !strings.Contains(stdout.String(), "\n  <name>Bike</name>") {
+		t.Fatalf("expected indented output, got %q", stdout.String())
+	}
+}
+
+func TestDispatchReformatFromFile(t *testing.T) {
+	saveCLIState(t)
+	path := filepath.Join(t.TempDir(), "in.xml")
+	if err := os.WriteFile(path, []byte(`<all><name>Bike</name></all>`), 0o644); err != nil {
+		t.Fatalf("failed to write input: %v", err)
+	}
+	if err := flag.CommandLine.Parse([]string{path}); err != nil {
+		t.Fatalf("failed to parse flags: %v", err)
+	}
+
+	var stdout bytes.Buffer
+	var stderr bytes.Buffer
+	if exitCode := dispatch(commandReformat, &stdout, &stderr); exitCode != 0 {
+		t.Fatalf("expected exit code 0, got %d: %s", exitCode, stderr.String())
+	}
+	if !strings.Contains(stdout.String(), "<name>Bike</name>") {
+		t.Fatalf("unexpected output: %q", stdout.String())
+	}
+}
+
+func TestDispatchReformatReportsErrors(t *testing.T) {
+	saveCLIState(t)
+	inputString = `<all><name>`
+
+	var stdout bytes.Buffer
+	var stderr bytes.Buffer
+	if exitCode := dispatch(commandReformat, &stdout, &stderr); exitCode != 1 {
+		t.Fatalf("expected exit code 1, got %d", exitCode)
+	}
+	if !strings.Contains(stderr.String(), "Error reformatting XML:") {
+		t.Fatalf("unexpected stderr: %q", stderr.String())
+	}
+}
+
 func TestReadInputFromString(t *testing.T) {
 	saveCLIState(t)
 	inputString = `{"name":"Bike","active":true}`
@@ -310,6 +635,186 @@ func TestReadInputFromFile(t *testing.T) {
 	}
 }
 
+func TestReadInputFromJSONCFile(t *testing.T) {
+	saveCLIState(t)
+	inputFile := filepath.Join(t.TempDir(), "settings.jsonc")
+	contents := "{\n  // comment\n  \"name\": \"Bike\" /* inline */\n}"
+	if err := os.WriteFile(inputFile, []byte(contents), 0644); err != nil {
+		t.Fatalf("failed to write input file: %v", err)
+	}
+	if err := flag.CommandLine.Parse([]string{inputFile}); err != nil {
+		t.Fatalf("failed to parse flags: %v", err)
+	}
+
+	data, err := readInput()
+	if err != nil {
+		t.Fatalf("readInput returned error: %v", err)
+	}
+
+	expected := map[string]any{"name": "Bike"}
+	if !reflect.DeepEqual(data, expected) {
+		t.Fatalf("expected %#v, got %#v", expected, data)
+	}
+}
+
+func TestReadInputFromMissingJSONCFile(t *testing.T) {
+	saveCLIState(t)
+	if err := flag.CommandLine.Parse([]string{filepath.Join(t.TempDir(), "missing.jsonc")}); err != nil {
+		t.Fatalf("failed to parse flags: %v", err)
+	}
+
+	if _, err := readInput(); err == nil {
+		t.Fatal("expected error for missing JSONC file")
+	}
+}
+
+func TestReadInputFromYAMLFile(t *testing.T) {
+	saveCLIState(t)
+	inputFile := filepath.Join(t.TempDir(), "config.yaml")
+	contents := "name: Bike\nparts:\n  - wheel\n  - seat\nsize:\n  width: 40\n"
+	if err := os.WriteFile(inputFile, []byte(contents), 0644); err != nil {
+		t.Fatalf("failed to write input file: %v", err)
+	}
+	if err := flag.CommandLine.Parse([]string{"-f", "yaml", inputFile}); err != nil {
+		t.Fatalf("failed to parse flags: %v", err)
+	}
+
+	data, err := readInput()
+	if err != nil {
+		t.Fatalf("readInput returned error: %v", err)
+	}
+
+	expected := map[string]any{
+		"name":  "Bike",
+		"parts": []any{"wheel", "seat"},
+		"size":  map[string]any{"width": 40},
+	}
+	if !reflect.DeepEqual(data, expected) {
+		t.Fatalf("expected %#v, got %#v", expected, data)
+	}
+}
+
+func TestRunConvertsYAMLString(t *testing.T) {
+	saveCLIState(t)
+	inputString = "name: Bike\ntags: [a, b]"
+	inputFormat = formatYAML
+	pretty = false
+	attrType = false
+
+	var stdout bytes.Buffer
+	var stderr bytes.Buffer
+	if exitCode := run(&stdout, &stderr); exitCode != 0 {
+		t.Fatalf("expected exit code 0, got %d (stderr %q)", exitCode, stderr.String())
+	}
+	if !strings.Contains(stdout.String(), "<all><name>Bike</name><tags><item>a</item><item>b</item></tags></all>") {
+		t.Fatalf("unexpected stdout: %q", stdout.String())
+	}
+}
+
+func TestReadInputRejectsBadFormats(t *testing.T) {
+	saveCLIState(t)
+
+	inputFormat = "toml"
+	inputString = "{}"
+	if _, err := readInput(); err == nil || !strings.Contains(err.Error(), `unknown input format "toml"`) {
+		t.Fatalf("expected unknown format error, got %v", err)
+	}
+
+	inputFormat = formatYAML
+	inputString = "key: [unclosed"
+	if _, err := readInput(); !errors.Is(err, json2xml.ErrYAMLRead) {
+		t.Fatalf("expected ErrYAMLRead, got %v", err)
+	}
+
+	inputURL = "http://example.com/config.yaml"
+	if _, err := readInput(); err == nil || !strings.Contains(err.Error(), "URL") {
+		t.Fatalf("expected URL error, got %v", err)
+	}
+}
+
+func TestRunStreamRejectsYAML(t *testing.T) {
+	saveCLIState(t)
+	stream = true
+	inputFormat = formatYAML
+
+	var stdout bytes.Buffer
+	var stderr bytes.Buffer
+	if exitCode := run(&stdout, &stderr); exitCode != 1 {
+		t.Fatalf("expected exit code 1, got %d", exitCode)
+	}
+	if !strings.Contains(stderr.String(), "--stream only reads JSON") {
+		t.Fatalf("unexpected stderr: %q", stderr.String())
+	}
+}
+
+func TestReadInputFromMultipleFiles(t *testing.T) {
+	saveCLIState(t)
+	dir := t.TempDir()
+	usersFile := filepath.Join(dir, "users.json")
+	ordersFile := filepath.Join(dir, "orders.jsonc")
+	if err := os.WriteFile(usersFile, []byte(`[{"name":"Ada"}]`), 0644); err != nil {
+		t.Fatalf("failed to write input file: %v", err)
+	}
+	if err := os.WriteFile(ordersFile, []byte(`{"total": 2 // two orders
+}`), 0644); err != nil {
+		t.Fatalf("failed to write input file: %v", err)
+	}
+	if err := flag.CommandLine.Parse([]string{usersFile, ordersFile}); err != nil {
+		t.Fatalf("failed to parse flags: %v", err)
+	}
+
+	data, err := readInput()
+	if err != nil {
+		t.Fatalf("readInput returned error: %v", err)
+	}
+
+	expected := map[string]any{
+		"users":  []any{map[string]any{"name": "Ada"}},
+		"orders": map[string]any{"total": float64(2)},
+	}
+	if !reflect.DeepEqual(data, expected) {
+		t.Fatalf("expected %#v, got %#v", expected, data)
+	}
+
+	t.Run("YAML", func(t *testing.T) {
+		configFile := filepath.Join(dir, "config.yaml")
+		if err := os.WriteFile(configFile, []byte("debug: true\n"), 0644); err != nil {
+			t.Fatalf("failed to write input file: %v", err)
+		}
+		inputFormat = formatYAML
+		if err := flag.CommandLine.Parse([]string{configFile, usersFile}); err != nil {
+			t.Fatalf("failed to parse flags: %v", err)
+		}
+
+		data, err := readInput()
+		if err != nil {
+			t.Fatalf("readInput returned error: %v", err)
+		}
+		expected := map[string]any{"config": map[string]any{"debug": true}, "users": []any{map[string]any{"name": "Ada"}}}
+		if !reflect.DeepEqual(data, expected) {
+			t.Fatalf("expected %#v, got %#v", expected, data)
+		}
+	})
+
+	t.Run("errors name the file", func(t *testing.T) {
+		inputFormat = formatJSON
+		missing := filepath.Join(dir, "missing.json")
+		if err := flag.CommandLine.Parse([]string{usersFile, missing}); err != nil {
+			t.Fatalf("failed to parse flags: %v", err)
+		}
+		if _, err := readInput(); err == nil || !strings.Contains(err.Error(), missing) {
+			t.Fatalf("expected error naming %s, got %v", missing, err)
+		}
+
+		if err := flag.CommandLine.Parse([]string{usersFile, "-"}); err != nil {
+			t.Fatalf("failed to parse flags: %v", err)
+		}
+		if _, err := readInput(); err == nil || !strings.Contains(err.Error(), "stdin") {
+			t.Fatalf("expected stdin error, got %v", err)
+		}
+	})
+}
+
 func TestReadInputFromStdinArg(t *testing.T) {
 	saveCLIState(t)
 	reader, writer, err := os.Pipe()
@@ -1,6 +1,8 @@
 package json2xml
 
 import (
+	"context"
+	"errors"
 	"net/http"
 	"net/http/httptest"
 	"strings"
@@ -129,12 +131,23 @@ func TestGetXPath31TagNameEdgeCases(t *testing.T) {
 		}
 	})
 
-	t.Run("custom struct fallback", func(t *testing.T) {
+	t.Run("structs are maps", func(t *testing.T) {
 		type CustomStruct struct {
 			Name string
 		}
-		result := GetXPath31TagName(CustomStruct{Name: "test"})
-		if result != "string" {
+		if result := GetXPath31TagName(CustomStruct{Name: "test"}); result != "map" {
+			t.Errorf("expected 'map' for a struct, got %s", result)
+		}
+		if result := GetXPath31TagName(&CustomStruct{Name: "test"}); result != "map" {
+			t.Errorf("expected 'map' for a struct pointer, got %s", result)
+		}
+		if result := GetXPath31TagName(time.Now()); result != "string" {
+			t.Errorf("expected 'string' for time.Time, got %s", result)
+		}
+	})
+
+	t.Run("custom type fallback", func(t *testing.T) {
+		if result := GetXPath31TagName(complex(1, 2)); result != "string" {
 			t.Errorf("expected 'string' for custom type, got %s", result)
 		}
 	})
@@ -156,12 +169,19 @@ func TestGetXPath31TagNameEdgeCases(t *testing.T) {
 
 func TestConvertToXPath31EdgeCases(t *testing.T) {
 	t.Run("custom type fallback", func(t *testing.T) {
-		type Point struct{ X, Y int }
-		result := ConvertToXPath31(Point{1, 2}, "")
+		result := ConvertToXPath31(complex(1, 2), "")
 		if !strings.Contains(result, "<string>") {
 			t.Errorf("expected string tag for custom type, got %s", result)
 		}
 	})
+
+	t.Run("structs", func(t *testing.T) {
+		type Point struct{ X, Y int }
+		result := ConvertToXPath31(&Point{1, 2}, "")
+		if result != `<map><number key="X">1</number><number key="Y">2</number></map>` {
+			t.Errorf("expected a map of fields, got %s", result)
+		}
+	})
 }
 
 func TestToMapEdgeCases(t *testing.T) {
@@ -859,6 +879,127 @@ func TestReadFromURL(t *testing.T) {
 	})
 }
 
+func TestReadFromURLContext(t *testing.T) {
+	t.Run("successful request", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write([]byte(`{"key": "value"}`))
+		}))
+		defer server.Close()
+
+		result, err := ReadFromURLContext(context.Background(), server.URL, nil)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if m, ok := result.(map[string]any); !ok || m["key"] != "value" {
+			t.Errorf("unexpected result: %v", result)
+		}
+	})
+
+	t.Run("canceled mid-request", func(t *testing.T) {
+		started := make(chan struct{})
+		release := make(chan struct{})
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			close(started)
+			select {
+			case <-r.Context().Done():
+			case <-release:
+			}
+		}))
+		defer server.Close()
+		defer close(release)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		go func() {
+			<-started
+			cancel()
+		}()
+
+		_, err := ReadFromURLContext(ctx, server.URL, nil)
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("expected context.Canceled, got %v", err)
+		}
+		if !errors.Is(err, ErrURLRead) {
+			t.Errorf("expected ErrURLRead, got %v", err)
+		}
+	})
+
+	t.Run("deadline exceeded", func(t *testing.T) {
+		release := make(chan struct{})
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			select {
+			case <-r.Context().Done():
+			case <-release:
+			}
+		}))
+		defer server.Close()
+		defer close(release)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+
+		if _, err := ReadFromURLContext(ctx, server.URL, nil); !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("expected context.DeadlineExceeded, got %v", err)
+		}
+	})
+}
+
+func TestReadFromURLWithClient(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.Header.Get("User-Agent") != "json2xml-test" {
+			t.Errorf("expected custom User-Agent, got %q", r.Header.Get("User-Agent"))
+		}
+		if r.URL.Query().Get("page") != "2" {
+			t.Errorf("expected query param page=2")
+		}
+		_, _ = w.Write([]byte(`{"key": "value"}`))
+	}))
+	defer server.Close()
+
+	headers := map[string]string{"Authorization": "Bearer token", "User-Agent": "json2xml-test"}
+	params := map[string]string{"page": "2"}
+
+	t.Run("sends headers with custom client", func(t *testing.T) {
+		result, err := ReadFromURLWithClient(&http.Client{Timeout: time.Second}, server.URL, headers, params)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if m, ok := result.(map[string]any); !ok || m["key"] != "value" {
+			t.Errorf("unexpected result: %v", result)
+		}
+	})
+
+	t.Run("nil client uses default", func(t *testing.T) {
+		if _, err := ReadFromURLWithClient(nil, server.URL, headers, params); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+
+	t.Run("missing auth", func(t *testing.T) {
+		if _, err := ReadFromURLWithClient(nil, server.URL, nil, params); !errors.Is(err, ErrURLRead) {
+			t.Errorf("expected ErrURLRead, got %v", err)
+		}
+	})
+
+	t.Run("client errors", func(t *testing.T) {
+		client := &http.Client{Transport: roundTripFunc(func(*http.Request) (*http.Response, error) {
+			return nil, errors.New("transport down")
+		})}
+		if _, err := ReadFromURLWithClient(client, server.URL, nil, nil); !errors.Is(err, ErrURLRead) {
+			t.Errorf("expected ErrURLRead, got %v", err)
+		}
+	})
+}
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
+
 func TestConvertToXMLWithNilOptions(t *testing.T) {
 	data := map[string]any{"key": "value"}
 	result, err := ConvertToXML(data, nil)
@@ -906,6 +1047,68 @@ func TestList2XMLStrWithListHeaders(t *testing.T) {
 	}
 }
 
+func TestNestedListsWithoutItemWrap(t *testing.T) {
+	opts := DefaultOptions()
+	opts.AttrType = false
+	opts.ItemWrap = false
+
+	tests := []struct {
+		name     string
+		data     any
+		expected string
+	}{
+		{"scalars", map[string]any{"m": []any{1, 2}}, `<root><m>1</m><m>2</m></root>`},
+		{"nested lists", map[string]any{"m": []any{[]any{1, 2}, []any{3, 4}}}, `<root><m><m>1</m><m>2</m><m>3</m><m>4</m></m></root>`},
+		{"nested and scalar", map[string]any{"m": []any{map[string]any{"a": 1}, []any{2}}}, `<root><m><a>1</a><m>2</m></m></root>`},
+		{"top-level", []any{[]any{1, 2}, []any{3, 4}}, `<root><root>1</root><root>2</root><root>3</root><root>4</root></root>`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := string(DictToXML(tt.data, opts))
+			if !strings.HasSuffix(result, tt.expected) {
+				t.Errorf("expected %s, got %s", tt.expected, result)
+			}
+		})
+	}
+}
+
+func TestList2XMLStrNoStrayListType(t *testing.T) {
+	opts := DefaultOptions()
+
+	t.Run("flat", func(t *testing.T) {
+		// nil attrs would panic if the unused wrapper type were still set
+		result := List2XMLStr(opts, nil, []any{1, 2}, "list@flat")
+		if strings.Contains(result, `type="list"`) {
+			t.Errorf("unexpected list type in flat output: %s", result)
+		}
+	})
+
+	t.Run("list headers", func(t *testing.T) {
+		headerOpts := opts
+		headerOpts.ListHeaders = true
+		result := List2XMLStr(headerOpts, nil, []any{map[string]any{"a": 1}, "b"}, "list")
+		if strings.Contains(result, `type="list"`) {
+			t.Errorf("unexpected list type in header output: %s", result)
+		}
+	})
+
+	t.Run("unwrapped primitives", func(t *testing.T) {
+		unwrapped := opts
+		unwrapped.ItemWrap = false
+		result := List2XMLStr(unwrapped, nil, []any{"a", "b"}, "list")
+		if strings.Contains(result, `type="list"`) {
+			t.Errorf("unexpected list type in unwrapped output: %s", result)
+		}
+	})
+
+	t.Run("wrapper keeps its type", func(t *testing.T) {
+		result := List2XMLStr(opts, map[string]any{}, []any{1}, "list")
+		if !strings.HasPrefix(result, `<list type="list">`) {
+			t.Errorf("expected typed wrapper, got %s", result)
+		}
+	})
+}
+
 func TestReadFromJSONIOError(t *testing.T) {
 	// Try to read a directory (should fail)
 	_, err := ReadFromJSON("testdata")
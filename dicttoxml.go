@@ -1,15 +1,24 @@
 package json2xml
 
 import (
+	"bufio"
 	"bytes"
+	"encoding/json"
 	"encoding/xml"
 	"fmt"
+	"io"
+	"iter"
+	"maps"
+	"math/big"
 	"math/rand"
 	"reflect"
-	"regexp"
+	"slices"
 	"sort"
+	"strconv"
 	"strings"
 	"time"
+	"unicode"
+	"unicode/utf8"
 )
 
 // XPathFunctionsNS is the XPath 3.1 json-to-xml namespace.
@@ -23,6 +32,24 @@ func DefaultItemFunc(parent string) string {
 	return "item"
 }
 
+// DuplicateNamePolicy decides what happens when two keys of the same map
+// end up with the same element name, for example "a b" and "a_b", or two
+// invalid keys that both fall back to <key>.
+type DuplicateNamePolicy int
+
+const (
+	// DuplicateNameAllow writes duplicate sibling elements. It is the default.
+	DuplicateNameAllow DuplicateNamePolicy = iota
+	// DuplicateNameSuffix renames later duplicates to name_2, name_3, ...
+	// in sorted key order.
+	DuplicateNameSuffix
+	// DuplicateNameError fails the conversion with ErrDuplicateName.
+	DuplicateNameError
+)
+
+// TypeHandler renders a value of a registered Go type as element text.
+type TypeHandler func(val any, opts Options) string
+
 // Options configures the XML conversion behavior.
 type Options struct {
 	// Root specifies whether to wrap output in an XML root element.
@@ -32,19 +59,402 @@ type Options struct {
 	// IDs specifies whether elements get unique IDs.
 	IDs bool
 	// AttrType specifies whether elements get a data type attribute.
+	// Types come from the Go value, not its text, so a string such as
+	// "007" is always type="str" and keeps its leading zeros.
 	AttrType bool
 	// ItemWrap specifies whether to wrap list items in <item> elements.
 	ItemWrap bool
 	// ItemFunc generates element names for list items.
 	ItemFunc ItemFunc
+	// TypeElementNames names list items by their type instead of by
+	// ItemFunc, keyed by the type attribute value, so that with
+	// {"str": "string", "int": "number", "float": "number"} the list
+	// ["a", 1] becomes <string>a</string><number>1</number>. Types not in
+	// the map keep the ItemFunc name.
+	TypeElementNames map[string]string
 	// CDATA specifies whether string values should be wrapped in CDATA sections.
 	CDATA bool
+	// CDATAAuto wraps only the string values that contain "<", "&" or "]]>"
+	// in CDATA sections and escapes the rest, keeping documents compact while
+	// leaving markup-heavy values readable. CDATA takes precedence.
+	CDATAAuto bool
+	// NilAttr, when set, names an attribute with the value "true" added to
+	// every element converted from a null, such as "nil" or "xsi:nil", so
+	// that nulls stay distinct from empty strings even with AttrType off.
+	// Declare the xsi namespace in XMLNamespaces when using "xsi:nil".
+	NilAttr string
+	// EmptyStringAsNull converts empty strings like nulls, with type="null"
+	// and the NilAttr attribute, for sources that mark missing values
+	// with "". Whitespace-only strings are kept.
+	EmptyStringAsNull bool
 	// XMLNamespaces is a map of namespace prefixes to URIs.
 	XMLNamespaces map[string]any
 	// ListHeaders specifies whether to repeat headers for each list item.
 	ListHeaders bool
 	// XPathFormat specifies whether to use XPath 3.1 json-to-xml format.
 	XPathFormat bool
+	// AllowedKinds restricts the value kinds accepted by the conversions
+	// that return errors, such as DictToXMLErr, WriteXML, StreamFile and
+	// the JSON2xml builder. When non-empty, any value (at any depth) whose
+	// kind is not listed causes ErrUnsupportedType instead of being
+	// rendered with %v. Pointers are checked by the kind of the value they
+	// point to, OrderedMap values count as reflect.Map, and nil values are
+	// always allowed.
+	AllowedKinds []reflect.Kind
+	// MapAsEntries renders each map entry as an <entry> element carrying
+	// the original key (and scalar value) as attributes, so keys never
+	// need to be valid XML names.
+	MapAsEntries bool
+	// TypeHandlers renders values of specific Go types (for example a
+	// decimal or UUID type) as text, taking precedence over the default
+	// conversion. The returned text is escaped like any string value.
+	TypeHandlers map[reflect.Type]TypeHandler
+	// ArrayAsIndexedObject names list items by position (<_0>, <_1>, ...)
+	// instead of using ItemFunc. Items are always wrapped in this mode.
+	ArrayAsIndexedObject bool
+	// IndexPrefix is the element name prefix used by ArrayAsIndexedObject.
+	// Defaults to "_".
+	IndexPrefix string
+	// RepairOutput re-parses the generated XML and, if it is not
+	// well-formed, strips illegal characters and sanitizes root and item
+	// names. It is a safety net for adversarial input, not a validator.
+	RepairOutput bool
+	// CustomTypeAttr, when set, names an attribute that records the Go
+	// type name of values that are not plain maps, lists or scalars
+	// (structs, pointers and the like), e.g. gotype="Point".
+	CustomTypeAttr string
+	// AttrPriority lists attribute names that are emitted first, in the
+	// given order. Other attributes follow alphabetically. An element whose
+	// @attrs is an ordered list of pairs uses that order instead.
+	AttrPriority []string
+	// OnElement, when set, is called for every element as it is produced,
+	// with the element name and its nesting depth (0 for the outermost
+	// elements). It is not called in XPathFormat mode. With RepairOutput
+	// the calls are delivered after the conversion, for the output kept.
+	OnElement func(name string, depth int)
+	// LazyNamespaces declares each prefixed namespace from XMLNamespaces on
+	// the outermost elements that use it instead of on the root element.
+	// The default (xmlns) and xsi namespaces stay on the root.
+	LazyNamespaces bool
+	// XPathArrayItemKey gives XPathFormat array items a key attribute
+	// holding the array's own key. This is a non-standard convenience:
+	// the XPath 3.1 json-to-xml schema does not allow keys on array members.
+	XPathArrayItemKey bool
+
+	// EnumAsString renders named integer types that implement fmt.Stringer
+	// (Go enums) by their String() name instead of their numeric value.
+	EnumAsString bool
+	// RootElementCountAttr, when set, names an attribute on the root
+	// element holding the number of elements beneath it. It is ignored
+	// when Root is false and by StreamFile.
+	RootElementCountAttr string
+	// MaxTextLength, when positive, splits string values longer than this
+	// many characters into consecutive <chunk> child elements of at most
+	// that length, for consumers that cannot handle very long text nodes.
+	MaxTextLength int
+	// DistinguishNilSlice renders a nil slice as a null element
+	// (type="null") so it can be told apart from an empty slice, which
+	// stays an empty list element. By default both are empty lists.
+	DistinguishNilSlice bool
+	// OmitEmptyLists skips map entries whose value is an empty list instead
+	// of writing an empty list element. With DistinguishNilSlice, nil
+	// slices are nulls and still written. Items of lists are never skipped.
+	OmitEmptyLists bool
+	// OmitEmptyObjects skips map entries whose value is an empty map or a
+	// struct without exported fields.
+	OmitEmptyObjects bool
+	// ItemIndexAttr, when set, names an attribute holding the position of
+	// each list item, counting from 0: index="0", index="1" and so on. It
+	// goes on the element written for each item: the item element, or the
+	// repeated parent element with ItemWrap off or ListHeaders. Items with
+	// no element of their own, such as unwrapped maps, get none, and like
+	// the type attribute it is replaced by an item's @attrs.
+	ItemIndexAttr string
+	// CollapseSingleItemLists writes a map entry whose value is a list of
+	// exactly one item as if the value were that item, without the list
+	// element and its type="list": {"tags": ["a"]} becomes <tags>a</tags>.
+	// Nested single-item lists collapse fully. Lists that are themselves
+	// list items, and XPathFormat output, are not affected.
+	CollapseSingleItemLists bool
+	// FlattenSingleKeyChains collapses chains of single-key objects into
+	// one element named by the joined path: {"a":{"b":{"c":1}}} becomes
+	// <a.b.c>1</a.b.c>. Maps with special "@" keys end a chain.
+	FlattenSingleKeyChains bool
+	// TimestampAttr, when set, names an attribute on the root element
+	// recording when the conversion ran, formatted like time.Time values
+	// (see TimeLayout). It is ignored when Root is false.
+	TimestampAttr string
+	// Clock returns the current time for TimestampAttr. Defaults to time.Now.
+	Clock func() time.Time
+	// NameValidator, when set, decides which keys are usable as element
+	// names in place of KeyIsValidXML, for example to enforce NCNames
+	// without colons. Rejected keys are sanitized as usual, falling back
+	// to <key name="...">.
+	NameValidator func(name string) bool
+	// KeyTransform, when set, rewrites every map key before it is checked
+	// and sanitized as an element name, for example to lowercase or
+	// snake_case keys without changing the input. The result is sanitized
+	// like any key. It is not applied to @attrs, @val or @flat, to
+	// MapAsEntries keys or to XPathFormat output.
+	KeyTransform func(key string) string
+	// XSDListPrimitives renders a list of scalars as a single element
+	// holding the space-separated values, like an XSD xs:list:
+	// {"dims":[1,2,3]} becomes <dims type="list">1 2 3</dims>. Lists with
+	// nulls, containers or values containing whitespace convert as usual.
+	XSDListPrimitives bool
+	// InvalidCharMode controls characters that XML 1.0 forbids, such as
+	// control characters other than tab, newline and carriage return, in
+	// text and attribute values. The zero value drops them.
+	InvalidCharMode InvalidCharMode
+	// Escaper, when set, replaces EscapeXML for text and attribute values,
+	// after InvalidCharMode has been applied. It is trusted completely: an
+	// escaper that leaves "<", "&" or `"` alone can produce XML that does
+	// not parse, so use a no-op escaper only for content known to be safe.
+	Escaper func(string) string
+	// SelfCloseEmpty writes null values and empty strings as self-closing
+	// elements (<key type="null"/>) instead of paired tags.
+	SelfCloseEmpty bool
+	// AttrPrefix, when set (typically "@"), turns scalar entries of an
+	// object whose keys start with the prefix into attributes of the
+	// object's element: {"node":{"@id":"1","@val":"text"}} becomes
+	// <node id="1">text</node>. The special @attrs, @val and @flat keys
+	// keep their meaning; @attrs replaces the default attributes first and
+	// prefixed entries are added on top. Keys of the top-level object are
+	// not moved onto the root element. Prefixed keys that are not valid
+	// attribute names stay child elements, while an invalid name in
+	// @attrs fails the conversion with ErrInvalidData.
+	AttrPrefix string
+	// RawXMLKeys lists keys whose string values are pre-rendered XML and
+	// are inserted verbatim instead of escaped. Only use it with trusted
+	// values: anything under these keys can inject arbitrary markup.
+	// A fragment that is not well-formed fails the conversion with
+	// ErrInvalidData, or is escaped like an ordinary string when
+	// RepairOutput is also set.
+	RawXMLKeys map[string]bool
+	// XMLDeclaration replaces the declaration written before the root
+	// element: nil keeps the default <?xml version="1.0" encoding="UTF-8" ?>,
+	// an empty string omits it and any other value is written as-is, so it
+	// must be a complete declaration. It does not change how the document
+	// is encoded; the output is always UTF-8.
+	XMLDeclaration *string
+	// StylesheetHref, when set, adds an
+	// <?xml-stylesheet type="text/xsl" href="..."?> instruction after the
+	// declaration, for documents meant to be transformed with XSLT. Like
+	// the declaration it is only written with Root.
+	StylesheetHref string
+	// Charset names the character encoding WriteXMLEncoded transcodes the
+	// output to, such as "windows-1252". Empty means UTF-8. Other
+	// functions always produce UTF-8 and ignore it.
+	Charset string
+	// IDSource, when set, is the random source for the id attributes added
+	// by IDs, so the same seed always produces the same IDs. A *rand.Rand
+	// is not safe for concurrent use: give each concurrent conversion its
+	// own source. When nil, IDs come from the global math/rand source and
+	// differ from run to run.
+	IDSource *rand.Rand
+	// MaxDepth limits how deeply maps and lists may nest, which also stops
+	// self-referencing data from recursing forever. Deeper data makes
+	// ConvertToXML and the other error-returning functions fail with
+	// ErrMaxDepth. DictToXML, Convert, ConvertDict and ConvertList stop at
+	// the limit and leave the deeper levels out. Zero means DefaultMaxDepth.
+	MaxDepth int
+	// TypeAttrExclude lists element names that never get a type attribute
+	// even when AttrType is set, such as fields known to be strings. With
+	// MapAsEntries the names are the entry keys. List items are matched by
+	// their item name, so excluding "item" affects every wrapped item.
+	TypeAttrExclude map[string]bool
+	// TimeLayout is the time.Format layout for time.Time values and
+	// TimestampAttr, such as "2006-01-02". Empty means time.RFC3339.
+	// Times are formatted in their own location; convert them with
+	// TimeFunc to normalize zones.
+	TimeLayout string
+	// TimeFunc, when set, renders time.Time values and TimestampAttr
+	// instead of TimeLayout, for formats a layout cannot express such as
+	// Unix epoch seconds.
+	TimeFunc func(time.Time) string
+	// DetectDates gives strings that are complete RFC 3339 timestamps
+	// (2024-03-01T12:30:00Z) type="dateTime" and calendar dates
+	// (2024-03-01) type="date" instead of "str". Partial or ambiguous
+	// forms such as "20240301" or "2024-03" stay strings.
+	DetectDates bool
+	// CompactLeaves makes PrettyPrintOptions and the builder's pretty
+	// output drop whitespace-only text that contains a newline, treating
+	// it as indentation. Re-indenting already pretty-printed XML then
+	// keeps leaf and empty elements on one line (<a></a> instead of <a>,
+	// a blank line and </a>). Whitespace-only values with newlines are lost.
+	CompactLeaves bool
+	// DetailedTypes names numbers by their Go kind in type attributes, so
+	// a uint8 gets type="uint8" and a float32 type="float32" instead of
+	// "int" and "float". Values are typed after normalization, so named
+	// numeric types in MapAsEntries values or a top-level scalar come out
+	// as int64, uint64 or float64. json.Number stays "int" or "float".
+	DetailedTypes bool
+	// BoolStrings are the texts written for true and false, such as
+	// {"1", "0"} or {"yes", "no"}. The zero value means {"true", "false"}.
+	// Type attributes still say "bool"; XPathFormat output and XMLToMap
+	// only understand true and false.
+	BoolStrings [2]string
+	// OnDuplicateName decides what happens when keys of one map collide
+	// after sanitization. With DuplicateNameError, ConvertToXML and the
+	// other error-returning functions fail with ErrDuplicateName, while
+	// DictToXML still writes both elements.
+	OnDuplicateName DuplicateNamePolicy
+	// DefaultNSPrefix, such as "ns1", is prepended to every element name
+	// generated from a map key or for a list item, giving <ns1:key> and
+	// <ns1:item> throughout. Names that already have a prefix, and the
+	// root element, are left alone; declare the prefix in XMLNamespaces.
+	// TypeAttrExclude and RawXMLKeys match names with or without it.
+	// XPathFormat output is not affected.
+	DefaultNSPrefix string
+	// StrictNamespaces fails the conversion with ErrUndeclaredPrefix when
+	// an element name uses a prefix, such as ns1 in "ns1:node", that is
+	// neither in XMLNamespaces nor declared by an xmlns:ns1 attribute on
+	// the element or an ancestor. The predefined xml prefix is always
+	// allowed. Use DictToXMLErr or another error-returning function
+	// to see the error; DictToXML writes the element anyway.
+	StrictNamespaces bool
+	// ListCountAttr adds count="N", the number of items, to the wrapper
+	// element of every list. Lists written without a wrapper (@flat,
+	// ListHeaders or unwrapped scalars) have nowhere to carry it.
+	ListCountAttr bool
+	// RootAttrType gives the root element type="dict" or type="list",
+	// subject to AttrType and TypeAttrExclude, when the document is a map
+	// or a list. By default only nested elements are typed and the root
+	// of a map or list has no type attribute; a top-level scalar always
+	// types the root, since its text is the value.
+	RootAttrType bool
+	// Minify produces the most compact output: the XML declaration is
+	// left out, overriding XMLDeclaration, and whitespace-only text
+	// between elements, such as the indentation of RawXMLKeys fragments,
+	// is removed. Whitespace that is the whole text of an element and
+	// CDATA sections are kept. Unlike pretty printing being off, which
+	// still writes the declaration, nothing but the elements remains.
+	Minify bool
+	// SortKeys writes the elements of every map in sorted key order, which
+	// DefaultOptions and the builder turn on. When it is off, the keys of
+	// an OrderedMap, such as one decoded by ReadFromStringOrdered, keep the
+	// order they were set in; plain Go maps have no order to keep and are
+	// still sorted so that the output is stable. GenerateXSD always sorts.
+	SortKeys bool
+
+	// depth is the nesting level of the elements currently being converted.
+	depth int
+	// nesting is the number of maps and lists being converted, which nest
+	// checks against MaxDepth.
+	nesting int
+	// nsScope holds the lazily declared namespace prefixes in scope.
+	nsScope map[string]bool
+	// failure, when set, records the first error found during conversion.
+	failure *error
+	// stats, when set, collects the statistics of ConvertWithStats.
+	stats *Stats
+	// mapKeys is the key order of the OrderedMap being converted when
+	// SortKeys is off (see withKeyOrder).
+	mapKeys []string
+}
+
+// DefaultMaxDepth is the nesting limit used when Options.MaxDepth is zero.
+const DefaultMaxDepth = 1000
+
+// defaultXMLDeclaration is written before the root element unless
+// Options.XMLDeclaration says otherwise.
+const defaultXMLDeclaration = `<?xml version="1.0" encoding="UTF-8" ?>`
+
+// xmlDeclaration returns the declaration to write before the root element.
+func (opts Options) xmlDeclaration() string {
+	if opts.Minify {
+		return ""
+	}
+	if opts.XMLDeclaration != nil {
+		return *opts.XMLDeclaration
+	}
+	return defaultXMLDeclaration
+}
+
+// prolog returns what is written before the root element: the XML
+// declaration and, with StylesheetHref, the xml-stylesheet instruction,
+// which Minify keeps.
+func (opts Options) prolog() string {
+	if opts.StylesheetHref == "" {
+		return opts.xmlDeclaration()
+	}
+	return opts.xmlDeclaration() + fmt.Sprintf(`<?xml-stylesheet type="text/xsl" href="%s"?>`, EscapeXML(opts.StylesheetHref))
+}
+
+// formatTime renders t with TimeFunc or TimeLayout, defaulting to RFC 3339.
+func (opts Options) formatTime(t time.Time) string {
+	if opts.TimeFunc != nil {
+		return opts.TimeFunc(t)
+	}
+	if opts.TimeLayout != "" {
+		return t.Format(opts.TimeLayout)
+	}
+	return t.Format(time.RFC3339)
+}
+
+// formatBool renders b with BoolStrings.
+func (opts Options) formatBool(b bool) string {
+	if opts.BoolStrings == [2]string{} {
+		return strconv.FormatBool(b)
+	}
+	if b {
+		return opts.BoolStrings[0]
+	}
+	return opts.BoolStrings[1]
+}
+
+// fail records err as the conversion's error unless one is already recorded.
+func (opts Options) fail(err error) {
+	if opts.failure != nil && *opts.failure == nil {
+		*opts.failure = err
+	}
+}
+
+// checkRepresentable records an ErrInvalidData failure for values that
+// have no XML text, such as funcs and channels, which would otherwise be
+// written as their memory address, and for infinite big.Floats, which
+// have no decimal form.
+func (opts Options) checkRepresentable(val any) {
+	if n, ok := bigNumber(val); ok {
+		if f, ok := n.(*big.Float); ok && f.IsInf() {
+			opts.fail(fmt.Errorf("%w: cannot convert %s big.Float to XML", ErrInvalidData, f.Text('g', -1)))
+		}
+		return
+	}
+	switch reflect.ValueOf(val).Kind() {
+	case reflect.Chan, reflect.Func, reflect.UnsafePointer:
+		opts.fail(fmt.Errorf("%w: cannot convert %T to XML", ErrInvalidData, val))
+	}
+}
+
+// typeAttr reports whether the element name gets a type attribute.
+func (opts Options) typeAttr(name string) bool {
+	return opts.AttrType && !opts.hasName(opts.TypeAttrExclude, name)
+}
+
+// elementName prepends DefaultNSPrefix to name unless it has a prefix.
+func (opts Options) elementName(name string) string {
+	if opts.DefaultNSPrefix == "" || strings.Contains(name, ":") {
+		return name
+	}
+	return opts.DefaultNSPrefix + ":" + name
+}
+
+// transformKey applies opts.KeyTransform, if set, to a map key.
+func (opts Options) transformKey(key string) string {
+	if opts.KeyTransform == nil {
+		return key
+	}
+	return opts.KeyTransform(key)
+}
+
+// hasName reports whether names holds name, with or without DefaultNSPrefix.
+func (opts Options) hasName(names map[string]bool, name string) bool {
+	if names[name] {
+		return true
+	}
+	local, ok := strings.CutPrefix(name, opts.DefaultNSPrefix+":")
+	return ok && opts.DefaultNSPrefix != "" && names[local]
 }
 
 // DefaultOptions returns the default conversion options.
@@ -59,10 +469,99 @@ func DefaultOptions() Options {
 		CDATA:       false,
 		ListHeaders: false,
 		XPathFormat: false,
+		BoolStrings: [2]string{"true", "false"},
+		SortKeys:    true,
+	}
+}
+
+// PythonCompatOptions returns options that reproduce the default output of
+// the Python json2xml library (json2xml.Json2xml(data).to_xml() with
+// pretty=False): an "all" wrapper, type attributes and <item> list
+// wrapping. Known deviations:
+//   - Go maps are unordered, so keys are sorted; Python keeps insertion
+//     order. Documents whose keys are already sorted match exactly, as
+//     do documents read with ReadFromStringOrdered and converted with
+//     SortKeys turned off.
+//   - Decode input with ReadFromJSONUseNumber or ReadFromStringUseNumber
+//     so integers get type="int", as with Python's json module.
+//   - Floats are written in plain decimal notation, where Python may use
+//     exponents (1e+16).
+//   - Pretty output differs: Python's minidom indents with tabs and
+//     omits the space before "?>" in the declaration.
+func PythonCompatOptions() Options {
+	opts := DefaultOptions()
+	opts.CustomRoot = "all"
+	return opts
+}
+
+// enter is called for every element about to be written. It reports the
+// element to OnElement, declares a lazily scoped namespace in attrs when name
+// uses one, and returns the options for converting the element's children.
+func (opts Options) enter(name string, attrs map[string]any) Options {
+	if opts.OnElement != nil {
+		opts.OnElement(name, opts.depth)
+	}
+	opts.countElement()
+	if opts.LazyNamespaces && attrs != nil {
+		opts.nsScope = declareNamespace(name, attrs, opts)
+	}
+	if opts.StrictNamespaces {
+		opts.nsScope = checkNamespace(name, attrs, opts)
+	}
+	opts.depth++
+	return opts
+}
+
+// declareNamespace adds an xmlns declaration to attrs if name's prefix is a
+// configured namespace that is not yet in scope, returning the new scope.
+func declareNamespace(name string, attrs map[string]any, opts Options) map[string]bool {
+	prefix, _, ok := strings.Cut(name, ":")
+	if !ok || prefix == "xmlns" || prefix == "xsi" || opts.nsScope[prefix] {
+		return opts.nsScope
+	}
+	uri, ok := opts.XMLNamespaces[prefix]
+	if !ok {
+		return opts.nsScope
+	}
+
+	attrs["xmlns:"+prefix] = uri
+	scope := make(map[string]bool, len(opts.nsScope)+1)
+	maps.Copy(scope, opts.nsScope)
+	scope[prefix] = true
+	return scope
+}
+
+// checkNamespace records an ErrUndeclaredPrefix failure if name's prefix
+// is not declared, returning the scope extended by xmlns attributes.
+func checkNamespace(name string, attrs map[string]any, opts Options) map[string]bool {
+	scope := opts.nsScope
+	cloned := false
+	for key := range attrs {
+		prefix, ok := strings.CutPrefix(key, "xmlns:")
+		if !ok || scope[prefix] {
+			continue
+		}
+		if !cloned {
+			scope = make(map[string]bool, len(opts.nsScope)+1)
+			maps.Copy(scope, opts.nsScope)
+			cloned = true
+		}
+		scope[prefix] = true
+	}
+
+	prefix, _, ok := strings.Cut(name, ":")
+	if !ok || prefix == "xml" || scope[prefix] {
+		return scope
+	}
+	if _, declared := opts.XMLNamespaces[prefix]; !declared {
+		opts.fail(fmt.Errorf("%w: element <%s> uses prefix %q", ErrUndeclaredPrefix, name, prefix))
 	}
+	return scope
 }
 
-// MakeID generates a random ID for a given element.
+// MakeID generates a random ID for a given element from the global
+// math/rand source, so IDs differ between runs. Set Options.IDSource for
+// reproducible IDs.
 func MakeID(element string, start, end int) string {
 	if start == 0 {
 		start = 100000
@@ -78,11 +577,30 @@ func GetUniqueID(element string) string {
 	return MakeID(element, 100000, 999999)
 }
 
+// uniqueID generates an ID for element, drawing from opts.IDSource when set.
+func (opts Options) uniqueID(element string) string {
+	if opts.IDSource == nil {
+		return GetUniqueID(element)
+	}
+	return fmt.Sprintf("%s_%d", element, opts.IDSource.Intn(900000)+100000)
+}
+
 // GetXMLType returns the XML type string for a given value.
+// The type is derived from the Go kind only, so a string such as "007"
+// is always "str" and is never reclassified as a number.
 func GetXMLType(val any) string {
 	if val == nil {
 		return "null"
 	}
+	if n, ok := val.(json.Number); ok {
+		return jsonNumberType(n)
+	}
+	switch val.(type) {
+	case *big.Int, big.Int:
+		return "int"
+	case *big.Float, big.Float:
+		return "float"
+	}
 
 	v := reflect.ValueOf(val)
 	switch v.Kind() {
@@ -99,14 +617,61 @@ func GetXMLType(val any) string {
 		return "dict"
 	case reflect.Slice, reflect.Array:
 		return "list"
+	case reflect.Pointer:
+		return GetXMLType(indirect(val))
 	default:
 		if _, ok := val.(time.Time); ok {
 			return "str"
 		}
+		if v.Kind() == reflect.Struct {
+			return "dict"
+		}
 		return v.Type().Name()
 	}
 }
 
+// xmlType is GetXMLType refined by opts.DetectDates and opts.DetailedTypes.
+func (opts Options) xmlType(val any) string {
+	if opts.DetailedTypes && val != nil {
+		switch kind := reflect.ValueOf(val).Kind(); kind {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+			reflect.Float32, reflect.Float64:
+			return kind.String()
+		}
+	}
+	if s, ok := val.(string); ok && opts.DetectDates {
+		if dateType, ok := detectDate(s); ok {
+			return dateType
+		}
+	}
+	return GetXMLType(val)
+}
+
+// detectDate reports whether s is an RFC 3339 timestamp ("dateTime") or a
+// calendar date ("date").
+func detectDate(s string) (string, bool) {
+	switch {
+	case len(s) == len(time.DateOnly):
+		if _, err := time.Parse(time.DateOnly, s); err == nil {
+			return "date", true
+		}
+	case len(s) >= len("2006-01-02T15:04:05Z") && (s[10] == 'T' || s[10] == 't'):
+		if _, err := time.Parse(time.RFC3339, s); err == nil {
+			return "dateTime", true
+		}
+	}
+	return "", false
+}
+
+// jsonNumberType reports whether a decoded JSON number is an "int" or "float".
+func jsonNumberType(n json.Number) string {
+	if strings.ContainsAny(string(n), ".eE") {
+		return "float"
+	}
+	return "int"
+}
+
 // EscapeXML escapes special XML characters in a string.
 func EscapeXML(s string) string {
 	s = strings.ReplaceAll(s, "&", "&amp;")
@@ -118,7 +683,65 @@ func EscapeXML(s string) string {
 }
 
 // MakeAttrString creates a string of XML attributes from a map.
+// Attributes are ordered alphabetically by name. Numbers are written in
+// plain decimal notation and maps and lists as JSON.
 func MakeAttrString(attrs map[string]any) string {
+	return MakeAttrStringWithPriority(attrs, nil)
+}
+
+// MakeAttrStringWithPriority creates a string of XML attributes from a map.
+// Attributes named in priority come first, in that order; the remaining
+// attributes follow alphabetically.
+func MakeAttrStringWithPriority(attrs map[string]any, priority []string) string {
+	return attrString(attrs, priority, plainAttrValue)
+}
+
+// Attr is a single attribute. A []Attr, or a list of [name, value] pairs,
+// given as @attrs keeps the attributes in that order.
+type Attr struct {
+	Name  string
+	Value any
+}
+
+// MakeAttrStringOrdered creates a string of XML attributes in the order
+// given. When a name repeats, the last value is written at the position of
+// the first.
+func MakeAttrStringOrdered(attrs []Attr) string {
+	values, order := attrMap(attrs)
+	return attrString(values, order, plainAttrValue)
+}
+
+// attrMap returns the values of attrs by name and the names in order of
+// first appearance.
+func attrMap(attrs []Attr) (map[string]any, []string) {
+	values := make(map[string]any, len(attrs))
+	order := make([]string, 0, len(attrs))
+	for _, attr := range attrs {
+		if _, seen := values[attr.Name]; !seen {
+			order = append(order, attr.Name)
+		}
+		values[attr.Name] = attr.Value
+	}
+	return values, order
+}
+
+// makeAttrString renders attrs using the attribute ordering and invalid
+// character handling in opts.
+func makeAttrString(attrs map[string]any, opts Options) string {
+	opts.countAttributes(len(attrs))
+	return attrString(attrs, opts.AttrPriority, func(v any) string {
+		return escapeText(formatAttrValue(v, opts), opts)
+	})
+}
+
+// plainAttrValue renders an attribute value with the default options.
+func plainAttrValue(v any) string {
+	return EscapeXML(formatAttrValue(v, Options{}))
+}
+
+// attrString renders attrs with the priority ordering, writing each value
+// as returned by value.
+func attrString(attrs map[string]any, priority []string, value func(any) string) string {
 	if len(attrs) == 0 {
 		return ""
 	}
@@ -129,14 +752,60 @@ func MakeAttrString(attrs map[string]any) string {
 	}
 	sort.Strings(keys)
 
+	if len(priority) > 0 {
+		rank := func(k string) int {
+			if i := slices.Index(priority, k); i >= 0 {
+				return i
+			}
+			return len(priority)
+		}
+		sort.SliceStable(keys, func(i, j int) bool {
+			return rank(keys[i]) < rank(keys[j])
+		})
+	}
+
 	var parts []string
 	for _, k := range keys {
 		v := attrs[k]
-		parts = append(parts, fmt.Sprintf(`%s="%s"`, k, EscapeXML(fmt.Sprintf("%v", v))))
+		parts = append(parts, fmt.Sprintf(`%s="%s"`, k, value(v)))
 	}
 	return " " + strings.Join(parts, " ")
 }
 
+// formatAttrValue renders an attribute value. Numbers, booleans, times and
+// values with a TypeHandler are written like element text, nil as an empty
+// string, and maps, structs and lists as compact JSON rather than Go syntax.
+func formatAttrValue(val any, opts Options) string {
+	if text, ok := handleType(val, opts); ok {
+		return text
+	}
+	switch v := val.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case float32, float64:
+		return formatValue(v)
+	}
+
+	switch v := normalizeValue(val).(type) {
+	case nil:
+		return ""
+	case float64, *big.Float:
+		return formatValue(v)
+	case map[string]any, []any:
+		var buf bytes.Buffer
+		encoder := json.NewEncoder(&buf)
+		encoder.SetEscapeHTML(false)
+		if err := encoder.Encode(v); err == nil {
+			return strings.TrimSuffix(buf.String(), "\n")
+		}
+		return fmt.Sprintf("%v", v)
+	default:
+		return fmt.Sprintf("%v", v)
+	}
+}
+
 // KeyIsValidXML checks if a key is a valid XML name.
 func KeyIsValidXML(key string) bool {
 	if key == "" {
@@ -157,21 +826,37 @@ func KeyIsValidXML(key string) bool {
 }
 
 // MakeValidXMLName tests an XML name and fixes it if invalid.
+// Names starting with the reserved "xml" prefix are treated as invalid.
+// A key that cannot be fixed is stored unescaped in a name attribute of a
+// <key> element; it is escaped once, when the attributes are rendered.
 func MakeValidXMLName(key string, attrs map[string]any) (string, map[string]any) {
-	if KeyIsValidXML(key) {
+	return makeValidXMLName(key, attrs, Options{})
+}
+
+// makeValidXMLName is MakeValidXMLName using opts.NameValidator, if set,
+// in place of KeyIsValidXML.
+func makeValidXMLName(key string, attrs map[string]any, opts Options) (string, map[string]any) {
+	valid := func(name string) bool {
+		return KeyIsValidXML(name) && !isReservedXMLName(name)
+	}
+	if opts.NameValidator != nil {
+		valid = opts.NameValidator
+	}
+
+	if valid(key) {
 		return key, attrs
 	}
 
-	if isNumeric(key) {
+	if isNumeric(key) && valid("n"+key) {
 		return "n" + key, attrs
 	}
 
 	keyWithUnderscores := strings.ReplaceAll(key, " ", "_")
-	if KeyIsValidXML(keyWithUnderscores) {
+	if valid(keyWithUnderscores) {
 		return keyWithUnderscores, attrs
 	}
 
-	if strings.Contains(key, ":") && KeyIsValidXML(strings.ReplaceAll(key, ":", "")) {
+	if opts.NameValidator == nil && strings.Contains(key, ":") && valid(strings.ReplaceAll(key, ":", "")) {
 		return key, attrs
 	}
 
@@ -182,7 +867,15 @@ func MakeValidXMLName(key string, attrs map[string]any) (string, map[string]any)
 	return "key", attrs
 }
 
+// isReservedXMLName reports whether name starts with "xml" in any case,
+// which the XML specification reserves. Names in the predefined xml:
+// namespace, such as xml:lang, are allowed.
+func isReservedXMLName(name string) bool {
+	return len(name) >= 3 && strings.EqualFold(name[:3], "xml") && !strings.HasPrefix(name, "xml:")
+}
+
 // isNumeric checks if a string represents a number.
+// It is only used to sanitize element names, never to type values.
 func isNumeric(s string) bool {
 	if s == "" {
 		return false
@@ -201,11 +894,36 @@ func WrapCDATA(s string) string {
 	return "<![CDATA[" + s + "]]>"
 }
 
+// formatValue renders a scalar as element text. Floats are written in plain
+// decimal notation (1000000, not 1e+06) with the shortest representation
+// that round-trips at their own precision.
+func formatValue(val any) string {
+	switch v := val.(type) {
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case float32:
+		return strconv.FormatFloat(float64(v), 'f', -1, 32)
+	case *big.Float:
+		return v.Text('f', -1)
+	default:
+		return fmt.Sprintf("%v", val)
+	}
+}
+
 // GetXPath31TagName determines XPath 3.1 tag name by value type.
 func GetXPath31TagName(val any) string {
-	if val == nil {
+	if raw, ok := val.(json.RawMessage); ok {
+		val = decodeRawMessage(raw)
+	}
+	if val = indirect(val); val == nil {
 		return "null"
 	}
+	if _, ok := val.(json.Number); ok {
+		return "number"
+	}
+	if _, ok := bigNumber(val); ok {
+		return "number"
+	}
 
 	v := reflect.ValueOf(val)
 	switch v.Kind() {
@@ -213,6 +931,11 @@ func GetXPath31TagName(val any) string {
 		return "boolean"
 	case reflect.Map:
 		return "map"
+	case reflect.Struct:
+		if _, ok := val.(time.Time); ok {
+			return "string"
+		}
+		return "map"
 	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
 		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
 		reflect.Float32, reflect.Float64:
@@ -230,10 +953,25 @@ func GetXPath31TagName(val any) string {
 }
 
 // ConvertToXPath31 converts a value to XPath 3.1 json-to-xml format.
+// Characters not allowed in XML 1.0 are dropped.
 func ConvertToXPath31(obj any, parentKey string) string {
+	return convertToXPath31(obj, parentKey, Options{})
+}
+
+// convertToXPath31 is ConvertToXPath31 honoring opts.XPathArrayItemKey
+// and opts.InvalidCharMode.
+func convertToXPath31(obj any, parentKey string, opts Options) string {
+	if raw, ok := obj.(json.RawMessage); ok {
+		obj = decodeRawMessage(raw)
+	}
+	obj = opts.nullString(indirect(obj))
+	if n, ok := bigNumber(obj); ok {
+		obj = n
+	}
+	opts.checkRepresentable(obj)
 	keyAttr := ""
 	if parentKey != "" {
-		keyAttr = fmt.Sprintf(` key="%s"`, EscapeXML(parentKey))
+		keyAttr = fmt.Sprintf(` key="%s"`, escapeText(parentKey, opts))
 	}
 
 	switch GetXPath31TagName(obj) {
@@ -242,56 +980,111 @@ func ConvertToXPath31(obj any, parentKey string) string {
 	case "boolean":
 		return fmt.Sprintf("<boolean%s>%s</boolean>", keyAttr, strings.ToLower(fmt.Sprintf("%v", obj)))
 	case "number":
-		return fmt.Sprintf("<number%s>%v</number>", keyAttr, obj)
+		return fmt.Sprintf("<number%s>%s</number>", keyAttr, escapeText(formatValue(obj), opts))
 	case "string":
-		return fmt.Sprintf("<string%s>%s</string>", keyAttr, EscapeXML(fmt.Sprintf("%v", obj)))
+		if t, ok := obj.(time.Time); ok {
+			obj = opts.formatTime(t)
+		}
+		return fmt.Sprintf("<string%s>%s</string>", keyAttr, escapeText(fmt.Sprintf("%v", obj), opts))
 	case "map":
-		return convertXPathMap(obj, keyAttr)
+		return convertXPathMap(obj, keyAttr, opts)
 	case "array":
-		return convertXPathArray(obj, keyAttr)
+		return convertXPathArray(obj, parentKey, keyAttr, opts)
 	default:
-		return fmt.Sprintf("<string%s>%s</string>", keyAttr, EscapeXML(fmt.Sprintf("%v", obj)))
+		return fmt.Sprintf("<string%s>%s</string>", keyAttr, escapeText(fmt.Sprintf("%v", obj), opts))
 	}
 }
 
-func convertXPathMap(obj any, keyAttr string) string {
+func convertXPathMap(obj any, keyAttr string, opts Options) string {
+	opts, ok := opts.nest()
+	if !ok {
+		return fmt.Sprintf("<map%s/>", keyAttr)
+	}
+	opts = opts.withKeyOrder(obj)
 	var children strings.Builder
 	m := toMap(obj)
-	keys := sortedKeys(m)
+	keys := opts.keys(m)
+	opts.mapKeys = nil
 	for _, k := range keys {
-		children.WriteString(ConvertToXPath31(m[k], k))
+		if opts.omitted(m[k]) {
+			continue
+		}
+		children.WriteString(convertToXPath31(m[k], k, opts))
 	}
 	return fmt.Sprintf("<map%s>%s</map>", keyAttr, children.String())
 }
 
-func convertXPathArray(obj any, keyAttr string) string {
+func convertXPathArray(obj any, parentKey, keyAttr string, opts Options) string {
+	if !opts.XPathArrayItemKey {
+		parentKey = ""
+	}
+	opts, ok := opts.nest()
+	if !ok {
+		return fmt.Sprintf("<array%s/>", keyAttr)
+	}
 	var children strings.Builder
 	for _, item := range toSlice(obj) {
-		children.WriteString(ConvertToXPath31(item, ""))
+		children.WriteString(convertToXPath31(item, parentKey, opts))
 	}
 	return fmt.Sprintf("<array%s>%s</array>", keyAttr, children.String())
 }
 
-// toMap converts an interface to a map[string]any.
+// toMap converts an interface to a map[string]any. Structs become a map
+// of their fields (see structToMap).
 func toMap(v any) map[string]any {
-	if m, ok := v.(map[string]any); ok {
+	switch m := v.(type) {
+	case map[string]any:
 		return m
+	case OrderedMap:
+		return m.values
+	case map[string]string:
+		return anyMap(m)
+	case map[string]int:
+		return anyMap(m)
+	case map[string]int64:
+		return anyMap(m)
+	case map[string]float64:
+		return anyMap(m)
+	case map[string]bool:
+		return anyMap(m)
 	}
 	rv := reflect.ValueOf(v)
-	if rv.Kind() == reflect.Map {
+	switch rv.Kind() {
+	case reflect.Map:
 		result := make(map[string]any)
 		for _, key := range rv.MapKeys() {
 			result[fmt.Sprintf("%v", key.Interface())] = rv.MapIndex(key).Interface()
 		}
 		return result
+	case reflect.Struct:
+		return structToMap(rv)
 	}
 	return nil
 }
 
+// anyMap copies a map with common value types into a map[string]any
+// without going through reflection.
+func anyMap[V any](m map[string]V) map[string]any {
+	result := make(map[string]any, len(m))
+	for k, v := range m {
+		result[k] = v
+	}
+	return result
+}
+
 // toSlice converts an interface to a []any.
 func toSlice(v any) []any {
-	if s, ok := v.([]any); ok {
+	switch s := v.(type) {
+	case []any:
 		return s
+	case []string:
+		return anySlice(s)
+	case []int:
+		return anySlice(s)
+	case []float64:
+		return anySlice(s)
+	case []map[string]any:
+		return anySlice(s)
 	}
 	rv := reflect.ValueOf(v)
 	if rv.Kind() == reflect.Slice || rv.Kind() == reflect.Array {
@@ -304,6 +1097,15 @@ func toSlice(v any) []any {
 	return nil
 }
 
+// anySlice copies a slice with a common element type into a []any.
+func anySlice[T any](s []T) []any {
+	result := make([]any, len(s))
+	for i, v := range s {
+		result[i] = v
+	}
+	return result
+}
+
 // sortedKeys returns sorted keys from a map.
 func sortedKeys(m map[string]any) []string {
 	keys := make([]string, 0, len(m))
@@ -314,6 +1116,133 @@ func sortedKeys(m map[string]any) []string {
 	return keys
 }
 
+// maxDepth returns MaxDepth, or DefaultMaxDepth when it is zero.
+func (opts Options) maxDepth() int {
+	if opts.MaxDepth <= 0 {
+		return DefaultMaxDepth
+	}
+	return opts.MaxDepth
+}
+
+// nest returns opts for the contents of one more map or list. It reports
+// false, recording ErrMaxDepth, once that passes MaxDepth, so that the
+// recursive conversion functions stop on cyclic data even when called
+// directly, without the checkDepth walk.
+func (opts Options) nest() (Options, bool) {
+	opts.nesting++
+	if opts.nesting > opts.maxDepth() {
+		opts.fail(depthError(opts.maxDepth()))
+		return opts, false
+	}
+	return opts, true
+}
+
+// depthError is the ErrMaxDepth error for data nested beyond maxDepth.
+func depthError(maxDepth int) error {
+	return fmt.Errorf("%w: data is nested more than %d levels deep or contains itself", ErrMaxDepth, maxDepth)
+}
+
+// checkDepth reports ErrMaxDepth if maps, structs and lists in val nest
+// deeper than opts.MaxDepth allows. It fails fast, before any output is
+// written; the conversion functions check the same limit as they recurse.
+func checkDepth(val any, opts Options) error {
+	if !withinDepth(val, opts.maxDepth()) {
+		return depthError(opts.maxDepth())
+	}
+	return nil
+}
+
+// withinDepth reports whether the containers in val nest at most remaining levels.
+func withinDepth(val any, remaining int) bool {
+	switch v := val.(type) {
+	case nil:
+		return true
+	case map[string]any:
+		return remaining > 0 && allWithinDepth(maps.Values(v), remaining-1)
+	case []any:
+		return remaining > 0 && allWithinDepth(slices.Values(v), remaining-1)
+	}
+
+	rv := reflect.ValueOf(val)
+	for steps := 0; rv.Kind() == reflect.Pointer || rv.Kind() == reflect.Interface; steps++ {
+		if rv.IsNil() {
+			return true
+		}
+		if steps > remaining {
+			// Only pointers that lead back to themselves go on this long.
+			return false
+		}
+		rv = rv.Elem()
+	}
+
+	switch rv.Kind() {
+	case reflect.Map, reflect.Struct:
+		return remaining > 0 && allWithinDepth(maps.Values(toMap(rv.Interface())), remaining-1)
+	case reflect.Slice, reflect.Array:
+		return remaining > 0 && allWithinDepth(slices.Values(toSlice(rv.Interface())), remaining-1)
+	}
+	return true
+}
+
+func allWithinDepth(values iter.Seq[any], remaining int) bool {
+	for v := range values {
+		if !withinDepth(v, remaining) {
+			return false
+		}
+	}
+	return true
+}
+
+// checkData checks val against MaxDepth and AllowedKinds, as every
+// error-returning conversion does before converting.
+func checkData(val any, opts Options) error {
+	if err := checkDepth(val, opts); err != nil {
+		return err
+	}
+	return checkAllowedKinds(val, opts.AllowedKinds)
+}
+
+// checkAllowedKinds walks val and reports the first value whose kind is not
+// in allowed. Pointers are followed and the value they point to is checked,
+// as the conversion writes that value. val must already have passed
+// checkDepth, which rejects pointers that lead back to themselves.
+func checkAllowedKinds(val any, allowed []reflect.Kind) error {
+	if len(allowed) == 0 {
+		return nil
+	}
+	for reflect.ValueOf(val).Kind() == reflect.Pointer {
+		val = indirect(val)
+	}
+	if val == nil {
+		return nil
+	}
+
+	kind := reflect.ValueOf(val).Kind()
+	if _, ok := val.(OrderedMap); ok {
+		// An OrderedMap is a struct only to keep its key order.
+		kind = reflect.Map
+	}
+	if !slices.Contains(allowed, kind) {
+		return fmt.Errorf("%w: %T", ErrUnsupportedType, val)
+	}
+
+	switch kind {
+	case reflect.Map, reflect.Struct:
+		for _, v := range toMap(val) {
+			if err := checkAllowedKinds(v, allowed); err != nil {
+				return err
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		for _, v := range toSlice(val) {
+			if err := checkAllowedKinds(v, allowed); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
 // IsPrimitiveType checks if a value is a primitive type.
 func IsPrimitiveType(val any) bool {
 	t := GetXMLType(val)
@@ -326,14 +1255,19 @@ func normalizeValue(val any) any {
 	if val == nil {
 		return nil
 	}
+	if n, ok := bigNumber(val); ok {
+		return n
+	}
 
 	// Handle common concrete types directly (fast path)
 	switch v := val.(type) {
 	case bool, int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64,
-		float32, float64, string, map[string]any, []any:
+		float32, float64, string, map[string]any, []any, json.Number:
 		return v
 	case time.Time:
 		return v.Format(time.RFC3339)
+	case json.RawMessage:
+		return normalizeValue(decodeRawMessage(v))
 	}
 
 	// Use reflection for other types
@@ -349,108 +1283,450 @@ func normalizeValue(val any) any {
 		return rv.Float()
 	case reflect.String:
 		return rv.String()
-	case reflect.Map:
+	case reflect.Map, reflect.Struct:
 		return toMap(val)
 	case reflect.Slice, reflect.Array:
 		return toSlice(val)
+	case reflect.Pointer:
+		if rv.IsNil() {
+			return nil
+		}
+		return normalizeValue(rv.Elem().Interface())
 	default:
 		return fmt.Sprintf("%v", val)
 	}
 }
 
-// Convert routes elements to the right function based on their data type.
-func Convert(obj any, opts Options, parent string) string {
-	itemName := opts.ItemFunc(parent)
+// bigNumber returns val as a *big.Int or *big.Float if it is a non-nil
+// math/big integer or float, which are structs that would otherwise
+// convert as empty objects.
+func bigNumber(val any) (any, bool) {
+	switch v := val.(type) {
+	case *big.Int:
+		return v, v != nil
+	case *big.Float:
+		return v, v != nil
+	case big.Int:
+		return &v, true
+	case big.Float:
+		return &v, true
+	}
+	return nil, false
+}
 
-	if obj == nil {
-		return ConvertNone(itemName, opts.AttrType, nil, opts.CDATA)
-	}
+// isNilSlice reports whether val is a nil slice of any element type.
+func isNilSlice(val any) bool {
+	rv := reflect.ValueOf(val)
+	return rv.Kind() == reflect.Slice && rv.IsNil()
+}
 
-	v := reflect.ValueOf(obj)
-	switch v.Kind() {
-	case reflect.Bool:
-		return ConvertBool(itemName, obj.(bool), opts.AttrType, nil, opts.CDATA)
-	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
-		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
-		reflect.Float32, reflect.Float64, reflect.String:
-		return ConvertKV(itemName, obj, opts.AttrType, nil, opts.CDATA)
-	case reflect.Map:
-		return ConvertDict(toMap(obj), opts, parent)
-	case reflect.Slice, reflect.Array:
-		return ConvertList(toSlice(obj), opts, parent)
-	default:
-		if t, ok := obj.(time.Time); ok {
-			return ConvertKV(itemName, t.Format(time.RFC3339), opts.AttrType, nil, opts.CDATA)
-		}
-		return ConvertKV(itemName, fmt.Sprintf("%v", obj), opts.AttrType, nil, opts.CDATA)
+// handleType renders val with a registered TypeHandler, if one matches,
+// formats time.Time values, and renders enums by name when EnumAsString
+// is set.
+func handleType(val any, opts Options) (string, bool) {
+	if val == nil {
+		return "", false
+	}
+	if handler, ok := opts.TypeHandlers[reflect.TypeOf(val)]; ok {
+		return handler(val, opts), true
+	}
+	if t, ok := val.(time.Time); ok {
+		return opts.formatTime(t), true
+	}
+	if opts.EnumAsString {
+		return enumName(val)
 	}
+	return "", false
 }
 
-// ConvertDict converts a map into an XML string.
-func ConvertDict(obj map[string]any, opts Options, parent string) string {
+// enumName returns the String() of a named integer type that implements
+// fmt.Stringer, the usual shape of a Go enum.
+func enumName(val any) (string, bool) {
+	stringer, ok := val.(fmt.Stringer)
+	if !ok {
+		return "", false
+	}
+	switch reflect.TypeOf(val).Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return stringer.String(), true
+	}
+	return "", false
+}
+
+// customTypeName returns the Go type name of structs, pointers and other
+// values without a plain XML mapping, or "" for maps, lists and scalars.
+func customTypeName(val any) string {
+	if val == nil {
+		return ""
+	}
+	if _, ok := val.(time.Time); ok {
+		return ""
+	}
+
+	switch reflect.ValueOf(val).Kind() {
+	case reflect.Bool, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64, reflect.String,
+		reflect.Map, reflect.Slice, reflect.Array:
+		return ""
+	}
+
+	t := reflect.TypeOf(val)
+	if t.Name() != "" {
+		return t.Name()
+	}
+	return t.String()
+}
+
+// addCustomTypeAttr records the Go type name of val in attrs when
+// Options.CustomTypeAttr is set. attrs is allocated if needed.
+func addCustomTypeAttr(val any, opts Options, attrs map[string]any) map[string]any {
+	if opts.CustomTypeAttr == "" {
+		return attrs
+	}
+	if name := customTypeName(val); name != "" {
+		if attrs == nil {
+			attrs = make(map[string]any)
+		}
+		attrs[opts.CustomTypeAttr] = name
+	}
+	return attrs
+}
+
+// Convert routes elements to the right function based on their data type.
+func Convert(obj any, opts Options, parent string) string {
+	if opts.ItemFunc == nil {
+		opts.ItemFunc = DefaultItemFunc
+	}
+	itemName := opts.ItemFunc(parent)
+
+	if text, ok := handleType(obj, opts); ok {
+		return convertKV(itemName, text, addCustomTypeAttr(obj, opts, nil), opts)
+	}
+
+	if obj == nil {
+		return convertNone(itemName, nil, opts)
+	}
+	if raw, ok := obj.(json.RawMessage); ok {
+		return Convert(decodeRawMessage(raw), opts, parent)
+	}
+	if n, ok := bigNumber(obj); ok {
+		opts.checkRepresentable(n)
+		return convertKV(itemName, n, nil, opts)
+	}
+
+	v := reflect.ValueOf(obj)
+	switch v.Kind() {
+	case reflect.Bool:
+		return convertBool(itemName, obj.(bool), nil, opts)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64, reflect.String:
+		return convertKV(itemName, obj, nil, opts)
+	case reflect.Map, reflect.Struct:
+		if _, ok := obj.(OrderedMap); ok {
+			opts = opts.withKeyOrder(obj)
+		}
+		return ConvertDict(toMap(obj), opts, parent)
+	case reflect.Slice, reflect.Array:
+		return ConvertList(toSlice(obj), opts, parent)
+	case reflect.Pointer:
+		return Convert(indirect(obj), opts, parent)
+	default:
+		if t, ok := obj.(time.Time); ok {
+			return convertKV(itemName, opts.formatTime(t), nil, opts)
+		}
+		opts.checkRepresentable(obj)
+		return convertKV(itemName, fmt.Sprintf("%v", obj), addCustomTypeAttr(obj, opts, nil), opts)
+	}
+}
+
+// ConvertDict converts a map into an XML string.
+func ConvertDict(obj map[string]any, opts Options, parent string) string {
+	if opts.ItemFunc == nil {
+		opts.ItemFunc = DefaultItemFunc
+	}
 	var output strings.Builder
+	_ = writeDict(&output, obj, opts, parent)
+	return output.String()
+}
 
-	for _, key := range sortedKeys(obj) {
+// writeDict writes the elements for each map entry to w as they are produced.
+func writeDict(w io.Writer, obj map[string]any, opts Options, parent string) error {
+	opts, ok := opts.nest()
+	if !ok {
+		return nil
+	}
+	keys := opts.keys(obj)
+	opts.mapKeys = nil
+	if opts.MapAsEntries {
+		for _, key := range keys {
+			val := opts.collapse(obj[key])
+			if opts.omitted(val) {
+				continue
+			}
+			if _, err := io.WriteString(w, convertDictEntry(key, val, opts)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	var names map[string]bool
+	if opts.OnDuplicateName != DuplicateNameAllow {
+		names = make(map[string]bool, len(obj))
+	}
+	for _, key := range keys {
 		val := obj[key]
+		if opts.FlattenSingleKeyChains {
+			key, val = flattenChain(key, val)
+		}
+		val = opts.collapse(val)
+		if opts.omitted(val) {
+			continue
+		}
 		attrs := make(map[string]any)
 
 		if opts.IDs {
-			attrs["id"] = GetUniqueID(parent)
+			attrs["id"] = opts.uniqueID(parent)
 		}
 
 		keyIsFlat := strings.HasSuffix(key, "@flat")
-		xmlKey := strings.TrimSuffix(key, "@flat")
-		xmlKey, attrs = MakeValidXMLName(xmlKey, attrs)
+		xmlKey := opts.transformKey(strings.TrimSuffix(key, "@flat"))
+		xmlKey, attrs = makeValidXMLName(xmlKey, attrs, opts)
+		xmlKey = opts.elementName(xmlKey)
+		if names != nil {
+			xmlKey = uniqueName(xmlKey, key, names, opts)
+		}
 		if keyIsFlat {
 			if _, ok := normalizeValue(val).([]any); ok {
 				xmlKey += "@flat"
 			}
 		}
-		output.WriteString(convertDictValue(xmlKey, val, attrs, opts, parent))
+		if _, err := io.WriteString(w, convertDictValue(xmlKey, val, attrs, opts, parent)); err != nil {
+			return err
+		}
 	}
 
-	return output.String()
+	return nil
+}
+
+// uniqueName applies opts.OnDuplicateName to name, the element name for
+// key, and records it in names.
+func uniqueName(name, key string, names map[string]bool, opts Options) string {
+	if names[name] {
+		if opts.OnDuplicateName == DuplicateNameError {
+			opts.fail(fmt.Errorf("%w: key %q becomes <%s>, which is already used", ErrDuplicateName, key, name))
+		} else {
+			base := name
+			for i := 2; names[name]; i++ {
+				name = base + "_" + strconv.Itoa(i)
+			}
+		}
+	}
+	names[name] = true
+	return name
+}
+
+// flattenChain follows val through nested single-key maps, joining the keys
+// with "." (see Options.FlattenSingleKeyChains).
+func flattenChain(key string, val any) (string, any) {
+	for {
+		m, ok := normalizeValue(val).(map[string]any)
+		if !ok || len(m) != 1 || strings.HasSuffix(key, "@flat") {
+			return key, val
+		}
+		for childKey, child := range m {
+			if strings.HasPrefix(childKey, "@") {
+				return key, val
+			}
+			key, val = key+"."+childKey, child
+		}
+	}
+}
+
+// convertDictEntry renders a single map entry as an <entry> element.
+// Scalars are carried in a value attribute; maps and lists become children.
+func convertDictEntry(key string, val any, opts Options) string {
+	attrs := map[string]any{"key": key}
+	if text, ok := handleType(val, opts); ok {
+		val = text
+	}
+	normalized := opts.nullString(normalizeValue(val))
+	if opts.typeAttr(key) {
+		attrs["type"] = opts.xmlType(normalized)
+	}
+
+	name := opts.elementName("entry")
+	switch v := normalized.(type) {
+	case nil:
+	case map[string]any, []any:
+		childOpts := opts.enter(name, attrs).withKeyOrder(val)
+		return fmt.Sprintf("<%s%s>%s</%s>", name, makeAttrString(attrs, opts), Convert(v, childOpts, name), name)
+	case bool:
+		attrs["value"] = opts.formatBool(v)
+	default:
+		attrs["value"] = v
+	}
+	opts.enter(name, attrs)
+	return fmt.Sprintf("<%s%s/>", name, makeAttrString(attrs, opts))
+}
+
+// nullString returns nil for an empty string under EmptyStringAsNull, and
+// val unchanged otherwise.
+func (opts Options) nullString(val any) any {
+	if opts.EmptyStringAsNull && val == "" {
+		return nil
+	}
+	return val
+}
+
+// collapse replaces a single-item list with its item under
+// CollapseSingleItemLists, repeatedly for nested single-item lists.
+func (opts Options) collapse(val any) any {
+	if !opts.CollapseSingleItemLists {
+		return val
+	}
+	for {
+		if _, ok := handleType(val, opts); ok {
+			return val
+		}
+		items, ok := normalizeValue(val).([]any)
+		if !ok || len(items) != 1 {
+			return val
+		}
+		val = items[0]
+	}
+}
+
+// omitted reports whether a map entry holding val is skipped under
+// OmitEmptyLists or OmitEmptyObjects.
+func (opts Options) omitted(val any) bool {
+	if !opts.OmitEmptyLists && !opts.OmitEmptyObjects {
+		return false
+	}
+	if _, ok := handleType(val, opts); ok || opts.DistinguishNilSlice && isNilSlice(val) {
+		return false
+	}
+	switch v := normalizeValue(val).(type) {
+	case []any:
+		return opts.OmitEmptyLists && len(v) == 0
+	case map[string]any:
+		return opts.OmitEmptyObjects && len(v) == 0
+	}
+	return false
 }
 
 // convertDictValue handles conversion of a single dictionary value.
 func convertDictValue(key string, val any, attrs map[string]any, opts Options, parent string) string {
+	attrs = addCustomTypeAttr(val, opts, attrs)
+	if text, ok := handleType(val, opts); ok {
+		return convertKV(key, text, attrs, opts)
+	}
+
+	if s, ok := val.(string); ok && opts.hasName(opts.RawXMLKeys, key) {
+		return convertRawXML(key, s, attrs, opts)
+	}
+	if opts.DistinguishNilSlice && isNilSlice(val) {
+		return convertNone(key, attrs, opts)
+	}
+	opts.checkRepresentable(val)
+
 	normalized := normalizeValue(val)
 
 	switch v := normalized.(type) {
 	case nil:
-		return ConvertNone(key, opts.AttrType, attrs, opts.CDATA)
+		return convertNone(key, attrs, opts)
 	case bool:
-		return ConvertBool(key, v, opts.AttrType, attrs, opts.CDATA)
+		return convertBool(key, v, attrs, opts)
 	case map[string]any:
-		return Dict2XMLStr(opts, attrs, v, key, false, parent)
+		return Dict2XMLStr(opts.withKeyOrder(val), attrs, v, key, false, parent)
 	case []any:
 		return List2XMLStr(opts, attrs, v, key)
 	default:
-		return ConvertKV(key, v, opts.AttrType, attrs, opts.CDATA)
+		return convertKV(key, v, attrs, opts)
 	}
 }
 
+// convertRawXML writes fragment unescaped as the content of key
+// (see Options.RawXMLKeys).
+func convertRawXML(key, fragment string, attrs map[string]any, opts Options) string {
+	if err := checkFragment(fragment); err != nil {
+		if opts.RepairOutput {
+			return convertKV(key, fragment, attrs, opts)
+		}
+		opts.fail(fmt.Errorf("%w: raw XML for %q is not well-formed: %v", ErrInvalidData, key, err))
+	}
+	opts.enter(key, attrs)
+	return fmt.Sprintf("<%s%s>%s</%s>", key, makeAttrString(attrs, opts), fragment, key)
+}
+
 // Dict2XMLStr parses dict to XML string.
 func Dict2XMLStr(opts Options, attrs map[string]any, item map[string]any, itemName string, parentIsList bool, parent string) string {
-	if opts.AttrType {
+	if opts.typeAttr(itemName) {
 		attrs["type"] = GetXMLType(item)
 	}
 
-	valAttrs, rawItem, flat := extractSpecialAttrs(item, attrs)
-	subtree := buildSubtree(rawItem, opts, itemName)
+	valAttrs, attrOrder, rawItem, children, flat := extractSpecialAttrs(item, attrs, opts)
 
+	childOpts := opts
+	switch {
+	case parentIsList && opts.ListHeaders:
+		childOpts = opts.enter(parent, listHeaderAttrs(valAttrs, opts))
+	case !flat && (!parentIsList || opts.ItemWrap):
+		childOpts = opts.enter(itemName, valAttrs)
+	}
+	subtree := buildSubtree(rawItem, childOpts, itemName)
+	if _, ok := item["@val"]; ok {
+		if mixed := mixedChildren(children); len(mixed) > 0 {
+			subtree += buildSubtree(mixed, childOpts, itemName)
+		}
+	}
+
+	if attrOrder != nil {
+		opts.AttrPriority = attrOrder
+	}
 	return formatDictOutput(valAttrs, subtree, itemName, parent, parentIsList, flat, opts)
 }
 
-// extractSpecialAttrs extracts @attrs, @val, and @flat from an item.
-func extractSpecialAttrs(item map[string]any, defaultAttrs map[string]any) (attrs map[string]any, rawItem any, flat bool) {
+// extractSpecialAttrs extracts @attrs, @val, and @flat from an item, and
+// moves scalar entries whose keys start with attrPrefix into the attributes.
+// children holds the remaining keys; rawItem is @val when present and
+// children otherwise.
+func extractSpecialAttrs(item map[string]any, defaultAttrs map[string]any, opts Options) (attrs map[string]any, order []string, rawItem any, children map[string]any, flat bool) {
 	attrs = copyAttrs(defaultAttrs)
-	rawItem = copyItemWithoutSpecialAttrs(item)
+	children = copyItemWithoutSpecialAttrs(item)
+	rawItem = children
 
 	if customAttrs, ok := item["@attrs"]; ok {
-		if ca, ok := customAttrs.(map[string]any); ok {
+		if list, ok := attrList(customAttrs); ok {
+			attrs, order = attrMap(list)
+		} else if ca, ok := normalizeValue(customAttrs).(map[string]any); ok {
 			attrs = copyAttrs(ca)
 		}
+		for _, name := range sortedKeys(attrs) {
+			if !opts.validAttrName(name) {
+				opts.fail(fmt.Errorf("%w: invalid attribute name %q", ErrInvalidData, name))
+				delete(attrs, name)
+			}
+		}
+	}
+
+	if opts.AttrPrefix != "" {
+		for key, value := range children {
+			name, ok := strings.CutPrefix(key, opts.AttrPrefix)
+			// Keys that would make invalid attribute names stay
+			// children, named like any other key.
+			if !ok || !opts.validAttrName(name) || !IsPrimitiveType(value) {
+				continue
+			}
+			if value == nil {
+				value = ""
+			}
+			attrs[name] = value
+			delete(children, key)
+		}
 	}
 
 	if val, ok := item["@val"]; ok {
@@ -463,7 +1739,63 @@ func extractSpecialAttrs(item map[string]any, defaultAttrs map[string]any) (attr
 		}
 	}
 
-	return attrs, rawItem, flat
+	return attrs, order, rawItem, children, flat
+}
+
+// validAttrName reports whether name can be written as an attribute name,
+// using NameValidator when set.
+func (opts Options) validAttrName(name string) bool {
+	if opts.NameValidator != nil {
+		return opts.NameValidator(name)
+	}
+	return KeyIsValidXML(name)
+}
+
+// attrList reads @attrs given in order, as a []Attr or as a list of
+// [name, value] pairs. It reports false for anything else.
+func attrList(val any) ([]Attr, bool) {
+	switch v := val.(type) {
+	case []Attr:
+		return v, true
+	case []any:
+		list := make([]Attr, 0, len(v))
+		for _, item := range v {
+			switch pair := normalizeValue(item).(type) {
+			case Attr:
+				list = append(list, pair)
+			case []any:
+				if len(pair) != 2 {
+					return nil, false
+				}
+				name, ok := pair[0].(string)
+				if !ok {
+					return nil, false
+				}
+				list = append(list, Attr{Name: name, Value: pair[1]})
+			default:
+				return nil, false
+			}
+		}
+		return list, true
+	}
+	return nil, false
+}
+
+// mixedChildren returns the keys written after the @val text of a map,
+// making mixed content such as <p>hello <b>world</b></p>. Keys starting
+// with "@" are reserved and never become children.
+func mixedChildren(children map[string]any) map[string]any {
+	var mixed map[string]any
+	for key, value := range children {
+		if strings.HasPrefix(key, "@") {
+			continue
+		}
+		if mixed == nil {
+			mixed = make(map[string]any, len(children))
+		}
+		mixed[key] = value
+	}
+	return mixed
 }
 
 func copyItemWithoutSpecialAttrs(item map[string]any) map[string]any {
@@ -479,16 +1811,19 @@ func copyItemWithoutSpecialAttrs(item map[string]any) map[string]any {
 
 // buildSubtree creates the XML subtree for a value.
 func buildSubtree(rawItem any, opts Options, itemName string) string {
+	if text, ok := handleType(rawItem, opts); ok {
+		return escapeText(text, opts)
+	}
 	if IsPrimitiveType(rawItem) {
 		switch v := rawItem.(type) {
 		case nil:
 			return ""
 		case string:
-			return EscapeXML(v)
+			return escapeText(v, opts)
 		case bool:
-			return strings.ToLower(fmt.Sprintf("%v", v))
+			return escapeText(opts.formatBool(v), opts)
 		default:
-			return EscapeXML(fmt.Sprintf("%v", rawItem))
+			return escapeText(formatValue(rawItem), opts)
 		}
 	}
 	return Convert(rawItem, opts, itemName)
@@ -502,11 +1837,24 @@ func copyAttrs(attrs map[string]any) map[string]any {
 	return copied
 }
 
+// listHeaderAttrs returns the attributes of the repeated parent element
+// written for a map item with ListHeaders. With ItemWrap only the item
+// index is kept.
+func listHeaderAttrs(valAttrs map[string]any, opts Options) map[string]any {
+	if !opts.ItemWrap {
+		return valAttrs
+	}
+	if index, ok := valAttrs[opts.ItemIndexAttr]; ok && opts.ItemIndexAttr != "" {
+		return map[string]any{opts.ItemIndexAttr: index}
+	}
+	return nil
+}
+
 // formatDictOutput formats the final dict XML output.
 func formatDictOutput(valAttrs map[string]any, subtree, itemName, parent string, parentIsList, flat bool, opts Options) string {
 	if parentIsList && opts.ListHeaders {
-		if len(valAttrs) > 0 && !opts.ItemWrap {
-			return fmt.Sprintf("<%s%s>%s</%s>", parent, MakeAttrString(valAttrs), subtree, parent)
+		if headerAttrs := listHeaderAttrs(valAttrs, opts); len(headerAttrs) > 0 {
+			return fmt.Sprintf("<%s%s>%s</%s>", parent, makeAttrString(headerAttrs, opts), subtree, parent)
 		}
 		return fmt.Sprintf("<%s>%s</%s>", parent, subtree, parent)
 	}
@@ -515,133 +1863,398 @@ func formatDictOutput(valAttrs map[string]any, subtree, itemName, parent string,
 		return subtree
 	}
 
-	return fmt.Sprintf("<%s%s>%s</%s>", itemName, MakeAttrString(valAttrs), subtree, itemName)
+	return fmt.Sprintf("<%s%s>%s</%s>", itemName, makeAttrString(valAttrs, opts), subtree, itemName)
 }
 
 // List2XMLStr converts a list to XML string.
 func List2XMLStr(opts Options, attrs map[string]any, items []any, itemName string) string {
-	if opts.AttrType {
-		attrs["type"] = GetXMLType(items)
-	}
-
 	flat := strings.HasSuffix(itemName, "@flat")
 	itemName = strings.TrimSuffix(itemName, "@flat")
 
-	subtree := ConvertList(items, opts, itemName)
+	if opts.XSDListPrimitives && !flat {
+		if text, ok := xsdListText(items, opts); ok {
+			if opts.typeAttr(itemName) {
+				attrs["type"] = GetXMLType(items)
+			}
+			if opts.ListCountAttr {
+				attrs["count"] = len(items)
+			}
+			opts.enter(itemName, attrs)
+			opts.countList(len(items))
+			return fmt.Sprintf("<%s%s>%s</%s>", itemName, makeAttrString(attrs, opts), escapeText(text, opts), itemName)
+		}
+	}
 
-	if flat || (len(items) > 0 && IsPrimitiveType(items[0]) && !opts.ItemWrap) || opts.ListHeaders {
-		return subtree
+	// Without a wrapper element there is nothing to carry the list's attributes.
+	itemWrap := opts.ItemWrap || opts.ArrayAsIndexedObject
+	if flat || (len(items) > 0 && IsPrimitiveType(items[0]) && !itemWrap) || opts.ListHeaders {
+		return ConvertList(items, opts, itemName)
 	}
 
-	return fmt.Sprintf("<%s%s>%s</%s>", itemName, MakeAttrString(attrs), subtree, itemName)
+	if opts.typeAttr(itemName) {
+		attrs["type"] = GetXMLType(items)
+	}
+	if opts.ListCountAttr {
+		attrs["count"] = len(items)
+	}
+	subtree := ConvertList(items, opts.enter(itemName, attrs), itemName)
+
+	return fmt.Sprintf("<%s%s>%s</%s>", itemName, makeAttrString(attrs, opts), subtree, itemName)
+}
+
+// xsdListText joins items with spaces in xs:list form. It reports false
+// unless the list is non-empty and every item is a non-null scalar whose
+// text contains no whitespace.
+func xsdListText(items []any, opts Options) (string, bool) {
+	if len(items) == 0 {
+		return "", false
+	}
+	parts := make([]string, len(items))
+	for i, item := range items {
+		var text string
+		switch v := normalizeValue(item).(type) {
+		case nil, map[string]any, []any:
+			return "", false
+		case bool:
+			text = opts.formatBool(v)
+		default:
+			text = formatValue(v)
+		}
+		if text == "" || strings.ContainsFunc(text, unicode.IsSpace) {
+			return "", false
+		}
+		parts[i] = text
+	}
+	return strings.Join(parts, " "), true
 }
 
 // ConvertList converts a slice into an XML string.
 func ConvertList(items []any, opts Options, parent string) string {
+	if opts.ItemFunc == nil {
+		opts.ItemFunc = DefaultItemFunc
+	}
 	var output strings.Builder
-	itemName := strings.TrimSuffix(opts.ItemFunc(parent), "@flat")
+	_ = writeList(&output, items, opts, parent)
+	return output.String()
+}
 
-	for _, item := range items {
-		output.WriteString(convertListItem(item, itemName, parent, opts))
+// writeList writes the element for each list item to w as it is produced.
+func writeList(w io.Writer, items []any, opts Options, parent string) error {
+	opts, ok := opts.nest()
+	if !ok {
+		return nil
 	}
+	opts = listOptions(opts)
+	opts.countList(len(items))
 
-	return output.String()
+	for i, item := range items {
+		if _, err := io.WriteString(w, convertListItem(item, i, parent, opts)); err != nil {
+			return err
+		}
+	}
+
+	return nil
 }
 
-// convertListItem handles conversion of a single list item.
-func convertListItem(item any, itemName, parent string, opts Options) string {
-	attrs := make(map[string]any)
+// listOptions adjusts opts for converting the items of a list.
+func listOptions(opts Options) Options {
+	if opts.ArrayAsIndexedObject {
+		opts.ItemWrap = true
+	}
+	return opts
+}
+
+// listItemName returns the element name for item, the normalized value at
+// index i of a list.
+func listItemName(opts Options, parent string, i int, item any) string {
+	if opts.ArrayAsIndexedObject {
+		prefix := opts.IndexPrefix
+		if prefix == "" {
+			prefix = "_"
+		}
+		return opts.elementName(prefix + strconv.Itoa(i))
+	}
+	if name, ok := opts.TypeElementNames[opts.xmlType(item)]; ok {
+		return opts.elementName(name)
+	}
+	return opts.elementName(strings.TrimSuffix(opts.ItemFunc(parent), "@flat"))
+}
+
+// convertListItem handles conversion of the item at index i of a list.
+func convertListItem(item any, i int, parent string, opts Options) string {
+	attrs := addCustomTypeAttr(item, opts, make(map[string]any))
+	if opts.ItemIndexAttr != "" {
+		attrs[opts.ItemIndexAttr] = i
+	}
+	if text, ok := handleType(item, opts); ok {
+		item = text
+	}
+	if opts.DistinguishNilSlice && isNilSlice(item) {
+		item = nil
+	}
+	opts.checkRepresentable(item)
 	normalized := normalizeValue(item)
+	itemName := listItemName(opts, parent, i, opts.nullString(normalized))
 
 	switch v := normalized.(type) {
 	case nil:
-		return ConvertNone(itemName, opts.AttrType, attrs, opts.CDATA)
+		return convertNone(itemName, attrs, opts)
 	case bool:
-		return ConvertBool(itemName, v, opts.AttrType, attrs, opts.CDATA)
+		return convertBool(itemName, v, attrs, opts)
 	case map[string]any:
-		return Dict2XMLStr(opts, attrs, v, itemName, true, parent)
+		return Dict2XMLStr(opts.withKeyOrder(item), attrs, v, itemName, true, parent)
 	case []any:
-		return List2XMLStr(opts, attrs, v, itemName)
+		// Unwrapped, a nested list repeats the parent's name like a
+		// scalar item would.
+		name := itemName
+		if !opts.ItemWrap && parent != "" {
+			name = parent
+		}
+		return List2XMLStr(opts, attrs, v, name)
 	default:
 		name := itemName
 		if !opts.ItemWrap {
 			name = parent
 		}
-		return ConvertKV(name, v, opts.AttrType, attrs, opts.CDATA)
+		return convertKV(name, v, attrs, opts)
 	}
 }
 
 // ConvertKV converts a key-value pair into an XML element.
 func ConvertKV(key string, val any, attrType bool, attrs map[string]any, cdata bool) string {
+	return convertKV(key, val, attrs, Options{AttrType: attrType, CDATA: cdata})
+}
+
+func convertKV(key string, val any, attrs map[string]any, opts Options) string {
+	if opts.EmptyStringAsNull && val == "" {
+		return convertNone(key, attrs, opts)
+	}
 	if attrs == nil {
 		attrs = make(map[string]any)
 	}
-	key, attrs = MakeValidXMLName(key, attrs)
+	key, attrs = makeValidXMLName(key, attrs, opts)
+	childOpts := opts.enter(key, attrs)
 
 	if t, ok := val.(time.Time); ok {
-		val = t.Format(time.RFC3339)
+		val = opts.formatTime(t)
 	}
 
-	if attrType {
-		attrs["type"] = GetXMLType(val)
+	if opts.typeAttr(key) {
+		attrs["type"] = opts.xmlType(val)
 	}
 
-	valStr := fmt.Sprintf("%v", val)
-	if cdata {
-		valStr = WrapCDATA(valStr)
+	var valStr string
+	if s, ok := val.(string); ok && opts.MaxTextLength > 0 && utf8.RuneCountInString(s) > opts.MaxTextLength {
+		valStr = chunkText(s, childOpts)
 	} else {
-		valStr = EscapeXML(valStr)
+		valStr = formatText(formatValue(val), opts)
 	}
 
-	return fmt.Sprintf("<%s%s>%s</%s>", key, MakeAttrString(attrs), valStr, key)
+	if opts.SelfCloseEmpty && (valStr == "" || val == "") {
+		return fmt.Sprintf("<%s%s/>", key, makeAttrString(attrs, opts))
+	}
+	return fmt.Sprintf("<%s%s>%s</%s>", key, makeAttrString(attrs, opts), valStr, key)
+}
+
+// formatText escapes s as element content, or wraps it in CDATA.
+func formatText(s string, opts Options) string {
+	if opts.CDATA || opts.CDATAAuto && needsCDATA(s) {
+		return WrapCDATA(SanitizeXMLText(s, opts.InvalidCharMode))
+	}
+	return escapeText(s, opts)
+}
+
+// needsCDATA reports whether s holds markup characters that read better in
+// a CDATA section than escaped.
+func needsCDATA(s string) bool {
+	return strings.ContainsAny(s, "<&") || strings.Contains(s, "]]>")
+}
+
+// chunkText splits s into <chunk> elements of at most MaxTextLength
+// characters each.
+func chunkText(s string, opts Options) string {
+	var output strings.Builder
+	runes := []rune(s)
+	for start := 0; start < len(runes); start += opts.MaxTextLength {
+		end := min(start+opts.MaxTextLength, len(runes))
+		opts.enter("chunk", nil)
+		output.WriteString("<chunk>" + formatText(string(runes[start:end]), opts) + "</chunk>")
+	}
+	return output.String()
 }
 
 // ConvertBool converts a boolean into an XML element.
 func ConvertBool(key string, val bool, attrType bool, attrs map[string]any, cdata bool) string {
+	return convertBool(key, val, attrs, Options{AttrType: attrType, CDATA: cdata})
+}
+
+func convertBool(key string, val bool, attrs map[string]any, opts Options) string {
 	if attrs == nil {
 		attrs = make(map[string]any)
 	}
-	key, attrs = MakeValidXMLName(key, attrs)
+	key, attrs = makeValidXMLName(key, attrs, opts)
+	opts.enter(key, attrs)
 
-	if attrType {
+	if opts.typeAttr(key) {
 		attrs["type"] = GetXMLType(val)
 	}
 
-	return fmt.Sprintf("<%s%s>%s</%s>", key, MakeAttrString(attrs), strings.ToLower(fmt.Sprintf("%v", val)), key)
+	return fmt.Sprintf("<%s%s>%s</%s>", key, makeAttrString(attrs, opts), escapeText(opts.formatBool(val), opts), key)
 }
 
 // ConvertNone converts a null value into an XML element.
 func ConvertNone(key string, attrType bool, attrs map[string]any, cdata bool) string {
+	return convertNone(key, attrs, Options{AttrType: attrType, CDATA: cdata})
+}
+
+func convertNone(key string, attrs map[string]any, opts Options) string {
 	if attrs == nil {
 		attrs = make(map[string]any)
 	}
-	key, attrs = MakeValidXMLName(key, attrs)
+	key, attrs = makeValidXMLName(key, attrs, opts)
+	opts.enter(key, attrs)
 
-	if attrType {
+	if opts.typeAttr(key) {
 		attrs["type"] = GetXMLType(nil)
 	}
+	if opts.NilAttr != "" {
+		attrs[opts.NilAttr] = true
+	}
 
-	return fmt.Sprintf("<%s%s></%s>", key, MakeAttrString(attrs), key)
+	if opts.SelfCloseEmpty {
+		return fmt.Sprintf("<%s%s/>", key, makeAttrString(attrs, opts))
+	}
+	return fmt.Sprintf("<%s%s></%s>", key, makeAttrString(attrs, opts), key)
 }
 
-// DictToXML converts a Go value into XML bytes.
+// DictToXML converts a Go value into XML bytes. It never fails: values
+// that have no XML form, such as funcs, are written as their %v text,
+// names are written as given, and data nested deeper than
+// Options.MaxDepth is cut off there. DictToXMLErr reports these problems
+// instead, as do the other error-returning conversions. AllowedKinds is
+// only enforced by those.
+//
+// A top-level scalar (string, number, bool or nil) becomes the text of the
+// root element, typed like any other value: <root type="int">42</root>.
+// Without a root element it is written as a single ItemFunc element,
+// <item type="int">42</item>.
 func DictToXML(obj any, opts Options) []byte {
+	output, _ := convertDocument(obj, opts)
+	return output
+}
+
+// DictToXMLErr converts obj like DictToXML but fails, returning nil, on
+// the problems DictToXML writes through:
+//   - ErrMaxDepth when obj nests deeper than Options.MaxDepth or contains
+//     itself;
+//   - ErrInvalidData when the root element name or a namespace prefix in
+//     XMLNamespaces is not a valid XML name, or when obj holds a func,
+//     channel or unsafe pointer, which have no XML representation;
+//   - ErrUnsupportedType when obj holds a kind missing from AllowedKinds;
+//   - ErrDuplicateName and ErrUndeclaredPrefix when their options ask for
+//     them.
+func DictToXMLErr(obj any, opts Options) ([]byte, error) {
+	return dictToXML(obj, opts)
+}
+
+// DictToXMLValidated converts obj like DictToXMLErr. With
+// Options.StrictNamespaces it fails with ErrUndeclaredPrefix on element
+// names whose prefix is not declared.
+func DictToXMLValidated(obj any, opts Options) ([]byte, error) {
+	return DictToXMLErr(obj, opts)
+}
+
+// checkDocument reports ErrInvalidData when the root element name, the
+// NilAttr name or a namespace prefix in opts cannot appear in well-formed
+// XML. RepairOutput sanitizes the root name instead.
+func checkDocument(opts Options) error {
+	if opts.XPathFormat {
+		return nil
+	}
+	if opts.Root && !opts.RepairOutput && !KeyIsValidXML(opts.CustomRoot) {
+		return fmt.Errorf("%w: invalid root element name %q", ErrInvalidData, opts.CustomRoot)
+	}
+	if opts.NilAttr != "" && !KeyIsValidXML(opts.NilAttr) {
+		return fmt.Errorf("%w: invalid nil attribute name %q", ErrInvalidData, opts.NilAttr)
+	}
+	for prefix := range opts.XMLNamespaces {
+		if prefix == "xmlns" || prefix == "xsi" {
+			continue
+		}
+		if strings.Contains(prefix, ":") || !KeyIsValidXML(prefix) {
+			return fmt.Errorf("%w: invalid namespace prefix %q", ErrInvalidData, prefix)
+		}
+	}
+	return nil
+}
+
+// dictToXML implements DictToXMLErr.
+func dictToXML(obj any, opts Options) ([]byte, error) {
+	if err := checkData(obj, opts); err != nil {
+		return nil, err
+	}
+	if err := checkDocument(opts); err != nil {
+		return nil, err
+	}
+	output, err := convertDocument(obj, opts)
+	if err != nil {
+		return nil, err
+	}
+	return output, nil
+}
+
+// convertDocument converts obj in full. It returns the output along with
+// the first error recorded while converting, which DictToXML ignores.
+func convertDocument(obj any, opts Options) ([]byte, error) {
 	if opts.ItemFunc == nil {
 		opts.ItemFunc = DefaultItemFunc
 	}
 
+	var failure error
+	opts.failure = &failure
 	if opts.XPathFormat {
-		return buildXPathXML(obj)
+		return buildXPathXML(obj, opts), failure
+	}
+
+	// With RepairOutput the document may be converted twice, so OnElement
+	// calls are held back and replayed only if the first output is kept.
+	onElement := opts.OnElement
+	var pending []elementEvent
+	if opts.RepairOutput && onElement != nil {
+		opts.OnElement = func(name string, depth int) {
+			pending = append(pending, elementEvent{name, depth})
+		}
 	}
 
-	return buildStandardXML(obj, opts)
+	output := buildStandardXML(obj, opts)
+	if opts.RepairOutput {
+		opts.OnElement = onElement
+		var rebuilt bool
+		output, rebuilt = repairXML(output, obj, opts)
+		if !rebuilt {
+			for _, e := range pending {
+				onElement(e.name, e.depth)
+			}
+		}
+	}
+	if opts.Minify {
+		output = minifyXML(output)
+	}
+	return output, failure
+}
+
+// elementEvent is an OnElement call held back while RepairOutput decides
+// which conversion to keep.
+type elementEvent struct {
+	name  string
+	depth int
 }
 
 // buildXPathXML creates XML in XPath 3.1 format.
-func buildXPathXML(obj any) []byte {
-	xmlContent := ConvertToXPath31(obj, "")
+func buildXPathXML(obj any, opts Options) []byte {
+	xmlContent := convertToXPath31(obj, "", opts)
 	var output bytes.Buffer
-	output.WriteString(`<?xml version="1.0" encoding="UTF-8" ?>`)
+	output.WriteString(opts.prolog())
 
 	switch {
 	case strings.HasPrefix(xmlContent, "<map"):
@@ -659,16 +2272,111 @@ func buildXPathXML(obj any) []byte {
 func buildStandardXML(obj any, opts Options) []byte {
 	var output bytes.Buffer
 	if opts.Root {
-		output.WriteString(`<?xml version="1.0" encoding="UTF-8" ?>`)
-		outputElem := Convert(obj, opts, opts.CustomRoot)
-		namespaceStr := buildNamespaceString(opts.XMLNamespaces)
-		output.WriteString(fmt.Sprintf("<%s%s>%s</%s>", opts.CustomRoot, namespaceStr, outputElem, opts.CustomRoot))
+		output.WriteString(opts.prolog())
+		rootType := ""
+		if isContainer(obj, opts) {
+			rootType = GetXMLType(obj)
+		}
+		attrs, childOpts := enterRoot(opts, rootType)
+		// The root's descendants are counted by the statistics, which
+		// are gathered just for this when ConvertWithStats is not.
+		if opts.RootElementCountAttr != "" && childOpts.stats == nil {
+			childOpts.stats = new(Stats)
+		}
+		before := 0
+		if childOpts.stats != nil {
+			before = childOpts.stats.Elements
+		}
+		outputElem, ok := rootScalarText(obj, attrs, childOpts)
+		if !ok {
+			outputElem = Convert(obj, childOpts, opts.CustomRoot)
+		}
+		if opts.RootElementCountAttr != "" {
+			attrs[opts.RootElementCountAttr] = childOpts.stats.Elements - before
+		}
+		output.WriteString(fmt.Sprintf("%s%s</%s>", formatRootStartTag(attrs, opts), outputElem, opts.CustomRoot))
 	} else {
 		output.WriteString(Convert(obj, opts, ""))
 	}
 	return output.Bytes()
 }
 
+// rootScalarText renders a top-level scalar as the text of the root
+// element, adding its type to the root attrs, so that 42 becomes
+// <root type="int">42</root>. It reports false for maps and lists.
+func rootScalarText(obj any, attrs map[string]any, opts Options) (string, bool) {
+	if text, ok := handleType(obj, opts); ok {
+		obj = text
+	}
+	opts.checkRepresentable(obj)
+	normalized := opts.nullString(normalizeValue(obj))
+	switch normalized.(type) {
+	case map[string]any, []any:
+		return "", false
+	}
+
+	if opts.typeAttr(opts.CustomRoot) {
+		attrs["type"] = opts.xmlType(normalized)
+	}
+	switch v := normalized.(type) {
+	case nil:
+		if opts.NilAttr != "" {
+			attrs[opts.NilAttr] = true
+		}
+		return "", true
+	case bool:
+		return escapeText(opts.formatBool(v), opts), true
+	case string:
+		if opts.MaxTextLength > 0 && utf8.RuneCountInString(v) > opts.MaxTextLength {
+			return chunkText(v, opts), true
+		}
+	}
+	return formatText(formatValue(normalized), opts), true
+}
+
+// rootStartTag renders the root element's start tag and returns the options
+// for converting its children. rootType is the document's "dict" or "list"
+// type for Options.RootAttrType.
+func rootStartTag(opts Options, rootType string) (string, Options) {
+	attrs, childOpts := enterRoot(opts, rootType)
+	return formatRootStartTag(attrs, opts), childOpts
+}
+
+// enterRoot enters the root element, returning its attributes and the
+// options for converting its children.
+func enterRoot(opts Options, rootType string) (map[string]any, Options) {
+	attrs := make(map[string]any)
+	if rootType != "" && opts.RootAttrType && opts.typeAttr(opts.CustomRoot) {
+		attrs["type"] = rootType
+	}
+	if opts.TimestampAttr != "" {
+		now := time.Now
+		if opts.Clock != nil {
+			now = opts.Clock
+		}
+		attrs[opts.TimestampAttr] = opts.formatTime(now())
+	}
+	return attrs, opts.enter(opts.CustomRoot, attrs)
+}
+
+// formatRootStartTag renders the root start tag with its namespace
+// declarations and attrs.
+func formatRootStartTag(attrs map[string]any, opts Options) string {
+	namespaces := opts.XMLNamespaces
+	if opts.LazyNamespaces {
+		namespaces = make(map[string]any)
+		for _, prefix := range []string{"xmlns", "xsi"} {
+			if value, ok := opts.XMLNamespaces[prefix]; ok {
+				namespaces[prefix] = value
+			}
+		}
+	}
+
+	nsString := buildNamespaceString(namespaces)
+	opts.countAttributes(strings.Count(nsString, `="`))
+	return fmt.Sprintf("<%s%s%s>", opts.CustomRoot, nsString, makeAttrString(attrs, opts))
+}
+
 // buildNamespaceString creates the namespace attribute string.
 func buildNamespaceString(namespaces map[string]any) string {
 	if namespaces == nil {
@@ -710,39 +2418,220 @@ func buildXSINamespace(prefix string, value any) string {
 
 // PrettyPrint formats XML with indentation.
 func PrettyPrint(xmlBytes []byte) (string, error) {
+	return PrettyPrintWith(xmlBytes, "", "  ")
+}
+
+// PrettyPrintWith formats XML like PrettyPrint, beginning each line with
+// prefix and indenting nested elements with indent.
+//
+// A leading XML declaration is kept as-is, whatever encoding it names;
+// documents without one get <?xml version="1.0" encoding="UTF-8"?>.
+func PrettyPrintWith(xmlBytes []byte, prefix, indent string) (string, error) {
+	return prettyPrint(xmlBytes, prettyConfig{prefix: prefix, indent: indent})
+}
+
+// PrettyPrintTo formats XML like PrettyPrint, writing the result to w as
+// it is produced instead of building a string. If formatting fails part
+// way through, some output may already have been written.
+func PrettyPrintTo(w io.Writer, xmlBytes []byte) error {
+	return prettyPrintTo(w, xmlBytes, prettyConfig{indent: "  "})
+}
+
+// PrettyPrintOptions formats XML like PrettyPrint, honoring the
+// CompactLeaves and XMLDeclaration options.
+func PrettyPrintOptions(xmlBytes []byte, opts Options) (string, error) {
+	return prettyPrint(xmlBytes, prettyConfig{
+		indent:        "  ",
+		declaration:   opts.XMLDeclaration,
+		compactLeaves: opts.CompactLeaves,
+	})
+}
+
+// prettyConfig controls prettyPrint.
+type prettyConfig struct {
+	prefix, indent string
+	// declaration, when non-nil, replaces the document's own declaration,
+	// with "" omitting it.
+	declaration *string
+	// compactLeaves drops whitespace-only text containing a newline.
+	compactLeaves bool
+}
+
+// prettyPrint implements the string-returning PrettyPrint functions.
+func prettyPrint(xmlBytes []byte, cfg prettyConfig) (string, error) {
+	var out strings.Builder
+	if err := prettyPrintTo(&out, xmlBytes, cfg); err != nil {
+		return "", err
+	}
+	return out.String(), nil
+}
+
+// prettyPrintTo implements the PrettyPrint functions, writing to w as the
+// input is decoded.
+func prettyPrintTo(w io.Writer, xmlBytes []byte, cfg prettyConfig) error {
+	decl, xmlBytes := splitXMLDeclaration(xmlBytes)
+	if cfg.declaration != nil {
+		decl = *cfg.declaration
+	} else if decl == "" {
+		decl = `<?xml version="1.0" encoding="UTF-8"?>`
+	}
+
+	writer := bufio.NewWriter(w)
+	if decl != "" {
+		if _, err := io.WriteString(writer, decl+"\n"); err != nil {
+			return err
+		}
+	}
+
+	// The encoder writes to buf, which is passed on to writer after each
+	// token unless a self-closing tag still has to be restored in it.
 	var buf bytes.Buffer
 	decoder := xml.NewDecoder(bytes.NewReader(xmlBytes))
 	encoder := xml.NewEncoder(&buf)
-	encoder.Indent("", "  ")
+	encoder.Indent(cfg.prefix, cfg.indent)
+	drain := func() error {
+		if err := encoder.Flush(); err != nil {
+			return err
+		}
+		_, err := buf.WriteTo(writer)
+		return err
+	}
 
+	selfClosing := false
+	depth := 0
 	for {
+		start := decoder.InputOffset()
 		token, err := decoder.Token()
 		if err != nil {
 			if err.Error() == "EOF" {
 				break
 			}
-			return "", err
+			return err
 		}
 		if token == nil {
 			break
 		}
+		// The decoder reports CDATA sections as plain text, so copy them
+		// through verbatim instead of letting the encoder escape them.
+		if text, ok := token.(xml.CharData); ok {
+			if raw := xmlBytes[start:decoder.InputOffset()]; bytes.HasPrefix(raw, []byte("<![CDATA[")) {
+				if err := encoder.Flush(); err != nil {
+					return err
+				}
+				buf.Write(raw)
+				continue
+			}
+			if cfg.compactLeaves && isIndentation(text) {
+				continue
+			}
+			// Whitespace around the root element, such as a newline after
+			// the declaration, is insignificant; the encoder adds its own.
+			if depth == 0 && len(bytes.TrimLeft(text, " \t\r\n")) == 0 {
+				continue
+			}
+		}
 		if err := encoder.EncodeToken(token); err != nil {
-			return "", err
+			return err
+		}
+
+		// The encoder always writes paired tags; restore elements that
+		// were self-closing in the input.
+		switch t := token.(type) {
+		case xml.StartElement:
+			depth++
+			selfClosing = bytes.HasSuffix(xmlBytes[start:decoder.InputOffset()], []byte("/>"))
+		case xml.EndElement:
+			depth--
+			if selfClosing {
+				if err := encoder.Flush(); err != nil {
+					return err
+				}
+				out := buf.Bytes()
+				buf.Truncate(bytes.LastIndex(out, []byte("></")))
+				buf.WriteString("/>")
+			}
+			selfClosing = false
+		case xml.ProcInst:
+			// Processing instructions such as xml-stylesheet go on their own line.
+			if strings.HasPrefix(t.Target, "xml") {
+				if err := encoder.Flush(); err != nil {
+					return err
+				}
+				buf.WriteString("\n")
+			}
+			selfClosing = false
+		default:
+			selfClosing = false
+		}
+
+		if !selfClosing {
+			if err := drain(); err != nil {
+				return err
+			}
 		}
 	}
-	if err := encoder.Flush(); err != nil {
-		return "", err
+	if err := drain(); err != nil {
+		return err
 	}
+	return writer.Flush()
+}
 
-	result := buf.String()
-	if !strings.HasPrefix(result, "<?xml") {
-		result = `<?xml version="1.0" encoding="UTF-8"?>` + "\n" + result
+// splitXMLDeclaration separates a leading XML declaration from the rest of
+// the document. The declaration is not parsed, so encodings the decoder
+// does not support pass through untouched.
+func splitXMLDeclaration(xmlBytes []byte) (string, []byte) {
+	if len(xmlBytes) < 6 || !bytes.HasPrefix(xmlBytes, []byte("<?xml")) || !isXMLSpace(xmlBytes[5]) {
+		return "", xmlBytes
+	}
+	end := bytes.Index(xmlBytes, []byte("?>"))
+	if end < 0 {
+		return "", xmlBytes
 	}
+	return string(xmlBytes[:end+2]), xmlBytes[end+2:]
+}
 
-	re := regexp.MustCompile(`<\?xml[^?]*\?>`)
-	result = re.ReplaceAllStringFunc(result, func(s string) string {
-		return s + "\n"
-	})
+// minifyXML removes whitespace-only text between the elements of xmlBytes,
+// keeping it where it is the entire content of an element and inside
+// CDATA sections. Input the decoder rejects is returned unchanged.
+func minifyXML(xmlBytes []byte) []byte {
+	decoder := xml.NewDecoder(bytes.NewReader(xmlBytes))
+	output := make([]byte, 0, len(xmlBytes))
+	var pending []byte
+	afterStart := false
+	var offset int64
+	for {
+		tok, err := decoder.RawToken()
+		if err == io.EOF {
+			return output
+		}
+		if err != nil {
+			return xmlBytes
+		}
+		end := decoder.InputOffset()
+		raw := xmlBytes[offset:end]
+		offset = end
+
+		if _, ok := tok.(xml.CharData); ok && len(bytes.TrimLeft(raw, " \t\r\n")) == 0 {
+			if afterStart {
+				pending = raw
+			}
+			continue
+		}
+		if _, ok := tok.(xml.EndElement); ok {
+			output = append(output, pending...)
+		}
+		pending = nil
+		_, afterStart = tok.(xml.StartElement)
+		output = append(output, raw...)
+	}
+}
+
+// isIndentation reports whether text is whitespace-only and spans lines.
+func isIndentation(text []byte) bool {
+	return bytes.ContainsRune(text, '\n') && len(bytes.TrimLeft(text, " \t\r\n")) == 0
+}
 
-	return result, nil
+// isXMLSpace reports whether b is an XML whitespace character.
+func isXMLSpace(b byte) bool {
+	return b == ' ' || b == '\t' || b == '\n' || b == '\r'
 }
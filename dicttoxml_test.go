@@ -2,6 +2,17 @@ package json2xml
 
 import (
 	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"math/big"
+	"math/rand"
+	"os"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
 	"strings"
 	"testing"
 	"time"
@@ -47,6 +58,27 @@ func TestGetUniqueID(t *testing.T) {
 	})
 }
 
+func TestIDSource(t *testing.T) {
+	data := map[string]any{"a": 1, "b": map[string]any{"c": "x"}}
+	convert := func(seed int64) string {
+		opts := DefaultOptions()
+		opts.IDs = true
+		opts.IDSource = rand.New(rand.NewSource(seed))
+		return string(DictToXML(data, opts))
+	}
+
+	first := convert(42)
+	if second := convert(42); first != second {
+		t.Errorf("expected identical output for the same seed, got %s and %s", first, second)
+	}
+	if other := convert(7); other == first {
+		t.Errorf("expected different IDs for a different seed, got %s", other)
+	}
+	if !strings.Contains(first, `<a id="root_`) {
+		t.Errorf("expected id attributes, got %s", first)
+	}
+}
+
 func TestGetXMLType(t *testing.T) {
 	tests := []struct {
 		name     string
@@ -119,6 +151,124 @@ func TestMakeAttrString(t *testing.T) {
 			t.Errorf("expected escaped value, got %s", result)
 		}
 	})
+
+	t.Run("priority attributes lead, rest alphabetical", func(t *testing.T) {
+		attrs := map[string]any{"zeta": 1, "name": "n", "alpha": 2, "id": "x", "beta": 3}
+		result := MakeAttrStringWithPriority(attrs, []string{"id", "name", "missing"})
+		expected := ` id="x" name="n" alpha="2" beta="3" zeta="1"`
+		if result != expected {
+			t.Errorf("expected %q, got %q", expected, result)
+		}
+	})
+
+	t.Run("AttrPriority applies during conversion", func(t *testing.T) {
+		data := map[string]any{"node": map[string]any{
+			"@attrs": map[string]any{"zeta": "z", "name": "n", "id": "x"},
+			"@val":   "v",
+		}}
+		opts := DefaultOptions()
+		opts.Root = false
+		opts.AttrPriority = []string{"id", "name"}
+		result := DictToXML(data, opts)
+
+		expected := `<node id="x" name="n" zeta="z">v</node>`
+		if string(result) != expected {
+			t.Errorf("expected %s, got %s", expected, string(result))
+		}
+	})
+
+	t.Run("formats values by type", func(t *testing.T) {
+		attrs := map[string]any{
+			"big":    1e6,
+			"ratio":  float32(0.1),
+			"count":  int64(42),
+			"on":     true,
+			"none":   nil,
+			"nested": map[string]any{"a": 1, "b": "<x>"},
+			"list":   []any{1, "two"},
+		}
+		result := MakeAttrString(attrs)
+		expected := ` big="1000000" count="42" list="[1,&quot;two&quot;]" nested="{&quot;a&quot;:1,&quot;b&quot;:&quot;&lt;x&gt;&quot;}" none="" on="true" ratio="0.1"`
+		if result != expected {
+			t.Errorf("expected %q, got %q", expected, result)
+		}
+	})
+
+	t.Run("numeric and boolean values in @attrs", func(t *testing.T) {
+		data := map[string]any{"node": map[string]any{
+			"@attrs": map[string]any{"price": 1500000.0, "qty": 3, "active": false, "rate": 0.25},
+			"@val":   "v",
+		}}
+		opts := DefaultOptions()
+		opts.Root = false
+		result := DictToXML(data, opts)
+
+		expected := `<node active="false" price="1500000" qty="3" rate="0.25">v</node>`
+		if string(result) != expected {
+			t.Errorf("expected %s, got %s", expected, string(result))
+		}
+	})
+}
+
+func TestMakeAttrStringOrdered(t *testing.T) {
+	t.Run("keeps the given order", func(t *testing.T) {
+		result := MakeAttrStringOrdered([]Attr{{"zeta", 1}, {"alpha", "a<b"}, {"mid", true}})
+		expected := ` zeta="1" alpha="a&lt;b" mid="true"`
+		if result != expected {
+			t.Errorf("expected %q, got %q", expected, result)
+		}
+	})
+
+	t.Run("repeated name keeps first position", func(t *testing.T) {
+		result := MakeAttrStringOrdered([]Attr{{"b", 1}, {"a", 2}, {"b", 3}})
+		expected := ` b="3" a="2"`
+		if result != expected {
+			t.Errorf("expected %q, got %q", expected, result)
+		}
+	})
+
+	t.Run("empty", func(t *testing.T) {
+		if result := MakeAttrStringOrdered(nil); result != "" {
+			t.Errorf("expected empty string, got %q", result)
+		}
+	})
+
+	tests := []struct {
+		name     string
+		attrs    any
+		expected string
+	}{
+		{"[]Attr", []Attr{{"zeta", "z"}, {"id", 7}}, `<node zeta="z" id="7">v</node>`},
+		{"pairs", []any{[]any{"zeta", "z"}, []any{"id", 7}}, `<node zeta="z" id="7">v</node>`},
+		{"malformed pairs ignored", []any{[]any{"zeta"}}, `<node type="dict">v</node>`},
+		{"map stays sorted", map[string]any{"zeta": "z", "id": 7}, `<node id="7" zeta="z">v</node>`},
+	}
+	for _, tt := range tests {
+		t.Run("@attrs as "+tt.name, func(t *testing.T) {
+			data := map[string]any{"node": map[string]any{"@attrs": tt.attrs, "@val": "v"}}
+			opts := DefaultOptions()
+			opts.Root = false
+			opts.AttrPriority = []string{"id"}
+			result := DictToXML(data, opts)
+			if string(result) != tt.expected {
+				t.Errorf("expected %s, got %s", tt.expected, result)
+			}
+		})
+	}
+
+	t.Run("@attrs pairs from JSON", func(t *testing.T) {
+		data, err := ReadFromString(`{"a": {"@attrs": [["z", 1], ["b", "two"], ["m", null]], "@val": "x"}}`)
+		if err != nil {
+			t.Fatal(err)
+		}
+		opts := DefaultOptions()
+		opts.Root = false
+		result := DictToXML(data, opts)
+		expected := `<a z="1" b="two" m="">x</a>`
+		if string(result) != expected {
+			t.Errorf("expected %s, got %s", expected, result)
+		}
+	})
 }
 
 func TestKeyIsValidXML(t *testing.T) {
@@ -164,6 +314,53 @@ func TestMakeValidXMLName(t *testing.T) {
 			t.Errorf("expected 'invalid_key', got %s", key)
 		}
 	})
+
+	t.Run("reserved xml prefix", func(t *testing.T) {
+		tests := []struct {
+			key      string
+			expected string
+		}{
+			{"xmlns", "key"},
+			{"XMLHttpRequest", "key"},
+			{"xmling", "key"},
+			{"xml data", "key"},
+			{"xmlns:foo", "key"},
+			{"xml:lang", "xml:lang"},
+			{"myxml", "myxml"},
+			{"xm", "xm"},
+		}
+		for _, tt := range tests {
+			key, attrs := MakeValidXMLName(tt.key, nil)
+			if key != tt.expected {
+				t.Errorf("%q: expected %s, got %s", tt.key, tt.expected, key)
+			}
+			if key == "key" && attrs["name"] != tt.key {
+				t.Errorf("%q: expected original key in name attribute, got %v", tt.key, attrs)
+			}
+		}
+	})
+
+	t.Run("special characters stored unescaped and escaped once", func(t *testing.T) {
+		tests := []struct {
+			key  string
+			attr string
+		}{
+			{"R&D", `name="R&amp;D"`},
+			{"a<b", `name="a&lt;b"`},
+			{`say "hi"`, `name="say &quot;hi&quot;"`},
+			{"it's", `name="it&apos;s"`},
+		}
+		for _, tt := range tests {
+			key, attrs := MakeValidXMLName(tt.key, nil)
+			if key != "key" || attrs["name"] != tt.key {
+				t.Errorf("%q: expected <key> with raw name attribute, got %s %v", tt.key, key, attrs)
+			}
+			result := string(DictToXML(map[string]any{tt.key: 1}, DefaultOptions()))
+			if !strings.Contains(result, "<key "+tt.attr+` type="int">1</key>`) {
+				t.Errorf("%q: expected %s, got %s", tt.key, tt.attr, result)
+			}
+		}
+	})
 }
 
 func TestWrapCDATA(t *testing.T) {
@@ -194,6 +391,7 @@ func TestGetXPath31TagName(t *testing.T) {
 		{"dict", map[string]any{}, "map"},
 		{"int", 42, "number"},
 		{"float", 3.14, "number"},
+		{"json.Number", json.Number("10000000000"), "number"},
 		{"string", "hello", "string"},
 		{"list", []any{1, 2, 3}, "array"},
 	}
@@ -271,459 +469,3121 @@ func TestConvertToXPath31(t *testing.T) {
 			t.Errorf("expected array tags, got %s", result)
 		}
 	})
-}
-
-func TestIsPrimitiveType(t *testing.T) {
-	tests := []struct {
-		name     string
-		input    any
-		expected bool
-	}{
-		{"string", "abc", true},
-		{"int", 1, true},
-		{"float", 1.5, true},
-		{"bool", true, true},
-		{"nil", nil, true},
-		{"dict", map[string]any{}, false},
-		{"list", []any{}, false},
-	}
 
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			result := IsPrimitiveType(tt.input)
-			if result != tt.expected {
-				t.Errorf("expected %v, got %v", tt.expected, result)
+	t.Run("large and fractional numbers", func(t *testing.T) {
+		for _, decode := range []func(string) (any, error){ReadFromString, ReadFromStringUseNumber} {
+			data, err := decode(`{"big": 10000000000, "frac": 0.000001, "neg": -2.5}`)
+			if err != nil {
+				t.Fatal(err)
+			}
+			result := ConvertToXPath31(data, "")
+			expected := `<map><number key="big">10000000000</number><number key="frac">0.000001</number><number key="neg">-2.5</number></map>`
+			if result != expected {
+				t.Errorf("expected %s, got %s", expected, result)
 			}
-		})
-	}
-}
-
-func TestConvertKV(t *testing.T) {
-	t.Run("string value without attr type", func(t *testing.T) {
-		result := ConvertKV("key", "value", false, nil, false)
-		if result != "<key>value</key>" {
-			t.Errorf("expected '<key>value</key>', got %s", result)
 		}
 	})
 
-	t.Run("string value with attr type", func(t *testing.T) {
-		result := ConvertKV("key", "value", true, nil, false)
-		if !strings.Contains(result, `type="str"`) {
-			t.Errorf("expected type attribute, got %s", result)
+	t.Run("json.Number keeps its digits", func(t *testing.T) {
+		result := ConvertToXPath31(json.Number("12345678901234567890.12345"), "n")
+		expected := `<number key="n">12345678901234567890.12345</number>`
+		if result != expected {
+			t.Errorf("expected %s, got %s", expected, result)
 		}
 	})
+}
 
-	t.Run("int value with attr type", func(t *testing.T) {
-		result := ConvertKV("key", 123, true, nil, false)
-		if !strings.Contains(result, `type="int"`) {
-			t.Errorf("expected type='int', got %s", result)
+func TestXPathArrayItemKey(t *testing.T) {
+	data := map[string]any{"colors": []any{"red", "green"}, "name": "Bike"}
+
+	t.Run("enabled", func(t *testing.T) {
+		opts := DefaultOptions()
+		opts.XPathFormat = true
+		opts.XPathArrayItemKey = true
+		result := string(DictToXML(data, opts))
+		want := `<array key="colors"><string key="colors">red</string><string key="colors">green</string></array>`
+		if !strings.Contains(result, want) {
+			t.Errorf("expected %s, got %s", want, result)
+		}
+		if !strings.Contains(result, `<string key="name">Bike</string>`) {
+			t.Errorf("expected map entries unchanged, got %s", result)
 		}
 	})
 
-	t.Run("value with CDATA", func(t *testing.T) {
-		result := ConvertKV("key", "value", false, nil, true)
-		if !strings.Contains(result, "<![CDATA[value]]>") {
-			t.Errorf("expected CDATA wrapped value, got %s", result)
+	t.Run("disabled", func(t *testing.T) {
+		opts := DefaultOptions()
+		opts.XPathFormat = true
+		result := string(DictToXML(data, opts))
+		if !strings.Contains(result, `<array key="colors"><string>red</string>`) {
+			t.Errorf("expected anonymous array items, got %s", result)
 		}
 	})
 
-	t.Run("value with special characters", func(t *testing.T) {
-		result := ConvertKV("key", "<script>", false, nil, false)
-		if !strings.Contains(result, "&lt;script&gt;") {
-			t.Errorf("expected escaped value, got %s", result)
+	t.Run("top-level array stays anonymous", func(t *testing.T) {
+		opts := DefaultOptions()
+		opts.XPathFormat = true
+		opts.XPathArrayItemKey = true
+		result := string(DictToXML([]any{1}, opts))
+		if !strings.Contains(result, "<number>1</number>") {
+			t.Errorf("expected unkeyed item, got %s", result)
 		}
 	})
 }
 
-func TestConvertBool(t *testing.T) {
-	t.Run("true without attr type", func(t *testing.T) {
-		result := ConvertBool("key", true, false, nil, false)
-		if result != "<key>true</key>" {
-			t.Errorf("expected '<key>true</key>', got %s", result)
+func TestRawXMLKeys(t *testing.T) {
+	data := map[string]any{"body": "<b>bold</b>", "title": "<b>bold</b>"}
+
+	t.Run("listed key is not escaped", func(t *testing.T) {
+		opts := DefaultOptions()
+		opts.RawXMLKeys = map[string]bool{"body": true}
+		result := string(DictToXML(data, opts))
+		if !strings.Contains(result, "<body><b>bold</b></body>") {
+			t.Errorf("expected raw fragment, got %s", result)
+		}
+		if !strings.Contains(result, `<title type="str">&lt;b&gt;bold&lt;/b&gt;</title>`) {
+			t.Errorf("expected other keys escaped, got %s", result)
 		}
 	})
 
-	t.Run("false without attr type", func(t *testing.T) {
-		result := ConvertBool("key", false, false, nil, false)
-		if result != "<key>false</key>" {
-			t.Errorf("expected '<key>false</key>', got %s", result)
+	t.Run("non-string values convert normally", func(t *testing.T) {
+		opts := DefaultOptions()
+		opts.RawXMLKeys = map[string]bool{"body": true}
+		result := string(DictToXML(map[string]any{"body": 5}, opts))
+		if !strings.Contains(result, `<body type="int">5</body>`) {
+			t.Errorf("expected normal conversion, got %s", result)
 		}
 	})
 
-	t.Run("with attr type", func(t *testing.T) {
-		result := ConvertBool("key", true, true, nil, false)
-		if !strings.Contains(result, `type="bool"`) {
-			t.Errorf("expected type attribute, got %s", result)
+	t.Run("malformed fragment fails", func(t *testing.T) {
+		opts := DefaultOptions()
+		opts.RawXMLKeys = map[string]bool{"body": true}
+		for _, fragment := range []string{"<b>bold", "a & b", "</x><x>"} {
+			if _, err := DictToXMLErr(map[string]any{"body": fragment}, opts); !errors.Is(err, ErrInvalidData) {
+				t.Errorf("%q: expected ErrInvalidData, got %v", fragment, err)
+			}
+		}
+		if _, err := NewWithOptions(map[string]any{"body": "<b>bold"}, opts).ToXMLValidated(); !errors.Is(err, ErrInvalidData) {
+			t.Errorf("expected ErrInvalidData from the builder, got %v", err)
 		}
 	})
 
-	t.Run("with custom attributes", func(t *testing.T) {
-		result := ConvertBool("key", true, false, map[string]any{"id": "1"}, false)
-		if !strings.Contains(result, `id="1"`) {
-			t.Errorf("expected custom attribute, got %s", result)
+	t.Run("malformed fragment escaped with RepairOutput", func(t *testing.T) {
+		opts := DefaultOptions()
+		opts.RawXMLKeys = map[string]bool{"body": true}
+		opts.RepairOutput = true
+		result := string(DictToXML(map[string]any{"body": "<b>bold"}, opts))
+		if !strings.Contains(result, `<body type="str">&lt;b&gt;bold</body>`) {
+			t.Errorf("expected escaped fragment, got %s", result)
 		}
 	})
 }
 
-func TestConvertNone(t *testing.T) {
-	t.Run("without attr type", func(t *testing.T) {
-		result := ConvertNone("key", false, nil, false)
-		if result != "<key></key>" {
-			t.Errorf("expected '<key></key>', got %s", result)
+type testColor int
+
+const (
+	testRed testColor = iota
+	testGreen
+)
+
+func (c testColor) String() string {
+	return [...]string{"Red", "Green"}[c]
+}
+
+func TestEnumAsString(t *testing.T) {
+	data := map[string]any{"color": testRed, "palette": []any{testRed, testGreen}}
+
+	t.Run("enabled", func(t *testing.T) {
+		opts := DefaultOptions()
+		opts.EnumAsString = true
+		result := string(DictToXML(data, opts))
+		for _, want := range []string{
+			`<color type="str">Red</color>`,
+			`<item type="str">Red</item><item type="str">Green</item>`,
+		} {
+			if !strings.Contains(result, want) {
+				t.Errorf("expected %s in %s", want, result)
+			}
 		}
 	})
 
-	t.Run("with attr type", func(t *testing.T) {
-		result := ConvertNone("key", true, nil, false)
-		if !strings.Contains(result, `type="null"`) {
-			t.Errorf("expected type attribute, got %s", result)
+	t.Run("disabled", func(t *testing.T) {
+		result := string(DictToXML(data, DefaultOptions()))
+		if !strings.Contains(result, `<color type="int">0</color>`) {
+			t.Errorf("expected numeric value, got %s", result)
 		}
 	})
-}
 
-func TestDictToXML(t *testing.T) {
-	t.Run("simple dict with root", func(t *testing.T) {
-		data := map[string]any{"mock": "payload"}
+	t.Run("type handler takes precedence", func(t *testing.T) {
 		opts := DefaultOptions()
-		opts.AttrType = false
-		result := DictToXML(data, opts)
+		opts.EnumAsString = true
+		opts.TypeHandlers = map[reflect.Type]TypeHandler{
+			reflect.TypeOf(testRed): func(val any, opts Options) string { return "custom" },
+		}
+		result := string(DictToXML(map[string]any{"color": testGreen}, opts))
+		if !strings.Contains(result, `<color type="str">custom</color>`) {
+			t.Errorf("expected handler output, got %s", result)
+		}
+	})
 
-		expected := `<?xml version="1.0" encoding="UTF-8" ?><root><mock>payload</mock></root>`
-		if string(result) != expected {
-			t.Errorf("expected %s, got %s", expected, string(result))
+	t.Run("only integer stringers are enums", func(t *testing.T) {
+		type level int
+		if _, ok := enumName(level(1)); ok {
+			t.Error("expected integer without String to be ignored")
+		}
+		if _, ok := enumName(struct{ X int }{1}); ok {
+			t.Error("expected struct to be ignored")
 		}
 	})
+}
 
-	t.Run("simple dict without root", func(t *testing.T) {
-		data := map[string]any{"mock": "payload"}
-		opts := DefaultOptions()
-		opts.Root = false
-		opts.AttrType = false
-		result := DictToXML(data, opts)
+func TestRootElementCountAttr(t *testing.T) {
+	data := map[string]any{
+		"name":  "Bike",
+		"parts": []any{"wheel", "chain", map[string]any{"seat": "leather"}},
+		"owner": map[string]any{"first": "Ada", "last": nil},
+	}
 
-		expected := `<mock>payload</mock>`
-		if string(result) != expected {
-			t.Errorf("expected %s, got %s", expected, string(result))
+	opts := DefaultOptions()
+	opts.RootElementCountAttr = "count"
+	result := string(DictToXML(data, opts))
+
+	// name, parts (3 items, seat), owner (first, last)
+	if !strings.Contains(result, `<root count="9">`) {
+		t.Fatalf("expected count of 9 on root, got %s", result)
+	}
+
+	starts := 0
+	decoder := xml.NewDecoder(strings.NewReader(result))
+	for {
+		tok, err := decoder.Token()
+		if err != nil {
+			break
+		}
+		if _, ok := tok.(xml.StartElement); ok {
+			starts++
+		}
+	}
+	if starts-1 != 9 {
+		t.Errorf("count attribute does not match %d descendant elements", starts-1)
+	}
+
+	t.Run("unset", func(t *testing.T) {
+		result := string(DictToXML(data, DefaultOptions()))
+		if strings.Contains(result, "count=") {
+			t.Errorf("expected no count attribute, got %s", result)
 		}
 	})
+}
 
-	t.Run("with custom root", func(t *testing.T) {
-		data := map[string]any{"mock": "payload"}
-		opts := DefaultOptions()
-		opts.CustomRoot = "element"
-		opts.AttrType = false
-		result := DictToXML(data, opts)
+func TestFormatFloats(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    any
+		expected string
+	}{
+		{"large float64", 1000000.0, `<n type="float">1000000</n>`},
+		{"very large float64", 1.5e21, `<n type="float">1500000000000000000000</n>`},
+		{"small float64", 0.0000001, `<n type="float">0.0000001</n>`},
+		{"negative float64", -2.5e-8, `<n type="float">-0.000000025</n>`},
+		{"float32 keeps its precision", float32(0.1), `<n type="float">0.1</n>`},
+		{"large float32", float32(1e7), `<n type="float">10000000</n>`},
+		{"small float32", float32(1e-7), `<n type="float">0.0000001</n>`},
+	}
 
-		if !strings.Contains(string(result), "<element>") || !strings.Contains(string(result), "</element>") {
-			t.Errorf("expected custom root element, got %s", string(result))
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := ConvertKV("n", tt.input, true, nil, false)
+			if result != tt.expected {
+				t.Errorf("expected %s, got %s", tt.expected, result)
+			}
+		})
+	}
+
+	t.Run("list items", func(t *testing.T) {
+		result := string(DictToXML([]any{1e6}, DefaultOptions()))
+		if !strings.Contains(result, `<item type="float">1000000</item>`) {
+			t.Errorf("expected plain decimal, got %s", result)
 		}
 	})
+}
 
-	t.Run("with type attributes", func(t *testing.T) {
-		data := map[string]any{"bike": "blue"}
-		opts := DefaultOptions()
-		opts.Root = false
-		result := DictToXML(data, opts)
+func TestMaxTextLength(t *testing.T) {
+	opts := DefaultOptions()
+	opts.MaxTextLength = 4
 
-		if !strings.Contains(string(result), `type="str"`) {
-			t.Errorf("expected type attribute, got %s", string(result))
+	t.Run("splits long strings", func(t *testing.T) {
+		result := string(DictToXML(map[string]any{"text": "abcdefghij"}, opts))
+		want := `<text type="str"><chunk>abcd</chunk><chunk>efgh</chunk><chunk>ij</chunk></text>`
+		if !strings.Contains(result, want) {
+			t.Errorf("expected %s, got %s", want, result)
 		}
 	})
 
-	t.Run("item_wrap true", func(t *testing.T) {
-		data := map[string]any{"bike": []any{"blue", "green"}}
-		opts := DefaultOptions()
-		opts.Root = false
-		opts.AttrType = false
-		result := DictToXML(data, opts)
+	t.Run("short strings and other values unchanged", func(t *testing.T) {
+		result := string(DictToXML(map[string]any{"short": "abcd", "num": 123456789}, opts))
+		if !strings.Contains(result, `<short type="str">abcd</short>`) || !strings.Contains(result, `<num type="int">123456789</num>`) {
+			t.Errorf("unexpected output: %s", result)
+		}
+	})
 
-		expected := `<bike><item>blue</item><item>green</item></bike>`
-		if string(result) != expected {
-			t.Errorf("expected %s, got %s", expected, string(result))
+	t.Run("counts characters not bytes and escapes each chunk", func(t *testing.T) {
+		result := string(DictToXML([]any{"héllo<>"}, opts))
+		want := `<item type="str"><chunk>héll</chunk><chunk>o&lt;&gt;</chunk></item>`
+		if !strings.Contains(result, want) {
+			t.Errorf("expected %s, got %s", want, result)
 		}
 	})
 
-	t.Run("item_wrap false", func(t *testing.T) {
-		data := map[string]any{"bike": []any{"blue", "green"}}
+	t.Run("cdata chunks", func(t *testing.T) {
+		cdataOpts := opts
+		cdataOpts.CDATA = true
+		result := string(DictToXML(map[string]any{"text": "abcdef"}, cdataOpts))
+		if !strings.Contains(result, `<chunk><![CDATA[abcd]]></chunk><chunk><![CDATA[ef]]></chunk>`) {
+			t.Errorf("expected CDATA chunks, got %s", result)
+		}
+	})
+}
+
+func TestDistinguishNilSlice(t *testing.T) {
+	data := map[string]any{
+		"empty": []any{},
+		"nil":   []any(nil),
+		"typed": []string(nil),
+		"items": []any{[]int(nil), []int{}},
+	}
+
+	t.Run("enabled", func(t *testing.T) {
+		opts := DefaultOptions()
+		opts.DistinguishNilSlice = true
+		result := string(DictToXML(data, opts))
+		for _, want := range []string{
+			`<empty type="list"></empty>`,
+			`<nil type="null"></nil>`,
+			`<typed type="null"></typed>`,
+			`<items type="list"><item type="null"></item><item type="list"></item></items>`,
+		} {
+			if !strings.Contains(result, want) {
+				t.Errorf("expected %s in %s", want, result)
+			}
+		}
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		result := string(DictToXML(data, DefaultOptions()))
+		if !strings.Contains(result, `<nil type="list"></nil>`) {
+			t.Errorf("expected nil slice as empty list, got %s", result)
+		}
+	})
+}
+
+func TestFlattenSingleKeyChains(t *testing.T) {
+	opts := DefaultOptions()
+	opts.AttrType = false
+	opts.FlattenSingleKeyChains = true
+
+	tests := []struct {
+		name     string
+		input    map[string]any
+		expected string
+	}{
+		{"three levels", map[string]any{"a": map[string]any{"b": map[string]any{"c": 1}}}, "<a.b.c>1</a.b.c>"},
+		{"chain ends at wider map", map[string]any{"a": map[string]any{"b": map[string]any{"c": 1, "d": 2}}}, "<a.b><c>1</c><d>2</d></a.b>"},
+		{"chain ends at list", map[string]any{"a": map[string]any{"b": []any{1}}}, "<a.b><item>1</item></a.b>"},
+		{"special keys end chain", map[string]any{"a": map[string]any{"@val": "x"}}, "<a>x</a>"},
+		{"scalar unchanged", map[string]any{"a": 1}, "<a>1</a>"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := string(DictToXML(tt.input, opts))
+			if !strings.Contains(result, tt.expected) {
+				t.Errorf("expected %s, got %s", tt.expected, result)
+			}
+		})
+	}
+
+	t.Run("disabled", func(t *testing.T) {
+		plain := opts
+		plain.FlattenSingleKeyChains = false
+		result := string(DictToXML(map[string]any{"a": map[string]any{"b": 1}}, plain))
+		if !strings.Contains(result, "<a><b>1</b></a>") {
+			t.Errorf("expected nested output, got %s", result)
+		}
+	})
+}
+
+func TestTimeLayout(t *testing.T) {
+	zone := time.FixedZone("UTC+2", 2*60*60)
+	moment := time.Date(2024, 3, 1, 23, 30, 0, 0, zone)
+	data := map[string]any{"when": moment, "list": []any{moment}}
+
+	t.Run("default is RFC 3339", func(t *testing.T) {
+		result := string(DictToXML(data, DefaultOptions()))
+		if !strings.Contains(result, `<when type="str">2024-03-01T23:30:00+02:00</when>`) {
+			t.Errorf("expected RFC 3339 time, got %s", result)
+		}
+	})
+
+	t.Run("date only", func(t *testing.T) {
+		opts := DefaultOptions()
+		opts.TimeLayout = "2006-01-02"
+		result := string(DictToXML(data, opts))
+		for _, want := range []string{`<when type="str">2024-03-01</when>`, `<item type="str">2024-03-01</item>`} {
+			if !strings.Contains(result, want) {
+				t.Errorf("expected %s in %s", want, result)
+			}
+		}
+
+		opts.XPathFormat = true
+		if result := string(DictToXML(data, opts)); !strings.Contains(result, `<string key="when">2024-03-01</string>`) {
+			t.Errorf("expected date-only XPath string, got %s", result)
+		}
+	})
+
+	t.Run("zones are kept unless TimeFunc converts them", func(t *testing.T) {
+		opts := DefaultOptions()
+		opts.TimeLayout = time.DateTime
+		if result := string(DictToXML(data, opts)); !strings.Contains(result, ">2024-03-01 23:30:00<") {
+			t.Errorf("expected the local wall time, got %s", result)
+		}
+
+		opts.TimeFunc = func(t time.Time) string { return t.UTC().Format(time.RFC3339) }
+		if result := string(DictToXML(data, opts)); !strings.Contains(result, ">2024-03-01T21:30:00Z<") {
+			t.Errorf("expected the UTC time, got %s", result)
+		}
+	})
+
+	t.Run("TimeFunc renders epochs and timestamps", func(t *testing.T) {
+		opts := DefaultOptions()
+		opts.TimeFunc = func(t time.Time) string { return strconv.FormatInt(t.Unix(), 10) }
+		opts.TimestampAttr = "generated"
+		opts.Clock = func() time.Time { return moment }
+		result := string(DictToXML(data, opts))
+		for _, want := range []string{`<root generated="1709328600">`, `<when type="str">1709328600</when>`} {
+			if !strings.Contains(result, want) {
+				t.Errorf("expected %s in %s", want, result)
+			}
+		}
+	})
+
+	t.Run("attributes match element text", func(t *testing.T) {
+		opts := DefaultOptions()
+		opts.AttrType = false
+		opts.TimeLayout = "2006-01-02"
+		attrData := map[string]any{"event": map[string]any{"@attrs": map[string]any{"at": moment}, "@val": moment}}
+		if result := string(DictToXML(attrData, opts)); !strings.Contains(result, `<event at="2024-03-01">2024-03-01</event>`) {
+			t.Errorf("expected the layout in the attribute, got %s", result)
+		}
+
+		opts.TimeFunc = func(t time.Time) string { return t.UTC().Format(time.RFC3339) }
+		if result := string(DictToXML(attrData, opts)); !strings.Contains(result, `<event at="2024-03-01T21:30:00Z">2024-03-01T21:30:00Z</event>`) {
+			t.Errorf("expected TimeFunc in the attribute, got %s", result)
+		}
+
+		opts.TimeFunc = nil
+		opts.AttrPrefix = "-"
+		prefixed := map[string]any{"event": map[string]any{"-at": moment, "name": "x"}}
+		if result := string(DictToXML(prefixed, opts)); !strings.Contains(result, `<event at="2024-03-01">`) {
+			t.Errorf("expected the layout in a prefixed attribute, got %s", result)
+		}
+	})
+}
+
+func TestDetectDates(t *testing.T) {
+	data := map[string]any{
+		"utc":     "2024-03-01T12:30:00Z",
+		"offset":  "2024-03-01T12:30:00.5+05:30",
+		"day":     "2024-03-01",
+		"compact": "20240301",
+		"month":   "2024-03",
+		"badDay":  "2024-02-30",
+		"text":    "2024-03-01 or later",
+		"number":  "1709296200",
+	}
+	opts := DefaultOptions()
+	opts.DetectDates = true
+	result := string(DictToXML(data, opts))
+
+	for _, want := range []string{
+		`<utc type="dateTime">2024-03-01T12:30:00Z</utc>`,
+		`<offset type="dateTime">2024-03-01T12:30:00.5+05:30</offset>`,
+		`<day type="date">2024-03-01</day>`,
+		`<compact type="str">20240301</compact>`,
+		`<month type="str">2024-03</month>`,
+		`<badDay type="str">2024-02-30</badDay>`,
+		`<text type="str">2024-03-01 or later</text>`,
+		`<number type="str">1709296200</number>`,
+	} {
+		if !strings.Contains(result, want) {
+			t.Errorf("expected %s in %s", want, result)
+		}
+	}
+
+	t.Run("off by default", func(t *testing.T) {
+		if result := string(DictToXML(data, DefaultOptions())); strings.Contains(result, `type="date`) {
+			t.Errorf("expected no date types, got %s", result)
+		}
+	})
+
+	t.Run("schema types", func(t *testing.T) {
+		xsdOpts := opts
+		xsdOpts.AttrType = false
+		xsd, err := GenerateXSD(map[string]any{"utc": data["utc"], "day": data["day"]}, xsdOpts)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		for _, want := range []string{`<xs:element name="utc" type="xs:dateTime"/>`, `<xs:element name="day" type="xs:date"/>`} {
+			if !strings.Contains(string(xsd), want) {
+				t.Errorf("expected %s in %s", want, xsd)
+			}
+		}
+	})
+}
+
+func TestTimestampAttr(t *testing.T) {
+	fixed := time.Date(2024, 3, 1, 12, 30, 0, 0, time.UTC)
+	opts := DefaultOptions()
+	opts.TimestampAttr = "generated"
+	opts.Clock = func() time.Time { return fixed }
+
+	result := string(DictToXML(map[string]any{"a": 1}, opts))
+	if !strings.Contains(result, `<root generated="2024-03-01T12:30:00Z">`) {
+		t.Errorf("expected timestamp on root, got %s", result)
+	}
+
+	t.Run("streamed", func(t *testing.T) {
+		var buf bytes.Buffer
+		if err := WriteXML(&buf, map[string]any{"a": 1}, opts); err != nil {
+			t.Fatalf("WriteXML returned error: %v", err)
+		}
+		if buf.String() != result {
+			t.Errorf("expected %s, got %s", result, buf.String())
+		}
+	})
+
+	t.Run("default clock", func(t *testing.T) {
+		opts := DefaultOptions()
+		opts.TimestampAttr = "generated"
+		result := string(DictToXML(map[string]any{"a": 1}, opts))
+		_, rest, _ := strings.Cut(result, `generated="`)
+		stamp, _, _ := strings.Cut(rest, `"`)
+		if _, err := time.Parse(time.RFC3339, stamp); err != nil {
+			t.Errorf("expected RFC 3339 timestamp, got %s", result)
+		}
+	})
+
+	t.Run("ignored without root", func(t *testing.T) {
+		noRoot := opts
+		noRoot.Root = false
+		if result := string(DictToXML(map[string]any{"a": 1}, noRoot)); strings.Contains(result, "generated") {
+			t.Errorf("expected no timestamp, got %s", result)
+		}
+	})
+}
+
+func TestNameValidator(t *testing.T) {
+	noColons := func(name string) bool {
+		return KeyIsValidXML(name) && !strings.Contains(name, ":")
+	}
+	data := map[string]any{"ns:key": "value", "plain": "ok"}
+
+	t.Run("custom validator rejects colons", func(t *testing.T) {
+		opts := DefaultOptions()
+		opts.NameValidator = noColons
+		result := string(DictToXML(data, opts))
+		if !strings.Contains(result, `<key name="ns:key" type="str">value</key>`) {
+			t.Errorf("expected ns:key to be sanitized, got %s", result)
+		}
+		if !strings.Contains(result, `<plain type="str">ok</plain>`) {
+			t.Errorf("expected plain key kept, got %s", result)
+		}
+	})
+
+	t.Run("default validator accepts colons", func(t *testing.T) {
+		result := string(DictToXML(data, DefaultOptions()))
+		if !strings.Contains(result, `<ns:key type="str">value</ns:key>`) {
+			t.Errorf("expected ns:key kept, got %s", result)
+		}
+	})
+
+	t.Run("list items and spaces", func(t *testing.T) {
+		opts := DefaultOptions()
+		opts.NameValidator = noColons
+		result := string(DictToXML(map[string]any{"a b": []any{1}, "1": 2}, opts))
+		for _, want := range []string{`<a_b type="list">`, `<n1 type="int">2</n1>`} {
+			if !strings.Contains(result, want) {
+				t.Errorf("expected %s in %s", want, result)
+			}
+		}
+	})
+}
+
+func TestXSDListPrimitives(t *testing.T) {
+	opts := DefaultOptions()
+	opts.XSDListPrimitives = true
+
+	tests := []struct {
+		name     string
+		input    map[string]any
+		expected string
+	}{
+		{"numbers", map[string]any{"dims": []any{1, 2, 3}}, `<dims type="list">1 2 3</dims>`},
+		{"mixed scalars", map[string]any{"v": []any{"a", true, 2.5}}, `<v type="list">a true 2.5</v>`},
+		{"escaped", map[string]any{"v": []any{"a<b", "c"}}, `<v type="list">a&lt;b c</v>`},
+		{"whitespace falls back", map[string]any{"v": []any{"a b"}}, `<v type="list"><item type="str">a b</item></v>`},
+		{"null falls back", map[string]any{"v": []any{1, nil}}, `<v type="list"><item type="int">1</item><item type="null"></item></v>`},
+		{"nested falls back", map[string]any{"v": []any{[]any{1}}}, `<v type="list"><item type="list">`},
+		{"empty list unchanged", map[string]any{"v": []any{}}, `<v type="list"></v>`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := string(DictToXML(tt.input, opts))
+			if !strings.Contains(result, tt.expected) {
+				t.Errorf("expected %s, got %s", tt.expected, result)
+			}
+		})
+	}
+}
+
+func TestSelfCloseEmpty(t *testing.T) {
+	data := map[string]any{"none": nil, "blank": "", "text": "x", "list": []any{nil, ""}, "bad key": nil}
+
+	t.Run("enabled", func(t *testing.T) {
+		opts := DefaultOptions()
+		opts.SelfCloseEmpty = true
+		opts.IDs = true
+		opts.IDSource = rand.New(rand.NewSource(1))
+		result := string(DictToXML(data, opts))
+		for _, want := range []string{
+			`<none id="root_`, `" type="null"/>`,
+			`<blank id="root_`, `" type="str"/>`,
+			`<text id="root_`, `" type="str">x</text>`,
+			`<item type="null"/><item type="str"/>`, `<bad_key id="root_`,
+		} {
+			if !strings.Contains(result, want) {
+				t.Errorf("expected %s in %s", want, result)
+			}
+		}
+		if strings.Contains(result, "></none>") || strings.Contains(result, "></blank>") {
+			t.Errorf("expected no paired empty tags, got %s", result)
+		}
+		if err := checkWellFormed([]byte(result)); err != nil {
+			t.Errorf("expected well-formed output, got %v", err)
+		}
+	})
+
+	t.Run("name attribute and cdata", func(t *testing.T) {
+		opts := DefaultOptions()
+		opts.SelfCloseEmpty = true
+		opts.CDATA = true
+		result := string(DictToXML(map[string]any{"a&b": nil, "c": ""}, opts))
+		for _, want := range []string{`<key name="a&amp;b" type="null"/>`, `<c type="str"/>`} {
+			if !strings.Contains(result, want) {
+				t.Errorf("expected %s in %s", want, result)
+			}
+		}
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		result := string(DictToXML(data, DefaultOptions()))
+		if !strings.Contains(result, `<none type="null"></none>`) || !strings.Contains(result, `<blank type="str"></blank>`) {
+			t.Errorf("expected paired tags, got %s", result)
+		}
+	})
+}
+
+func TestAttrPrefix(t *testing.T) {
+	opts := DefaultOptions()
+	opts.AttrType = false
+	opts.AttrPrefix = "@"
+
+	tests := []struct {
+		name     string
+		input    map[string]any
+		expected string
+	}{
+		{"with @val", map[string]any{"node": map[string]any{"@id": "1", "@val": "text"}}, `<node id="1">text</node>`},
+		{"with children", map[string]any{"node": map[string]any{"@id": 2, "@ok": true, "name": "x"}}, `<node id="2" ok="true"><name>x</name></node>`},
+		{"added to @attrs", map[string]any{"node": map[string]any{"@attrs": map[string]any{"a": "1"}, "@b": "2", "@val": "v"}}, `<node a="1" b="2">v</node>`},
+		{"list items", map[string]any{"rows": []any{map[string]any{"@n": 1, "v": "a"}}}, `<rows><item n="1"><v>a</v></item></rows>`},
+		{"null becomes empty", map[string]any{"node": map[string]any{"@x": nil, "@val": "v"}}, `<node x="">v</node>`},
+		{"non-scalar stays a child", map[string]any{"node": map[string]any{"@list": []any{1}}}, `<node><key name="@list">`},
+		{"escaped", map[string]any{"node": map[string]any{"@q": `a"b`, "@val": "v"}}, `<node q="a&quot;b">v</node>`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := string(DictToXML(tt.input, opts))
+			if !strings.Contains(result, tt.expected) {
+				t.Errorf("expected %s, got %s", tt.expected, result)
+			}
+		})
+	}
+
+	t.Run("custom prefix", func(t *testing.T) {
+		custom := opts
+		custom.AttrPrefix = "-"
+		result := string(DictToXML(map[string]any{"node": map[string]any{"-id": "1", "@val": "text"}}, custom))
+		if !strings.Contains(result, `<node id="1">text</node>`) {
+			t.Errorf("unexpected output: %s", result)
+		}
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		plain := opts
+		plain.AttrPrefix = ""
+		result := string(DictToXML(map[string]any{"node": map[string]any{"@id": "1", "@val": "text"}}, plain))
+		if !strings.Contains(result, `<node>text</node>`) {
+			t.Errorf("expected prefixed keys ignored alongside @val, got %s", result)
+		}
+	})
+}
+
+func TestIsPrimitiveType(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    any
+		expected bool
+	}{
+		{"string", "abc", true},
+		{"int", 1, true},
+		{"float", 1.5, true},
+		{"bool", true, true},
+		{"nil", nil, true},
+		{"dict", map[string]any{}, false},
+		{"list", []any{}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := IsPrimitiveType(tt.input)
+			if result != tt.expected {
+				t.Errorf("expected %v, got %v", tt.expected, result)
+			}
+		})
+	}
+}
+
+func TestConvertKV(t *testing.T) {
+	t.Run("string value without attr type", func(t *testing.T) {
+		result := ConvertKV("key", "value", false, nil, false)
+		if result != "<key>value</key>" {
+			t.Errorf("expected '<key>value</key>', got %s", result)
+		}
+	})
+
+	t.Run("string value with attr type", func(t *testing.T) {
+		result := ConvertKV("key", "value", true, nil, false)
+		if !strings.Contains(result, `type="str"`) {
+			t.Errorf("expected type attribute, got %s", result)
+		}
+	})
+
+	t.Run("int value with attr type", func(t *testing.T) {
+		result := ConvertKV("key", 123, true, nil, false)
+		if !strings.Contains(result, `type="int"`) {
+			t.Errorf("expected type='int', got %s", result)
+		}
+	})
+
+	t.Run("value with CDATA", func(t *testing.T) {
+		result := ConvertKV("key", "value", false, nil, true)
+		if !strings.Contains(result, "<![CDATA[value]]>") {
+			t.Errorf("expected CDATA wrapped value, got %s", result)
+		}
+	})
+
+	t.Run("value with special characters", func(t *testing.T) {
+		result := ConvertKV("key", "<script>", false, nil, false)
+		if !strings.Contains(result, "&lt;script&gt;") {
+			t.Errorf("expected escaped value, got %s", result)
+		}
+	})
+
+	t.Run("numeric string keeps leading zeros and str type", func(t *testing.T) {
+		result := ConvertKV("code", "007", true, nil, false)
+		if result != `<code type="str">007</code>` {
+			t.Errorf("expected numeric string to stay a str, got %s", result)
+		}
+
+		data, err := ReadFromString(`{"code": "007"}`)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		xml := DictToXML(data, DefaultOptions())
+		if !bytes.Contains(xml, []byte(`<code type="str">007</code>`)) {
+			t.Errorf("expected numeric string to stay a str, got %s", xml)
+		}
+	})
+}
+
+func TestConvertBool(t *testing.T) {
+	t.Run("true without attr type", func(t *testing.T) {
+		result := ConvertBool("key", true, false, nil, false)
+		if result != "<key>true</key>" {
+			t.Errorf("expected '<key>true</key>', got %s", result)
+		}
+	})
+
+	t.Run("false without attr type", func(t *testing.T) {
+		result := ConvertBool("key", false, false, nil, false)
+		if result != "<key>false</key>" {
+			t.Errorf("expected '<key>false</key>', got %s", result)
+		}
+	})
+
+	t.Run("with attr type", func(t *testing.T) {
+		result := ConvertBool("key", true, true, nil, false)
+		if !strings.Contains(result, `type="bool"`) {
+			t.Errorf("expected type attribute, got %s", result)
+		}
+	})
+
+	t.Run("with custom attributes", func(t *testing.T) {
+		result := ConvertBool("key", true, false, map[string]any{"id": "1"}, false)
+		if !strings.Contains(result, `id="1"`) {
+			t.Errorf("expected custom attribute, got %s", result)
+		}
+	})
+}
+
+func TestConvertNone(t *testing.T) {
+	t.Run("without attr type", func(t *testing.T) {
+		result := ConvertNone("key", false, nil, false)
+		if result != "<key></key>" {
+			t.Errorf("expected '<key></key>', got %s", result)
+		}
+	})
+
+	t.Run("with attr type", func(t *testing.T) {
+		result := ConvertNone("key", true, nil, false)
+		if !strings.Contains(result, `type="null"`) {
+			t.Errorf("expected type attribute, got %s", result)
+		}
+	})
+}
+
+func TestDictToXML(t *testing.T) {
+	t.Run("simple dict with root", func(t *testing.T) {
+		data := map[string]any{"mock": "payload"}
+		opts := DefaultOptions()
+		opts.AttrType = false
+		result := DictToXML(data, opts)
+
+		expected := `<?xml version="1.0" encoding="UTF-8" ?><root><mock>payload</mock></root>`
+		if string(result) != expected {
+			t.Errorf("expected %s, got %s", expected, string(result))
+		}
+	})
+
+	t.Run("simple dict without root", func(t *testing.T) {
+		data := map[string]any{"mock": "payload"}
+		opts := DefaultOptions()
+		opts.Root = false
+		opts.AttrType = false
+		result := DictToXML(data, opts)
+
+		expected := `<mock>payload</mock>`
+		if string(result) != expected {
+			t.Errorf("expected %s, got %s", expected, string(result))
+		}
+	})
+
+	t.Run("with custom root", func(t *testing.T) {
+		data := map[string]any{"mock": "payload"}
+		opts := DefaultOptions()
+		opts.CustomRoot = "element"
+		opts.AttrType = false
+		result := DictToXML(data, opts)
+
+		if !strings.Contains(string(result), "<element>") || !strings.Contains(string(result), "</element>") {
+			t.Errorf("expected custom root element, got %s", string(result))
+		}
+	})
+
+	t.Run("with type attributes", func(t *testing.T) {
+		data := map[string]any{"bike": "blue"}
+		opts := DefaultOptions()
+		opts.Root = false
+		result := DictToXML(data, opts)
+
+		if !strings.Contains(string(result), `type="str"`) {
+			t.Errorf("expected type attribute, got %s", string(result))
+		}
+	})
+
+	t.Run("item_wrap true", func(t *testing.T) {
+		data := map[string]any{"bike": []any{"blue", "green"}}
+		opts := DefaultOptions()
+		opts.Root = false
+		opts.AttrType = false
+		result := DictToXML(data, opts)
+
+		expected := `<bike><item>blue</item><item>green</item></bike>`
+		if string(result) != expected {
+			t.Errorf("expected %s, got %s", expected, string(result))
+		}
+	})
+
+	t.Run("item_wrap false", func(t *testing.T) {
+		data := map[string]any{"bike": []any{"blue", "green"}}
+		opts := DefaultOptions()
+		opts.Root = false
+		opts.AttrType = false
+		opts.ItemWrap = false
+		result := DictToXML(data, opts)
+
+		expected := `<bike>blue</bike><bike>green</bike>`
+		if string(result) != expected {
+			t.Errorf("expected %s, got %s", expected, string(result))
+		}
+	})
+
+	t.Run("with namespaces", func(t *testing.T) {
+		data := map[string]any{"ns1:node1": "data in namespace 1"}
+		opts := DefaultOptions()
+		opts.AttrType = false
+		opts.XMLNamespaces = map[string]any{
+			"ns1": "https://www.google.de/ns1",
+		}
+		result := DictToXML(data, opts)
+
+		if !strings.Contains(string(result), `xmlns:ns1="https://www.google.de/ns1"`) {
+			t.Errorf("expected namespace declaration, got %s", string(result))
+		}
+	})
+
+	t.Run("with xmlns namespace", func(t *testing.T) {
+		data := map[string]any{"key": "value"}
+		opts := DefaultOptions()
+		opts.AttrType = false
+		opts.XMLNamespaces = map[string]any{
+			"xmlns": "http://example.com",
+		}
+		result := DictToXML(data, opts)
+
+		if !strings.Contains(string(result), `xmlns="http://example.com"`) {
+			t.Errorf("expected xmlns declaration, got %s", string(result))
+		}
+	})
+
+	t.Run("boolean values", func(t *testing.T) {
+		data := map[string]any{"flag": true}
+		opts := DefaultOptions()
+		opts.Root = false
+		opts.AttrType = false
+		result := DictToXML(data, opts)
+
+		if string(result) != "<flag>true</flag>" {
+			t.Errorf("expected '<flag>true</flag>', got %s", string(result))
+		}
+	})
+
+	t.Run("null values", func(t *testing.T) {
+		data := map[string]any{"empty": nil}
+		opts := DefaultOptions()
+		opts.Root = false
+		opts.AttrType = false
+		result := DictToXML(data, opts)
+
+		if string(result) != "<empty></empty>" {
+			t.Errorf("expected '<empty></empty>', got %s", string(result))
+		}
+	})
+
+	t.Run("nested dict", func(t *testing.T) {
+		data := map[string]any{
+			"person": map[string]any{
+				"name": "John",
+				"age":  30,
+			},
+		}
+		opts := DefaultOptions()
+		opts.Root = false
+		opts.AttrType = false
+		result := DictToXML(data, opts)
+
+		if !strings.Contains(string(result), "<person>") || !strings.Contains(string(result), "<name>John</name>") {
+			t.Errorf("expected nested structure, got %s", string(result))
+		}
+	})
+
+	t.Run("ampersand in value", func(t *testing.T) {
+		data := map[string]any{"Bicycles": "Wheels & Steers"}
+		opts := DefaultOptions()
+		opts.Root = false
+		opts.AttrType = false
+		result := DictToXML(data, opts)
+
+		expected := "<Bicycles>Wheels &amp; Steers</Bicycles>"
+		if string(result) != expected {
+			t.Errorf("expected %s, got %s", expected, string(result))
+		}
+	})
+
+	t.Run("datetime conversion", func(t *testing.T) {
+		dt := time.Date(2023, 2, 15, 12, 30, 45, 0, time.UTC)
+		data := map[string]any{"key": dt}
+		opts := DefaultOptions()
+		opts.AttrType = false
+		result := DictToXML(data, opts)
+
+		if !strings.Contains(string(result), "2023-02-15") {
+			t.Errorf("expected datetime in ISO format, got %s", string(result))
+		}
+	})
+
+	t.Run("list with dict items", func(t *testing.T) {
+		data := map[string]any{
+			"items": []any{
+				map[string]any{"key1": "value1"},
+				map[string]any{"key2": "value2"},
+			},
+		}
+		opts := DefaultOptions()
+		opts.Root = false
+		opts.AttrType = false
+		result := DictToXML(data, opts)
+
+		if !strings.Contains(string(result), "<item><key1>value1</key1></item>") {
+			t.Errorf("expected item wrapped dicts, got %s", string(result))
+		}
+	})
+
+	t.Run("CDATA wrapping", func(t *testing.T) {
+		data := map[string]any{"key": "value"}
+		opts := DefaultOptions()
+		opts.Root = false
+		opts.AttrType = false
+		opts.CDATA = true
+		result := DictToXML(data, opts)
+
+		if !strings.Contains(string(result), "<![CDATA[value]]>") {
+			t.Errorf("expected CDATA wrapped value, got %s", string(result))
+		}
+	})
+}
+
+func TestDictToXMLXPathFormat(t *testing.T) {
+	t.Run("basic types", func(t *testing.T) {
+		data := map[string]any{"name": "John", "age": 30, "active": true}
+		opts := DefaultOptions()
+		opts.XPathFormat = true
+		result := DictToXML(data, opts)
+
+		if !bytes.Contains(result, []byte(`xmlns="http://www.w3.org/2005/xpath-functions"`)) {
+			t.Errorf("expected XPath namespace, got %s", string(result))
+		}
+		if !bytes.Contains(result, []byte(`<string key="name">John</string>`)) {
+			t.Errorf("expected string element, got %s", string(result))
+		}
+		if !bytes.Contains(result, []byte(`<number key="age">30</number>`)) {
+			t.Errorf("expected number element, got %s", string(result))
+		}
+		if !bytes.Contains(result, []byte(`<boolean key="active">true</boolean>`)) {
+			t.Errorf("expected boolean element, got %s", string(result))
+		}
+	})
+
+	t.Run("nested dict", func(t *testing.T) {
+		data := map[string]any{
+			"person": map[string]any{"name": "Alice", "age": 25},
+		}
+		opts := DefaultOptions()
+		opts.XPathFormat = true
+		result := DictToXML(data, opts)
+
+		if !bytes.Contains(result, []byte(`<map key="person">`)) {
+			t.Errorf("expected nested map, got %s", string(result))
+		}
+	})
+
+	t.Run("array", func(t *testing.T) {
+		data := map[string]any{"numbers": []any{1, 2, 3}}
+		opts := DefaultOptions()
+		opts.XPathFormat = true
+		result := DictToXML(data, opts)
+
+		if !bytes.Contains(result, []byte(`<array key="numbers">`)) {
+			t.Errorf("expected array element, got %s", string(result))
+		}
+	})
+
+	t.Run("null value", func(t *testing.T) {
+		data := map[string]any{"value": nil}
+		opts := DefaultOptions()
+		opts.XPathFormat = true
+		result := DictToXML(data, opts)
+
+		if !bytes.Contains(result, []byte(`<null key="value"/>`)) {
+			t.Errorf("expected null element, got %s", string(result))
+		}
+	})
+
+	t.Run("root level array", func(t *testing.T) {
+		data := []any{1, 2, 3}
+		opts := DefaultOptions()
+		opts.XPathFormat = true
+		result := DictToXML(data, opts)
+
+		if !bytes.Contains(result, []byte(`<array xmlns="http://www.w3.org/2005/xpath-functions">`)) {
+			t.Errorf("expected array with namespace, got %s", string(result))
+		}
+	})
+}
+
+func TestListHeaders(t *testing.T) {
+	t.Run("list headers true", func(t *testing.T) {
+		data := map[string]any{
+			"Bike": []any{
+				map[string]any{"frame_color": "red"},
+				map[string]any{"frame_color": "green"},
+			},
+		}
+		opts := DefaultOptions()
+		opts.Root = false
+		opts.AttrType = false
+		opts.ItemWrap = false
+		opts.ListHeaders = true
+		result := DictToXML(data, opts)
+
+		expected := "<Bike><frame_color>red</frame_color></Bike><Bike><frame_color>green</frame_color></Bike>"
+		if string(result) != expected {
+			t.Errorf("expected %s, got %s", expected, string(result))
+		}
+	})
+}
+
+func TestFlatList(t *testing.T) {
+	t.Run("flat list notation", func(t *testing.T) {
+		data := map[string]any{
+			"flat_list@flat": []any{1, 2, 3},
+			"non_flat_list":  []any{4, 5, 6},
+		}
+		opts := DefaultOptions()
+		opts.AttrType = false
+		result := DictToXML(data, opts)
+
+		// flat_list should not be wrapped
+		if !strings.Contains(string(result), "<item>1</item><item>2</item><item>3</item>") {
+			t.Errorf("expected flat list items, got %s", string(result))
+		}
+		// non_flat_list should be wrapped
+		if !strings.Contains(string(result), "<non_flat_list><item>4</item><item>5</item><item>6</item></non_flat_list>") {
+			t.Errorf("expected wrapped list, got %s", string(result))
+		}
+	})
+}
+
+func TestCustomItemFunc(t *testing.T) {
+	t.Run("custom item function", func(t *testing.T) {
+		data := map[string]any{"items": []any{1, 2, 3}}
+		opts := DefaultOptions()
+		opts.Root = false
+		opts.AttrType = false
+		opts.ItemFunc = func(parent string) string {
+			return "custom"
+		}
+		result := DictToXML(data, opts)
+
+		if !strings.Contains(string(result), "<custom>") {
+			t.Errorf("expected custom item names, got %s", string(result))
+		}
+	})
+}
+
+func TestMapAsEntries(t *testing.T) {
+	t.Run("scalar values become entry attributes", func(t *testing.T) {
+		data := map[string]any{"a": 1, "b": 2, "not a valid<name>": "x"}
+		opts := DefaultOptions()
+		opts.Root = false
+		opts.AttrType = false
+		opts.MapAsEntries = true
+		result := DictToXML(data, opts)
+
+		expected := `<entry key="a" value="1"/><entry key="b" value="2"/><entry key="not a valid&lt;name&gt;" value="x"/>`
+		if string(result) != expected {
+			t.Errorf("expected %s, got %s", expected, string(result))
+		}
+	})
+
+	t.Run("nested values become entry children", func(t *testing.T) {
+		data := map[string]any{"1st": map[string]any{"k": nil}, "list": []any{true}}
+		opts := DefaultOptions()
+		opts.Root = false
+		opts.MapAsEntries = true
+		result := DictToXML(data, opts)
+
+		expected := `<entry key="1st" type="dict"><entry key="k" type="null"/></entry>` +
+			`<entry key="list" type="list"><item type="bool">true</item></entry>`
+		if string(result) != expected {
+			t.Errorf("expected %s, got %s", expected, string(result))
+		}
+	})
+}
+
+type testMoney struct {
+	Cents    int64
+	Currency string
+}
+
+func TestTypeHandlers(t *testing.T) {
+	opts := DefaultOptions()
+	opts.Root = false
+	opts.TypeHandlers = map[reflect.Type]TypeHandler{
+		reflect.TypeOf(testMoney{}): func(val any, opts Options) string {
+			m := val.(testMoney)
+			return fmt.Sprintf("%d.%02d %s", m.Cents/100, m.Cents%100, m.Currency)
+		},
+	}
+
+	t.Run("handler renders dict values", func(t *testing.T) {
+		data := map[string]any{"price": testMoney{Cents: 1999, Currency: "EUR"}}
+		result := DictToXML(data, opts)
+
+		expected := `<price type="str">19.99 EUR</price>`
+		if string(result) != expected {
+			t.Errorf("expected %s, got %s", expected, string(result))
+		}
+	})
+
+	t.Run("handler renders list items", func(t *testing.T) {
+		data := map[string]any{"prices": []any{testMoney{Cents: 500, Currency: "USD"}}}
+		result := DictToXML(data, opts)
+
+		expected := `<prices type="list"><item type="str">5.00 USD</item></prices>`
+		if string(result) != expected {
+			t.Errorf("expected %s, got %s", expected, string(result))
+		}
+	})
+
+	t.Run("unregistered types use default conversion", func(t *testing.T) {
+		result := DictToXML(map[string]any{"count": 3}, opts)
+		if string(result) != `<count type="int">3</count>` {
+			t.Errorf("unexpected output: %s", string(result))
+		}
+	})
+}
+
+func TestArrayAsIndexedObject(t *testing.T) {
+	t.Run("default prefix", func(t *testing.T) {
+		data := map[string]any{"a": []any{10, 20}}
+		opts := DefaultOptions()
+		opts.Root = false
+		opts.AttrType = false
+		opts.ItemWrap = false
+		opts.ArrayAsIndexedObject = true
+		result := DictToXML(data, opts)
+
+		expected := "<a><_0>10</_0><_1>20</_1></a>"
+		if string(result) != expected {
+			t.Errorf("expected %s, got %s", expected, string(result))
+		}
+	})
+
+	t.Run("custom prefix with nested maps", func(t *testing.T) {
+		data := map[string]any{"a": []any{map[string]any{"b": 1}}}
+		opts := DefaultOptions()
+		opts.Root = false
+		opts.ArrayAsIndexedObject = true
+		opts.IndexPrefix = "idx"
+		result := DictToXML(data, opts)
+
+		expected := `<a type="list"><idx0 type="dict"><b type="int">1</b></idx0></a>`
+		if string(result) != expected {
+			t.Errorf("expected %s, got %s", expected, string(result))
+		}
+	})
+}
+
+func TestCustomTypeAttr(t *testing.T) {
+	type Point struct{ X, Y int }
+	opts := DefaultOptions()
+	opts.Root = false
+	opts.AttrType = false
+	opts.CustomTypeAttr = "gotype"
+
+	t.Run("struct values carry their type name", func(t *testing.T) {
+		result := DictToXML(map[string]any{"origin": Point{1, 2}}, opts)
+
+		expected := `<origin gotype="Point"><X>1</X><Y>2</Y></origin>`
+		if string(result) != expected {
+			t.Errorf("expected %s, got %s", expected, string(result))
+		}
+	})
+
+	t.Run("list items and pointers", func(t *testing.T) {
+		result := DictToXML(map[string]any{"points": []any{&Point{3, 4}}}, opts)
+
+		if !strings.Contains(string(result), `<item gotype="*json2xml.Point">`) {
+			t.Errorf("expected pointer type name, got %s", string(result))
+		}
+	})
+
+	t.Run("native values are untouched", func(t *testing.T) {
+		result := DictToXML(map[string]any{"n": 1, "s": "x", "t": time.Unix(0, 0).UTC()}, opts)
+
+		if strings.Contains(string(result), "gotype") {
+			t.Errorf("unexpected type attribute: %s", string(result))
+		}
+	})
+}
+
+func TestOnElement(t *testing.T) {
+	t.Run("counts elements and depth", func(t *testing.T) {
+		data := map[string]any{"a": 1, "b": map[string]any{"c": []any{1, 2}}}
+		count, maxDepth := 0, 0
+		opts := DefaultOptions()
+		opts.OnElement = func(name string, depth int) {
+			count++
+			maxDepth = max(maxDepth, depth)
+		}
+		DictToXML(data, opts)
+
+		// root, a, b, c, item, item
+		if count != 6 {
+			t.Errorf("expected 6 elements, got %d", count)
+		}
+		if maxDepth != 3 {
+			t.Errorf("expected max depth 3, got %d", maxDepth)
+		}
+	})
+
+	t.Run("matches emitted elements across list shapes", func(t *testing.T) {
+		data := map[string]any{
+			"bikes":      []any{map[string]any{"color": "red"}, map[string]any{"color": "blue"}},
+			"sizes":      []any{1, 2, []any{3}},
+			"flat@flat":  []any{"x", "y"},
+			"properties": map[string]any{"@attrs": map[string]any{"id": 1}, "@val": "v"},
+		}
+		for _, itemWrap := range []bool{true, false} {
+			for _, listHeaders := range []bool{true, false} {
+				count := 0
+				opts := DefaultOptions()
+				opts.ItemWrap = itemWrap
+				opts.ListHeaders = listHeaders
+				opts.OnElement = func(string, int) { count++ }
+				result := DictToXML(data, opts)
+
+				emitted := 0
+				decoder := xml.NewDecoder(bytes.NewReader(result))
+				for {
+					tok, err := decoder.Token()
+					if err != nil {
+						break
+					}
+					if _, ok := tok.(xml.StartElement); ok {
+						emitted++
+					}
+				}
+				if count != emitted {
+					t.Errorf("itemWrap=%v listHeaders=%v: callback saw %d elements, output has %d: %s",
+						itemWrap, listHeaders, count, emitted, result)
+				}
+			}
+		}
+	})
+
+	t.Run("once per element with RepairOutput", func(t *testing.T) {
+		for _, root := range []string{"all", "my root"} {
+			var names []string
+			opts := DefaultOptions()
+			opts.CustomRoot = root
+			opts.RepairOutput = true
+			opts.OnElement = func(name string, depth int) { names = append(names, name) }
+			result := DictToXML(map[string]any{"a": 1}, opts)
+
+			if len(names) != 2 || names[1] != "a" || !bytes.Contains(result, []byte("<"+names[0]+">")) {
+				t.Errorf("root %q: expected the kept output's elements, got %q for %s", root, names, result)
+			}
+		}
+	})
+}
+
+func TestLazyNamespaces(t *testing.T) {
+	data := map[string]any{
+		"a":     map[string]any{"ns1:b": "x"},
+		"ns1:c": "y",
+		"ns2:d": map[string]any{"ns2:e": []any{1}},
+	}
+	opts := DefaultOptions()
+	opts.AttrType = false
+	opts.XMLNamespaces = map[string]any{"ns1": "http://one", "ns2": "http://two", "xmlns": "http://default"}
+
+	t.Run("declared where first used", func(t *testing.T) {
+		opts.LazyNamespaces = true
+		result := string(DictToXML(data, opts))
+
+		expected := `<?xml version="1.0" encoding="UTF-8" ?><root xmlns="http://default">` +
+			`<a><ns1:b xmlns:ns1="http://one">x</ns1:b></a>` +
+			`<ns1:c xmlns:ns1="http://one">y</ns1:c>` +
+			`<ns2:d xmlns:ns2="http://two"><ns2:e><item>1</item></ns2:e></ns2:d></root>`
+		if result != expected {
+			t.Errorf("expected %s, got %s", expected, result)
+		}
+	})
+
+	t.Run("declared on the root by default", func(t *testing.T) {
+		opts.LazyNamespaces = false
+		result := string(DictToXML(data, opts))
+
+		if !strings.Contains(result, `xmlns:ns1="http://one"`) || strings.Count(result, "xmlns:ns1") != 1 {
+			t.Errorf("expected a single root declaration, got %s", result)
+		}
+		if !strings.Contains(result, "<ns1:c>y</ns1:c>") {
+			t.Errorf("expected undecorated child, got %s", result)
+		}
+	})
+}
+
+func TestPrettyPrint(t *testing.T) {
+	t.Run("formats XML with indentation", func(t *testing.T) {
+		input := []byte(`<?xml version="1.0" encoding="UTF-8" ?><root><child>value</child></root>`)
+		result, err := PrettyPrint(input)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		if !strings.Contains(result, "\n") {
+			t.Errorf("expected formatted output with newlines, got %s", result)
+		}
+	})
+
+	body := "<a>\n  <b>1</b>\n</a>"
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{
+			"declaration without trailing space",
+			`<?xml version="1.0" encoding="UTF-8"?><a><b>1</b></a>`,
+			`<?xml version="1.0" encoding="UTF-8"?>` + "\n" + body,
+		},
+		{
+			"declaration with trailing space",
+			`<?xml version="1.0" encoding="UTF-8" ?><a><b>1</b></a>`,
+			`<?xml version="1.0" encoding="UTF-8" ?>` + "\n" + body,
+		},
+		{
+			"stylesheet with ? in its href",
+			`<?xml version="1.0"?><?xml-stylesheet type="text/xsl" href="s.xsl?v=1"?><a><b>1</b></a>`,
+			`<?xml version="1.0"?>` + "\n" + `<?xml-stylesheet type="text/xsl" href="s.xsl?v=1"?>` + "\n" + body,
+		},
+		{
+			"whitespace between prolog lines",
+			"<?xml version=\"1.0\" standalone=\"yes\"?>\n<?xml-stylesheet href=\"a?b\"?>\n<a><b>1</b></a>\n",
+			`<?xml version="1.0" standalone="yes"?>` + "\n" + `<?xml-stylesheet href="a?b"?>` + "\n" + body,
+		},
+		{
+			"stylesheet without declaration",
+			`<?xml-stylesheet href="a.xsl"?><a><b>1</b></a>`,
+			`<?xml version="1.0" encoding="UTF-8"?>` + "\n" + `<?xml-stylesheet href="a.xsl"?>` + "\n" + body,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := PrettyPrint([]byte(tt.input))
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if result != tt.expected {
+				t.Errorf("expected\n%s\ngot\n%s", tt.expected, result)
+			}
+		})
+	}
+}
+
+func TestPrettyPrintPreservesCDATA(t *testing.T) {
+	opts := DefaultOptions()
+	opts.CDATA = true
+	xmlBytes := DictToXML(map[string]any{"note": "a < b", "tricky": "x]]>y", "bike": map[string]any{"color": "red"}}, opts)
+
+	result, err := PrettyPrint(xmlBytes)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	for _, want := range []string{
+		`<note type="str"><![CDATA[a < b]]></note>`,
+		`<tricky type="str"><![CDATA[x]]]]><![CDATA[>y]]></tricky>`,
+		"\n    <color type=\"str\"><![CDATA[red]]></color>\n  </bike>",
+	} {
+		if !strings.Contains(result, want) {
+			t.Errorf("expected %q in %s", want, result)
+		}
+	}
+	if err := checkWellFormed([]byte(result)); err != nil {
+		t.Errorf("expected well-formed output, got %v", err)
+	}
+}
+
+func TestPrettyPrintPreservesSelfClosingTags(t *testing.T) {
+	input := []byte(`<root><a type="null"/><b></b><c><d/></c><e>x</e></root>`)
+	result, err := PrettyPrint(input)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	expected := "<root>\n  <a type=\"null\"/>\n  <b></b>\n  <c>\n    <d/>\n  </c>\n  <e>x</e>\n</root>"
+	if !strings.HasSuffix(result, expected) {
+		t.Errorf("expected %q, got %q", expected, result)
+	}
+}
+
+func TestPrettyPrintWith(t *testing.T) {
+	input := []byte(`<?xml version="1.0" encoding="UTF-8" ?><root><child>value</child></root>`)
+
+	t.Run("tabs", func(t *testing.T) {
+		result, err := PrettyPrintWith(input, "", "\t")
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		expected := "<?xml version=\"1.0\" encoding=\"UTF-8\" ?>\n<root>\n\t<child>value</child>\n</root>"
+		if result != expected {
+			t.Errorf("expected %q, got %q", expected, result)
+		}
+	})
+
+	t.Run("matches PrettyPrint for two spaces", func(t *testing.T) {
+		want, _ := PrettyPrint(input)
+		got, err := PrettyPrintWith(input, "", "  ")
+		if err != nil || got != want {
+			t.Errorf("expected %q, got %q (%v)", want, got, err)
+		}
+	})
+
+	t.Run("invalid XML", func(t *testing.T) {
+		if _, err := PrettyPrintWith([]byte("<root>"), "", "\t"); err == nil {
+			t.Error("expected error for invalid XML")
+		}
+	})
+}
+
+func TestXMLDeclaration(t *testing.T) {
+	data := map[string]any{"name": "Bike"}
+
+	t.Run("default", func(t *testing.T) {
+		result := string(DictToXML(data, DefaultOptions()))
+		if !strings.HasPrefix(result, `<?xml version="1.0" encoding="UTF-8" ?><root>`) {
+			t.Errorf("expected default declaration, got %s", result)
+		}
+	})
+
+	t.Run("omitted", func(t *testing.T) {
+		opts := DefaultOptions()
+		empty := ""
+		opts.XMLDeclaration = &empty
+		result := string(DictToXML(data, opts))
+		if !strings.HasPrefix(result, "<root>") {
+			t.Errorf("expected no declaration, got %s", result)
+		}
+
+		opts.XPathFormat = true
+		if result := string(DictToXML(data, opts)); !strings.HasPrefix(result, "<map") {
+			t.Errorf("expected no declaration in XPath output, got %s", result)
+		}
+	})
+
+	t.Run("custom", func(t *testing.T) {
+		opts := DefaultOptions()
+		decl := `<?xml version="1.0" encoding="ISO-8859-1" standalone="yes"?>`
+		opts.XMLDeclaration = &decl
+		result := DictToXML(data, opts)
+		if !strings.HasPrefix(string(result), decl+"<root>") {
+			t.Errorf("expected custom declaration, got %s", result)
+		}
+
+		pretty, err := PrettyPrint(result)
+		if err != nil {
+			t.Fatalf("PrettyPrint returned error: %v", err)
+		}
+		if !strings.HasPrefix(pretty, decl+"\n<root>") {
+			t.Errorf("expected PrettyPrint to keep the declaration unchanged, got %q", pretty)
+		}
+	})
+
+	t.Run("PrettyPrint adds a missing declaration", func(t *testing.T) {
+		pretty, err := PrettyPrint([]byte("<root><a>1</a></root>"))
+		if err != nil {
+			t.Fatalf("PrettyPrint returned error: %v", err)
+		}
+		if !strings.HasPrefix(pretty, `<?xml version="1.0" encoding="UTF-8"?>`+"\n<root>") {
+			t.Errorf("expected default declaration, got %q", pretty)
+		}
+	})
+}
+
+func TestTypeAttrExclude(t *testing.T) {
+	data := map[string]any{
+		"password": "secret",
+		"name":     "Bike",
+		"active":   true,
+		"deleted":  nil,
+		"owner":    map[string]any{"id": 7},
+		"tags":     []any{map[string]any{"x": 1}},
+	}
+	opts := DefaultOptions()
+	opts.TypeAttrExclude = map[string]bool{"password": true, "active": true, "deleted": true, "owner": true, "tags": true}
+	result := string(DictToXML(data, opts))
+
+	for _, want := range []string{
+		`<password>secret</password>`,
+		`<active>true</active>`,
+		`<deleted></deleted>`,
+		`<owner><id type="int">7</id></owner>`,
+		`<tags><item type="dict"><x type="int">1</x></item></tags>`,
+		`<name type="str">Bike</name>`,
+	} {
+		if !strings.Contains(result, want) {
+			t.Errorf("expected %s in %s", want, result)
+		}
+	}
+
+	t.Run("map entries", func(t *testing.T) {
+		entryOpts := opts
+		entryOpts.MapAsEntries = true
+		result := string(DictToXML(map[string]any{"password": "secret", "n": 1}, entryOpts))
+		for _, want := range []string{`<entry key="password" value="secret"/>`, `<entry key="n" type="int" value="1"/>`} {
+			if !strings.Contains(result, want) {
+				t.Errorf("expected %s in %s", want, result)
+			}
+		}
+	})
+}
+
+func TestPrettyPrintTo(t *testing.T) {
+	inputs := [][]byte{
+		DictToXML(map[string]any{"bike": map[string]any{"color": "red", "none": nil}, "tags": []any{"a", "b"}}, DefaultOptions()),
+		[]byte(`<root><a/><b><![CDATA[x < y]]></b></root>`),
+	}
+	for _, input := range inputs {
+		want, err := PrettyPrint(input)
+		if err != nil {
+			t.Fatalf("PrettyPrint returned error: %v", err)
+		}
+		var buf bytes.Buffer
+		if err := PrettyPrintTo(&buf, input); err != nil {
+			t.Fatalf("PrettyPrintTo returned error: %v", err)
+		}
+		if buf.String() != want {
+			t.Errorf("expected %q, got %q", want, buf.String())
+		}
+	}
+
+	t.Run("errors", func(t *testing.T) {
+		if err := PrettyPrintTo(&bytes.Buffer{}, []byte("<root>")); err == nil {
+			t.Error("expected error for invalid XML")
+		}
+		if err := PrettyPrintTo(failingWriter{}, inputs[0]); err == nil {
+			t.Error("expected write error")
+		}
+	})
+}
+
+func TestCompactLeaves(t *testing.T) {
+	data := map[string]any{"bike": map[string]any{"color": "red", "extras": map[string]any{}, "tags": []any{}}}
+	opts := DefaultOptions()
+	opts.AttrType = false
+	once, err := PrettyPrint(DictToXML(data, opts))
+	if err != nil {
+		t.Fatalf("PrettyPrint returned error: %v", err)
+	}
+	expected := `<?xml version="1.0" encoding="UTF-8" ?>
+<root>
+  <bike>
+    <color>red</color>
+    <extras></extras>
+    <tags></tags>
+  </bike>
+</root>`
+	if once != expected {
+		t.Fatalf("expected %q, got %q", expected, once)
+	}
+
+	t.Run("before: indentation is kept as text", func(t *testing.T) {
+		twice, err := PrettyPrintOptions([]byte(once), opts)
+		if err != nil {
+			t.Fatalf("PrettyPrintOptions returned error: %v", err)
+		}
+		if twice == once || !strings.Contains(twice, "\n  \n") {
+			t.Errorf("expected re-indented whitespace, got %q", twice)
+		}
+	})
+
+	t.Run("after: leaves stay on one line", func(t *testing.T) {
+		compactOpts := opts
+		compactOpts.CompactLeaves = true
+		twice, err := PrettyPrintOptions([]byte(once), compactOpts)
+		if err != nil {
+			t.Fatalf("PrettyPrintOptions returned error: %v", err)
+		}
+		if twice != once {
+			t.Errorf("expected %q, got %q", once, twice)
+		}
+
+		leaf := "<root>\n  <a>\n  </a>\n  <b> </b>\n</root>"
+		result, err := PrettyPrintOptions([]byte(leaf), compactOpts)
+		if err != nil {
+			t.Fatalf("PrettyPrintOptions returned error: %v", err)
+		}
+		if !strings.HasSuffix(result, "<root>\n  <a></a>\n  <b> </b>\n</root>") {
+			t.Errorf("expected compact leaves, got %q", result)
+		}
+	})
+}
+
+func TestTopLevelScalars(t *testing.T) {
+	tests := []struct {
+		json     string
+		withRoot string
+		noRoot   string
+	}{
+		{`"Bike & Co"`, `<root type="str">Bike &amp; Co</root>`, `<item type="str">Bike &amp; Co</item>`},
+		{`42`, `<root type="int">42</root>`, `<item type="int">42</item>`},
+		{`2.5`, `<root type="float">2.5</root>`, `<item type="float">2.5</item>`},
+		{`true`, `<root type="bool">true</root>`, `<item type="bool">true</item>`},
+		{`null`, `<root type="null"></root>`, `<item type="null"></item>`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.json, func(t *testing.T) {
+			data, err := ReadFromStringUseNumber(tt.json)
+			if err != nil {
+				t.Fatalf("ReadFromStringUseNumber returned error: %v", err)
+			}
+
+			opts := DefaultOptions()
+			if result := string(DictToXML(data, opts)); result != `<?xml version="1.0" encoding="UTF-8" ?>`+tt.withRoot {
+				t.Errorf("expected %s, got %s", tt.withRoot, result)
+			}
+
+			var buf bytes.Buffer
+			if err := WriteXML(&buf, data, opts); err != nil || buf.String() != string(DictToXML(data, opts)) {
+				t.Errorf("expected WriteXML to match DictToXML, got %s (%v)", buf.String(), err)
+			}
+
+			back, err := XMLToMap(DictToXML(data, opts), opts)
+			if err != nil {
+				t.Fatalf("XMLToMap returned error: %v", err)
+			}
+			if want := normalizeValue(data); fmt.Sprint(back) != fmt.Sprint(want) {
+				t.Errorf("expected round trip to %v, got %v", want, back)
+			}
+
+			opts.Root = false
+			if result := string(DictToXML(data, opts)); result != tt.noRoot {
+				t.Errorf("expected %s without root, got %s", tt.noRoot, result)
+			}
+		})
+	}
+
+	t.Run("without type attributes", func(t *testing.T) {
+		opts := DefaultOptions()
+		opts.AttrType = false
+		if result := string(DictToXML(42, opts)); !strings.HasSuffix(result, "<root>42</root>") {
+			t.Errorf("expected untyped root text, got %s", result)
+		}
+		back, err := XMLToMap(DictToXML("text", opts), opts)
+		if err != nil || back != "text" {
+			t.Errorf("expected round trip to a string, got %v (%v)", back, err)
+		}
+	})
+}
+
+func TestOnDuplicateName(t *testing.T) {
+	data := map[string]any{"a&b": 1, "c&d": 2, "nested": map[string]any{"x y": "s", "x_y": "u"}}
+
+	t.Run("allow", func(t *testing.T) {
+		opts := DefaultOptions()
+		opts.AttrType = false
+		result := string(DictToXML(data, opts))
+		for _, want := range []string{`<key name="a&amp;b">1</key><key name="c&amp;d">2</key>`, `<x_y>s</x_y><x_y>u</x_y>`} {
+			if !strings.Contains(result, want) {
+				t.Errorf("expected %s in %s", want, result)
+			}
+		}
+	})
+
+	t.Run("suffix", func(t *testing.T) {
+		opts := DefaultOptions()
+		opts.AttrType = false
+		opts.OnDuplicateName = DuplicateNameSuffix
+		result := string(DictToXML(data, opts))
+		for _, want := range []string{`<key name="a&amp;b">1</key><key_2 name="c&amp;d">2</key_2>`, `<x_y>s</x_y><x_y_2>u</x_y_2>`} {
+			if !strings.Contains(result, want) {
+				t.Errorf("expected %s in %s", want, result)
+			}
+		}
+	})
+
+	t.Run("suffix skips names already taken", func(t *testing.T) {
+		opts := DefaultOptions()
+		opts.AttrType = false
+		opts.OnDuplicateName = DuplicateNameSuffix
+		result := string(DictToXML(map[string]any{"a b": 1, "a_b": 2, "a_b_2": 3}, opts))
+		if !strings.Contains(result, `<a_b>1</a_b><a_b_2>2</a_b_2><a_b_2_2>3</a_b_2_2>`) {
+			t.Errorf("expected unique names, got %s", result)
+		}
+	})
+
+	t.Run("error", func(t *testing.T) {
+		opts := DefaultOptions()
+		opts.OnDuplicateName = DuplicateNameError
+		if _, err := ConvertToXML(data, &opts); !errors.Is(err, ErrDuplicateName) {
+			t.Errorf("expected ErrDuplicateName, got %v", err)
+		}
+		if result := DictToXML(data, opts); !bytes.Contains(result, []byte(`<x_y type="str">s</x_y><x_y type="str">u</x_y>`)) {
+			t.Errorf("expected DictToXML to write both elements, got %s", result)
+		}
+		if err := WriteXML(&bytes.Buffer{}, data, opts); !errors.Is(err, ErrDuplicateName) {
+			t.Errorf("expected ErrDuplicateName from WriteXML, got %v", err)
+		}
+		if _, err := ConvertToXML(map[string]any{"a": 1, "b": 2}, &opts); err != nil {
+			t.Errorf("expected distinct names to convert, got %v", err)
+		}
+	})
+}
+
+func TestDetailedTypes(t *testing.T) {
+	type point struct{ X int }
+	tests := []struct {
+		val      any
+		coarse   string
+		detailed string
+	}{
+		{nil, "null", "null"},
+		{true, "bool", "bool"},
+		{int(1), "int", "int"},
+		{int8(1), "int", "int8"},
+		{int16(1), "int", "int16"},
+		{int32(1), "int", "int32"},
+		{int64(1), "int", "int64"},
+		{uint(1), "int", "uint"},
+		{uint8(1), "int", "uint8"},
+		{uint16(1), "int", "uint16"},
+		{uint32(1), "int", "uint32"},
+		{uint64(1), "int", "uint64"},
+		{uintptr(1), "uintptr", "uintptr"},
+		{float32(1.5), "float", "float32"},
+		{float64(1.5), "float", "float64"},
+		{json.Number("7"), "int", "int"},
+		{json.Number("7.5"), "float", "float"},
+		{"s", "str", "str"},
+		{map[string]any{}, "dict", "dict"},
+		{[]int{1}, "list", "list"},
+		{[2]int{1, 2}, "list", "list"},
+		{point{}, "dict", "dict"},
+		{complex(1, 2), "complex128", "complex128"},
+	}
+
+	detailed := DefaultOptions()
+	detailed.DetailedTypes = true
+	for _, tt := range tests {
+		if got := DefaultOptions().xmlType(tt.val); got != tt.coarse {
+			t.Errorf("%T: expected coarse type %q, got %q", tt.val, tt.coarse, got)
+		}
+		if got := detailed.xmlType(tt.val); got != tt.detailed {
+			t.Errorf("%T: expected detailed type %q, got %q", tt.val, tt.detailed, got)
+		}
+	}
+
+	data := map[string]any{"small": uint8(200), "big": uint64(1 << 63), "ratio": float32(0.5), "count": int32(-3)}
+	result := string(DictToXML(data, detailed))
+	for _, want := range []string{
+		`<small type="uint8">200</small>`,
+		`<big type="uint64">9223372036854775808</big>`,
+		`<ratio type="float32">0.5</ratio>`,
+		`<count type="int32">-3</count>`,
+	} {
+		if !strings.Contains(result, want) {
+			t.Errorf("expected %s in %s", want, result)
+		}
+	}
+
+	back, err := XMLToMap([]byte(result), DefaultOptions())
+	if err != nil {
+		t.Fatalf("XMLToMap returned error: %v", err)
+	}
+	m := back.(map[string]any)
+	if m["small"] != uint64(200) || m["big"] != uint64(1<<63) || m["ratio"] != 0.5 || m["count"] != int64(-3) {
+		t.Errorf("unexpected round trip: %#v", m)
+	}
+
+	xsd, err := GenerateXSD(data, detailed)
+	if err != nil {
+		t.Fatalf("GenerateXSD returned error: %v", err)
+	}
+	for _, want := range []string{`base="xs:unsignedByte"`, `base="xs:unsignedLong"`, `base="xs:float"`, `base="xs:int"`} {
+		if !strings.Contains(string(xsd), want) {
+			t.Errorf("expected %s in %s", want, xsd)
+		}
+	}
+}
+
+func TestBoolStrings(t *testing.T) {
+	data := map[string]any{"on": true, "off": false, "flags": []any{true, false}}
+
+	tests := []struct {
+		strings  [2]string
+		expected []string
+	}{
+		{[2]string{"1", "0"}, []string{
+			`<on type="bool">1</on>`,
+			`<off type="bool">0</off>`,
+			`<flags type="list"><item type="bool">1</item><item type="bool">0</item></flags>`,
+		}},
+		{[2]string{"yes", "no"}, []string{
+			`<on type="bool">yes</on>`,
+			`<off type="bool">no</off>`,
+		}},
+		{[2]string{"a&b", "<no>"}, []string{
+			`<on type="bool">a&amp;b</on>`,
+			`<off type="bool">&lt;no&gt;</off>`,
+		}},
+	}
+	for _, tt := range tests {
+		opts := DefaultOptions()
+		opts.BoolStrings = tt.strings
+		result := string(DictToXML(data, opts))
+		for _, want := range tt.expected {
+			if !strings.Contains(result, want) {
+				t.Errorf("%v: expected %s in %s", tt.strings, want, result)
+			}
+		}
+	}
+
+	t.Run("zero value", func(t *testing.T) {
+		opts := DefaultOptions()
+		opts.BoolStrings = [2]string{}
+		if result := string(DictToXML(map[string]any{"on": true}, opts)); !strings.Contains(result, `<on type="bool">true</on>`) {
+			t.Errorf("expected true, got %s", result)
+		}
+	})
+
+	t.Run("top-level scalar and map entries", func(t *testing.T) {
+		opts := DefaultOptions()
+		opts.BoolStrings = [2]string{"1", "0"}
+		if result := string(DictToXML(false, opts)); !strings.Contains(result, `<root type="bool">0</root>`) {
+			t.Errorf("expected 0 root text, got %s", result)
+		}
+		opts.MapAsEntries = true
+		if result := string(DictToXML(map[string]any{"on": true}, opts)); !strings.Contains(result, `value="1"`) {
+			t.Errorf("expected value=\"1\", got %s", result)
+		}
+	})
+
+	t.Run("XPath format is unaffected", func(t *testing.T) {
+		opts := DefaultOptions()
+		opts.XPathFormat = true
+		opts.BoolStrings = [2]string{"1", "0"}
+		if result := string(DictToXML(map[string]any{"on": true}, opts)); !strings.Contains(result, `<boolean key="on">true</boolean>`) {
+			t.Errorf("expected XPath boolean true, got %s", result)
+		}
+	})
+}
+
+func TestMixedContent(t *testing.T) {
+	opts := DefaultOptions()
+	opts.AttrType = false
+
+	tests := []struct {
+		name     string
+		data     map[string]any
+		expected string
+	}{
+		{"text then child", map[string]any{"p": map[string]any{"@val": "hello ", "b": "world"}}, `<p>hello <b>world</b></p>`},
+		{"children sorted after text", map[string]any{"p": map[string]any{"@val": "x", "z": 1, "a": 2}}, `<p>x<a>2</a><z>1</z></p>`},
+		{"nested", map[string]any{"p": map[string]any{"@val": "a ", "b": map[string]any{"@val": "b ", "i": "c"}}}, `<p>a <b>b <i>c</i></b></p>`},
+		{"with attributes", map[string]any{"p": map[string]any{"@attrs": map[string]any{"id": "1"}, "@val": "t", "b": "u"}}, `<p id="1">t<b>u</b></p>`},
+		{"escaped text", map[string]any{"p": map[string]any{"@val": "a<b", "c": "d"}}, `<p>a&lt;b<c>d</c></p>`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := string(DictToXML(tt.data, opts))
+			if !strings.Contains(result, tt.expected) {
+				t.Errorf("expected %s, got %s", tt.expected, result)
+			}
+			if err := checkWellFormed([]byte(result)); err != nil {
+				t.Errorf("output is not well-formed: %v", err)
+			}
+		})
+	}
+
+	t.Run("type attributes", func(t *testing.T) {
+		result := string(DictToXML(map[string]any{"p": map[string]any{"@val": "hello ", "b": "world"}}, DefaultOptions()))
+		if !strings.Contains(result, `<p type="dict">hello <b type="str">world</b></p>`) {
+			t.Errorf("expected typed mixed content, got %s", result)
+		}
+	})
+
+	t.Run("round trip", func(t *testing.T) {
+		data := map[string]any{"p": map[string]any{"@val": "hello ", "b": "world"}}
+		back, err := XMLToMap(DictToXML(data, DefaultOptions()), DefaultOptions())
+		if err != nil {
+			t.Fatalf("XMLToMap returned error: %v", err)
+		}
+		if !reflect.DeepEqual(back, data) {
+			t.Errorf("expected %v, got %v", data, back)
+		}
+	})
+}
+
+func TestDefaultNSPrefix(t *testing.T) {
+	opts := DefaultOptions()
+	opts.AttrType = false
+	opts.DefaultNSPrefix = "ns1"
+	opts.XMLNamespaces = map[string]any{"ns1": "http://example.com/ns1"}
+
+	data := map[string]any{
+		"bike":  map[string]any{"color": "red", "x:id": "7"},
+		"gears": []any{1, map[string]any{"size": 2}},
+	}
+	result := string(DictToXML(data, opts))
+	for _, want := range []string{
+		`<root xmlns:ns1="http://example.com/ns1">`,
+		`<ns1:bike><ns1:color>red</ns1:color><x:id>7</x:id></ns1:bike>`,
+		`<ns1:gears><ns1:item>1</ns1:item><ns1:item><ns1:size>2</ns1:size></ns1:item></ns1:gears>`,
+	} {
+		if !strings.Contains(result, want) {
+			t.Errorf("expected %s in %s", want, result)
+		}
+	}
+	if err := checkWellFormed([]byte(result)); err != nil {
+		t.Errorf("output is not well-formed: %v", err)
+	}
+
+	t.Run("type exclusions match unprefixed names", func(t *testing.T) {
+		typed := opts
+		typed.AttrType = true
+		typed.TypeAttrExclude = map[string]bool{"color": true}
+		result := string(DictToXML(map[string]any{"color": "red", "size": 2}, typed))
+		if !strings.Contains(result, `<ns1:color>red</ns1:color>`) || !strings.Contains(result, `<ns1:size type="int">2</ns1:size>`) {
+			t.Errorf("expected color without a type attribute, got %s", result)
+		}
+	})
+
+	t.Run("unwrapped lists and entries", func(t *testing.T) {
+		unwrapped := opts
+		unwrapped.ItemWrap = false
+		if result := string(DictToXML(map[string]any{"tag": []any{"a", "b"}}, unwrapped)); !strings.Contains(result, `<ns1:tag>a</ns1:tag><ns1:tag>b</ns1:tag>`) {
+			t.Errorf("expected repeated prefixed tags, got %s", result)
+		}
+		entries := opts
+		entries.MapAsEntries = true
+		if result := string(DictToXML(map[string]any{"k": "v"}, entries)); !strings.Contains(result, `<ns1:entry key="k" value="v"/>`) {
+			t.Errorf("expected a prefixed entry, got %s", result)
+		}
+	})
+
+	t.Run("lazy declaration", func(t *testing.T) {
+		lazy := opts
+		lazy.LazyNamespaces = true
+		result := string(DictToXML(map[string]any{"a": map[string]any{"b": 1}}, lazy))
+		if !strings.Contains(result, `<root><ns1:a xmlns:ns1="http://example.com/ns1"><ns1:b>1</ns1:b></ns1:a></root>`) {
+			t.Errorf("expected the namespace declared on the first element, got %s", result)
+		}
+	})
+}
+
+func TestStrictNamespaces(t *testing.T) {
+	opts := DefaultOptions()
+	opts.AttrType = false
+	opts.StrictNamespaces = true
+	opts.XMLNamespaces = map[string]any{"ns1": "http://example.com/ns1"}
+
+	t.Run("declared prefix", func(t *testing.T) {
+		result, err := DictToXMLValidated(map[string]any{"ns1:node": "a", "xml:lang": "en"}, opts)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if !strings.Contains(string(result), `<ns1:node>a</ns1:node>`) {
+			t.Errorf("expected prefixed element, got %s", result)
+		}
+	})
+
+	t.Run("undeclared prefix", func(t *testing.T) {
+		data := map[string]any{"outer": map[string]any{"ns2:node": "a"}}
+		if _, err := DictToXMLValidated(data, opts); !errors.Is(err, ErrUndeclaredPrefix) || !strings.Contains(err.Error(), `"ns2"`) {
+			t.Errorf("expected ErrUndeclaredPrefix naming ns2, got %v", err)
+		}
+		if _, err := ConvertToXML(data, &opts); !errors.Is(err, ErrUndeclaredPrefix) {
+			t.Errorf("expected ConvertToXML to report ErrUndeclaredPrefix, got %v", err)
+		}
+		if result := string(DictToXML(data, opts)); !strings.Contains(result, "<ns2:node>a</ns2:node>") {
+			t.Errorf("expected DictToXML to write the element anyway, got %s", result)
+		}
+
+		lenient := opts
+		lenient.StrictNamespaces = false
+		if _, err := DictToXMLValidated(data, lenient); err != nil {
+			t.Errorf("expected no error without StrictNamespaces, got %v", err)
+		}
+	})
+
+	t.Run("declared by an ancestor attribute", func(t *testing.T) {
+		data := map[string]any{"outer": map[string]any{
+			"@attrs":   map[string]any{"xmlns:ns2": "http://example.com/ns2"},
+			"ns2:node": map[string]any{"ns2:leaf": "a"},
+		}}
+		if _, err := DictToXMLValidated(data, opts); err != nil {
+			t.Errorf("expected no error, got %v", err)
+		}
+	})
+}
+
+func TestListCountAttr(t *testing.T) {
+	opts := DefaultOptions()
+	opts.ListCountAttr = true
+	data := map[string]any{"three": []any{1, 2, 3}, "none": []any{}}
+
+	result := string(DictToXML(data, opts))
+	for _, want := range []string{
+		`<three count="3" type="list"><item type="int">1</item>`,
+		`<none count="0" type="list"></none>`,
+	} {
+		if !strings.Contains(result, want) {
+			t.Errorf("expected %s in %s", want, result)
+		}
+	}
+
+	untyped := opts
+	untyped.AttrType = false
+	if result := string(DictToXML(data, untyped)); !strings.Contains(result, `<three count="3"><item>1</item>`) {
+		t.Errorf("expected count without type, got %s", result)
+	}
+
+	t.Run("omitted without a wrapper", func(t *testing.T) {
+		for name, mode := range map[string]func(*Options){
+			"unwrapped": func(o *Options) { o.ItemWrap = false },
+			"headers":   func(o *Options) { o.ListHeaders = true },
+		} {
+			modeOpts := opts
+			mode(&modeOpts)
+			if result := string(DictToXML(map[string]any{"three": []any{1, 2, 3}}, modeOpts)); strings.Contains(result, "count=") {
+				t.Errorf("%s: expected no count attribute, got %s", name, result)
+			}
+		}
+		if result := string(DictToXML(map[string]any{"x@flat": []any{1, 2}}, opts)); strings.Contains(result, "count=") {
+			t.Errorf("flat: expected no count attribute, got %s", result)
+		}
+	})
+
+	t.Run("schema", func(t *testing.T) {
+		xsd, err := GenerateXSD(data, opts)
+		if err != nil {
+			t.Fatalf("GenerateXSD returned error: %v", err)
+		}
+		if !strings.Contains(string(xsd), `<xs:attribute name="count" type="xs:nonNegativeInteger"/>`) {
+			t.Errorf("expected a count attribute declaration, got %s", xsd)
+		}
+	})
+}
+
+func TestRootAttrType(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     any
+		expected string
+	}{
+		{"dict root", map[string]any{"a": 1}, `<root type="dict"><a type="int">1</a></root>`},
+		{"list root", []any{1, "x"}, `<root type="list"><item type="int">1</item><item type="str">x</item></root>`},
+		{"empty list root", []any{}, `<root type="list"></root>`},
+		{"scalar root", 42, `<root type="int">42</root>`},
+	}
+
+	opts := DefaultOptions()
+	opts.RootAttrType = true
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := string(DictToXML(tt.data, opts))
+			if !strings.HasSuffix(result, tt.expected) {
+				t.Errorf("expected %s, got %s", tt.expected, result)
+			}
+			var buf bytes.Buffer
+			if err := WriteXML(&buf, tt.data, opts); err != nil || buf.String() != result {
+				t.Errorf("expected WriteXML to match DictToXML, got %q (err %v)", buf.String(), err)
+			}
+		})
+	}
+
+	t.Run("default leaves container roots untyped", func(t *testing.T) {
+		for _, data := range []any{map[string]any{"a": 1}, []any{1}} {
+			if result := string(DictToXML(data, DefaultOptions())); !strings.Contains(result, "<root>") {
+				t.Errorf("expected an untyped root, got %s", result)
+			}
+		}
+	})
+
+	t.Run("subject to AttrType and TypeAttrExclude", func(t *testing.T) {
+		untyped := opts
+		untyped.AttrType = false
+		excluded := opts
+		excluded.TypeAttrExclude = map[string]bool{"root": true}
+		for _, o := range []Options{untyped, excluded} {
+			if result := string(DictToXML([]any{1}, o)); !strings.Contains(result, "<root>") {
+				t.Errorf("expected an untyped root, got %s", result)
+			}
+		}
+	})
+
+	t.Run("typed list root round trips", func(t *testing.T) {
+		back, err := XMLToMap(DictToXML([]any{int64(1)}, opts), opts)
+		if err != nil {
+			t.Fatalf("XMLToMap returned error: %v", err)
+		}
+		if !reflect.DeepEqual(back, []any{int64(1)}) {
+			t.Errorf("expected [1], got %#v", back)
+		}
+	})
+}
+
+func TestRawMessage(t *testing.T) {
+	data := map[string]any{
+		"payload": json.RawMessage(`{"id": 7, "tags": ["a"], "ok": true}`),
+		"items":   []any{json.RawMessage(`1.5`), json.RawMessage(`null`)},
+		"broken":  json.RawMessage(`{oops`),
+		"empty":   json.RawMessage(nil),
+	}
+
+	result := string(DictToXML(data, DefaultOptions()))
+	for _, want := range []string{
+		`<payload type="dict"><id type="int">7</id><ok type="bool">true</ok><tags type="list"><item type="str">a</item></tags></payload>`,
+		`<items type="list"><item type="float">1.5</item><item type="null"></item></items>`,
+		`<broken type="str">{oops</broken>`,
+		`<empty type="null"></empty>`,
+	} {
+		if !strings.Contains(result, want) {
+			t.Errorf("expected %s in %s", want, result)
+		}
+	}
+
+	t.Run("top-level", func(t *testing.T) {
+		raw := json.RawMessage(`{"a": 1}`)
+		result := DictToXML(raw, DefaultOptions())
+		if !strings.HasSuffix(string(result), `<root><a type="int">1</a></root>`) {
+			t.Errorf("expected the decoded object, got %s", result)
+		}
+		var buf bytes.Buffer
+		if err := WriteXML(&buf, raw, DefaultOptions()); err != nil || !bytes.Equal(buf.Bytes(), result) {
+			t.Errorf("expected WriteXML to match DictToXML, got %q (err %v)", buf.String(), err)
+		}
+		if scalar := DictToXML(json.RawMessage(`"x"`), DefaultOptions()); !strings.HasSuffix(string(scalar), `<root type="str">x</root>`) {
+			t.Errorf("expected a top-level string, got %s", scalar)
+		}
+	})
+
+	t.Run("XPath format", func(t *testing.T) {
+		opts := DefaultOptions()
+		opts.XPathFormat = true
+		result := string(DictToXML(map[string]any{"p": json.RawMessage(`["a", true]`)}, opts))
+		if !strings.Contains(result, `<array key="p"><string>a</string><boolean>true</boolean></array>`) {
+			t.Errorf("expected a decoded array, got %s", result)
+		}
+	})
+}
+
+func TestMinify(t *testing.T) {
+	opts := DefaultOptions()
+	opts.AttrType = false
+	opts.Minify = true
+	opts.RawXMLKeys = map[string]bool{"raw": true}
+	decl := `<?xml version="1.0"?>`
+	opts.XMLDeclaration = &decl
+
+	data := map[string]any{
+		"raw":   "<a>\n  <b> </b>\n  <c>x y</c>\n</a>\n",
+		"space": " ",
+		"text":  "two  words",
+		"list":  []any{1, 2},
+	}
+	expected := `<root><list><item>1</item><item>2</item></list><raw><a><b> </b><c>x y</c></a></raw>` +
+		`<space> </space><text>two  words</text></root>`
+	result := string(DictToXML(data, opts))
+	if result != expected {
+		t.Errorf("expected %s, got %s", expected, result)
+	}
+
+	var buf bytes.Buffer
+	if err := WriteXML(&buf, data, opts); err != nil || buf.String() != result {
+		t.Errorf("expected WriteXML to match DictToXML, got %q (err %v)", buf.String(), err)
+	}
+
+	t.Run("without it the declaration stays", func(t *testing.T) {
+		opts.Minify = false
+		if result := string(DictToXML(data, opts)); !strings.HasPrefix(result, decl) || !strings.Contains(result, "\n  <b>") {
+			t.Errorf("expected the declaration and raw whitespace, got %s", result)
+		}
+	})
+
+	t.Run("CDATA and XPath", func(t *testing.T) {
+		o := DefaultOptions()
+		o.Minify = true
+		o.CDATA = true
+		if result := string(DictToXML(map[string]any{"s": "  "}, o)); result != `<root><s type="str"><![CDATA[  ]]></s></root>` {
+			t.Errorf("expected CDATA whitespace to be kept, got %s", result)
+		}
+		o.XPathFormat = true
+		if result := string(DictToXML(map[string]any{"s": "x"}, o)); strings.HasPrefix(result, "<?xml") {
+			t.Errorf("expected no declaration, got %s", result)
+		}
+	})
+
+	t.Run("malformed output is left alone", func(t *testing.T) {
+		input := []byte("<a>\n<b x=1></b></a>")
+		if got := minifyXML(input); !bytes.Equal(got, input) {
+			t.Errorf("expected input unchanged, got %s", got)
+		}
+	})
+}
+
+func TestDictToXMLErr(t *testing.T) {
+	var ch chan int
+	tests := []struct {
+		name string
+		data any
+		opts func(*Options)
+		want error
+	}{
+		{"func value", map[string]any{"callback": func() {}}, nil, ErrInvalidData},
+		{"channel in a list", []any{1, ch}, nil, ErrInvalidData},
+		{"top-level func", func() {}, nil, ErrInvalidData},
+		{"func in XPath", map[string]any{"f": func() {}}, func(o *Options) { o.XPathFormat = true }, ErrInvalidData},
+		{"invalid root name", map[string]any{"a": 1}, func(o *Options) { o.CustomRoot = "my root" }, ErrInvalidData},
+		{"empty root name", map[string]any{"a": 1}, func(o *Options) { o.CustomRoot = "" }, ErrInvalidData},
+		{"invalid namespace prefix", map[string]any{"a": 1}, func(o *Options) {
+			o.XMLNamespaces = map[string]any{"a:b": "http://example.com/"}
+		}, ErrInvalidData},
+		{"too deep", map[string]any{"a": map[string]any{"b": 1}}, func(o *Options) { o.MaxDepth = 1 }, ErrMaxDepth},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := DefaultOptions()
+			if tt.opts != nil {
+				tt.opts(&opts)
+			}
+			result, err := DictToXMLErr(tt.data, opts)
+			if !errors.Is(err, tt.want) || result != nil {
+				t.Errorf("expected %v and no output, got %v and %s", tt.want, err, result)
+			}
+			if DictToXML(tt.data, opts) == nil {
+				t.Error("expected DictToXML to still write the document")
+			}
+			var buf bytes.Buffer
+			if err := WriteXML(&buf, tt.data, opts); !errors.Is(err, tt.want) {
+				t.Errorf("expected WriteXML to fail with %v, got %v", tt.want, err)
+			}
+		})
+	}
+
+	t.Run("DictToXML keeps the best-effort output", func(t *testing.T) {
+		data := map[string]any{"ok": 1, "f": func() {}, "c": make(chan int)}
+		result := regexp.MustCompile(`0x[0-9a-f]+`).ReplaceAllString(string(DictToXML(data, DefaultOptions())), "ADDR")
+		expected := `<?xml version="1.0" encoding="UTF-8" ?><root><c type="str">ADDR</c><f type="str">ADDR</f><ok type="int">1</ok></root>`
+		if result != expected {
+			t.Errorf("expected %s, got %s", expected, result)
+		}
+
 		opts := DefaultOptions()
 		opts.Root = false
-		opts.AttrType = false
-		opts.ItemWrap = false
-		result := DictToXML(data, opts)
+		opts.StrictNamespaces = true
+		if result := string(DictToXML(map[string]any{"ns1:a": 1}, opts)); result != `<ns1:a type="int">1</ns1:a>` {
+			t.Errorf("expected the undeclared prefix to be written, got %s", result)
+		}
+	})
 
-		expected := `<bike>blue</bike><bike>green</bike>`
-		if string(result) != expected {
-			t.Errorf("expected %s, got %s", expected, string(result))
+	t.Run("valid input", func(t *testing.T) {
+		opts := DefaultOptions()
+		opts.CustomRoot = "ns:doc"
+		opts.XMLNamespaces = map[string]any{"ns": "http://example.com/"}
+		result, err := DictToXMLErr(map[string]any{"a": 1}, opts)
+		if err != nil || !bytes.Equal(result, DictToXML(map[string]any{"a": 1}, opts)) {
+			t.Errorf("expected the DictToXML output, got %s (err %v)", result, err)
 		}
 	})
 
-	t.Run("with namespaces", func(t *testing.T) {
-		data := map[string]any{"ns1:node1": "data in namespace 1"}
+	t.Run("handled funcs and repaired roots", func(t *testing.T) {
 		opts := DefaultOptions()
-		opts.AttrType = false
-		opts.XMLNamespaces = map[string]any{
-			"ns1": "https://www.google.de/ns1",
+		opts.TypeHandlers = map[reflect.Type]TypeHandler{
+			reflect.TypeOf(func() {}): func(any, Options) string { return "callback" },
+		}
+		if _, err := DictToXMLErr(map[string]any{"f": func() {}}, opts); err != nil {
+			t.Errorf("expected a handled func to convert, got %v", err)
 		}
-		result := DictToXML(data, opts)
 
-		if !strings.Contains(string(result), `xmlns:ns1="https://www.google.de/ns1"`) {
-			t.Errorf("expected namespace declaration, got %s", string(result))
+		opts = DefaultOptions()
+		opts.CustomRoot = "my root"
+		opts.RepairOutput = true
+		if _, err := DictToXMLErr(map[string]any{"a": 1}, opts); err != nil {
+			t.Errorf("expected RepairOutput to fix the root name, got %v", err)
 		}
 	})
 
-	t.Run("with xmlns namespace", func(t *testing.T) {
-		data := map[string]any{"key": "value"}
+	t.Run("NDJSON", func(t *testing.T) {
 		opts := DefaultOptions()
-		opts.AttrType = false
-		opts.XMLNamespaces = map[string]any{
-			"xmlns": "http://example.com",
+		opts.CustomRoot = "<bad>"
+		if err := ConvertNDJSON(strings.NewReader("1\n"), &bytes.Buffer{}, opts); !errors.Is(err, ErrInvalidData) {
+			t.Errorf("expected ErrInvalidData, got %v", err)
 		}
-		result := DictToXML(data, opts)
+	})
+}
 
-		if !strings.Contains(string(result), `xmlns="http://example.com"`) {
-			t.Errorf("expected xmlns declaration, got %s", string(result))
+func TestEscaper(t *testing.T) {
+	data := map[string]any{"note": map[string]any{"@attrs": map[string]any{"lang": "en"}, "@val": "a & b"}, "n": 5}
+	opts := DefaultOptions()
+	opts.Root = false
+	opts.AttrType = false
+
+	t.Run("custom escaper is used for text and attributes", func(t *testing.T) {
+		opts := opts
+		opts.Escaper = strings.ToUpper
+		result := string(DictToXML(data, opts))
+		expected := `<n>5</n><note lang="EN">A & B</note>`
+		if result != expected {
+			t.Errorf("expected %s, got %s", expected, result)
+		}
+	})
+
+	t.Run("runs after invalid characters are dropped", func(t *testing.T) {
+		opts := opts
+		var seen []string
+		opts.Escaper = func(s string) string {
+			seen = append(seen, s)
+			return EscapeXML(s)
+		}
+		DictToXML(map[string]any{"k": "x\x01y"}, opts)
+		if !slices.Contains(seen, "xy") {
+			t.Errorf("expected escaper to see sanitized text, got %q", seen)
+		}
+	})
+
+	t.Run("custom escaper is used for BoolStrings", func(t *testing.T) {
+		opts := opts
+		opts.Escaper = strings.ToUpper
+		opts.BoolStrings = [2]string{"yes", "no"}
+		result := string(DictToXML(map[string]any{"a": true, "b": []any{false}, "c": map[string]any{"@val": true}}, opts))
+		expected := `<a>YES</a><b><item>NO</item></b><c>YES</c>`
+		if result != expected {
+			t.Errorf("expected %s, got %s", expected, result)
+		}
+
+		opts.Root = true
+		if result := string(DictToXML(false, opts)); !strings.Contains(result, `<root>NO</root>`) {
+			t.Errorf("expected an escaped root, got %s", result)
+		}
+	})
+
+	t.Run("nil uses EscapeXML", func(t *testing.T) {
+		result := string(DictToXML(data, opts))
+		expected := `<n>5</n><note lang="en">a &amp; b</note>`
+		if result != expected {
+			t.Errorf("expected %s, got %s", expected, result)
+		}
+	})
+}
+
+func TestCDATAAuto(t *testing.T) {
+	opts := DefaultOptions()
+	opts.Root = false
+	opts.AttrType = false
+	opts.CDATAAuto = true
+
+	tests := []struct {
+		name     string
+		value    string
+		expected string
+	}{
+		{"plain text is escaped", "hello world", `<v>hello world</v>`},
+		{"quotes stay escaped text", `say "hi" > bye`, `<v>say &quot;hi&quot; &gt; bye</v>`},
+		{"markup is wrapped", "<b>bold</b>", `<v><![CDATA[<b>bold</b>]]></v>`},
+		{"ampersand is wrapped", "Tom & Jerry", `<v><![CDATA[Tom & Jerry]]></v>`},
+		{"terminator is split", "a]]>b", `<v><![CDATA[a]]]]><![CDATA[>b]]></v>`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := string(DictToXML(map[string]any{"v": tt.value}, opts))
+			if result != tt.expected {
+				t.Errorf("expected %s, got %s", tt.expected, result)
+			}
+		})
+	}
+
+	t.Run("mixed values", func(t *testing.T) {
+		data := map[string]any{"html": "<p>x</p>", "n": 3, "title": "Intro", "items": []any{"a&b", "c"}}
+		result := string(DictToXML(data, opts))
+		expected := `<html><![CDATA[<p>x</p>]]></html><items><item><![CDATA[a&b]]></item><item>c</item></items><n>3</n><title>Intro</title>`
+		if result != expected {
+			t.Errorf("expected %s, got %s", expected, result)
+		}
+	})
+
+	t.Run("CDATA wins", func(t *testing.T) {
+		opts := opts
+		opts.CDATA = true
+		result := string(DictToXML(map[string]any{"v": "plain"}, opts))
+		if result != `<v><![CDATA[plain]]></v>` {
+			t.Errorf("expected every value in CDATA, got %s", result)
+		}
+	})
+}
+
+func TestNilAttr(t *testing.T) {
+	data := map[string]any{"empty": "", "missing": nil}
+	opts := DefaultOptions()
+	opts.Root = false
+	opts.AttrType = false
+
+	t.Run("without it null and empty string look alike", func(t *testing.T) {
+		result := string(DictToXML(data, opts))
+		if result != `<empty></empty><missing></missing>` {
+			t.Errorf("unexpected output %s", result)
+		}
+	})
+
+	t.Run("marks only nulls", func(t *testing.T) {
+		opts := opts
+		opts.NilAttr = "nil"
+		result := string(DictToXML(data, opts))
+		expected := `<empty></empty><missing nil="true"></missing>`
+		if result != expected {
+			t.Errorf("expected %s, got %s", expected, result)
+		}
+	})
+
+	t.Run("xsi:nil in lists and with SelfCloseEmpty", func(t *testing.T) {
+		opts := opts
+		opts.NilAttr = "xsi:nil"
+		opts.SelfCloseEmpty = true
+		result := string(DictToXML(map[string]any{"v": []any{nil, ""}}, opts))
+		expected := `<v><item xsi:nil="true"/><item/></v>`
+		if result != expected {
+			t.Errorf("expected %s, got %s", expected, result)
+		}
+	})
+
+	t.Run("null root", func(t *testing.T) {
+		opts := DefaultOptions()
+		opts.NilAttr = "nil"
+		result := string(DictToXML(nil, opts))
+		if !strings.Contains(result, `<root nil="true" type="null"></root>`) {
+			t.Errorf("expected nil attribute on the root, got %s", result)
+		}
+	})
+
+	t.Run("invalid name", func(t *testing.T) {
+		opts := opts
+		opts.NilAttr = "is nil"
+		if _, err := DictToXMLErr(data, opts); !errors.Is(err, ErrInvalidData) {
+			t.Errorf("expected ErrInvalidData, got %v", err)
+		}
+	})
+}
+
+func TestKeyTransform(t *testing.T) {
+	snakeCase := func(key string) string {
+		var b strings.Builder
+		for i, r := range key {
+			if r >= 'A' && r <= 'Z' {
+				if i > 0 {
+					b.WriteByte('_')
+				}
+				r += 'a' - 'A'
+			}
+			b.WriteRune(r)
+		}
+		return b.String()
+	}
+
+	opts := DefaultOptions()
+	opts.Root = false
+	opts.AttrType = false
+
+	t.Run("applies to nested keys", func(t *testing.T) {
+		opts := opts
+		opts.KeyTransform = snakeCase
+		data := map[string]any{"userName": "ann", "homeAddress": map[string]any{"zipCode": "1234"}}
+		result := string(DictToXML(data, opts))
+		expected := `<home_address><zip_code>1234</zip_code></home_address><user_name>ann</user_name>`
+		if result != expected {
+			t.Errorf("expected %s, got %s", expected, result)
+		}
+	})
+
+	t.Run("leaves control keys and input alone", func(t *testing.T) {
+		opts := opts
+		opts.KeyTransform = strings.ToUpper
+		inner := map[string]any{"@attrs": map[string]any{"lang": "en"}, "@val": "hi", "b": "x"}
+		data := map[string]any{"note": inner, "tags": []any{"t"}}
+		result := string(DictToXML(data, opts))
+		expected := `<NOTE lang="en">hi<B>x</B></NOTE><TAGS><item>t</item></TAGS>`
+		if result != expected {
+			t.Errorf("expected %s, got %s", expected, result)
+		}
+		if _, ok := inner["b"]; !ok {
+			t.Error("expected the input map to keep its keys")
+		}
+	})
+
+	t.Run("result is sanitized", func(t *testing.T) {
+		opts := opts
+		opts.KeyTransform = func(key string) string { return "my " + key }
+		result := string(DictToXML(map[string]any{"id": 1}, opts))
+		if result != `<my_id>1</my_id>` {
+			t.Errorf("expected sanitized name, got %s", result)
+		}
+	})
+
+	t.Run("colliding names", func(t *testing.T) {
+		opts := opts
+		opts.KeyTransform = strings.ToLower
+		opts.OnDuplicateName = DuplicateNameError
+		if _, err := DictToXMLErr(map[string]any{"ID": 1, "id": 2}, opts); !errors.Is(err, ErrDuplicateName) {
+			t.Errorf("expected ErrDuplicateName, got %v", err)
+		}
+	})
+
+	t.Run("schema matches", func(t *testing.T) {
+		opts := DefaultOptions()
+		opts.KeyTransform = snakeCase
+		xsd, err := GenerateXSD(map[string]any{"firstName": "a"}, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(string(xsd), `name="first_name"`) {
+			t.Errorf("expected transformed name in schema, got %s", xsd)
+		}
+	})
+}
+
+func TestTypedMapOptions(t *testing.T) {
+	typed := map[string]any{"counts": map[string]int{"b": 2, "a": 1}, "tags": []string{"x", "y"}}
+	plain := map[string]any{"counts": map[string]any{"b": 2, "a": 1}, "tags": []any{"x", "y"}}
+	variants := map[string]func(*Options){
+		"default":      func(*Options) {},
+		"xpath":        func(o *Options) { o.XPathFormat = true },
+		"list headers": func(o *Options) { o.ListHeaders = true },
+		"no item wrap": func(o *Options) { o.ItemWrap = false },
+		"entries":      func(o *Options) { o.MapAsEntries = true },
+		"xsd lists":    func(o *Options) { o.XSDListPrimitives = true },
+	}
+	for name, apply := range variants {
+		t.Run(name, func(t *testing.T) {
+			opts := DefaultOptions()
+			apply(&opts)
+			if got, want := DictToXML(typed, opts), DictToXML(plain, opts); string(got) != string(want) {
+				t.Errorf("typed output\n%s\ndiffers from\n%s", got, want)
+			}
+		})
+	}
+}
+
+func TestStylesheetHref(t *testing.T) {
+	data := map[string]any{"a": 1}
+	pi := `<?xml-stylesheet type="text/xsl" href="style.xsl?v=1&amp;x=2"?>`
+
+	opts := DefaultOptions()
+	opts.AttrType = false
+	opts.StylesheetHref = "style.xsl?v=1&x=2"
+
+	t.Run("after the declaration", func(t *testing.T) {
+		result := string(DictToXML(data, opts))
+		expected := `<?xml version="1.0" encoding="UTF-8" ?>` + pi + `<root><a>1</a></root>`
+		if result != expected {
+			t.Errorf("expected %s, got %s", expected, result)
+		}
+	})
+
+	t.Run("kept by Minify and WriteXML", func(t *testing.T) {
+		opts := opts
+		opts.Minify = true
+		if result := string(DictToXML(data, opts)); result != pi+`<root><a>1</a></root>` {
+			t.Errorf("unexpected minified output %s", result)
+		}
+
+		streamOpts := DefaultOptions()
+		streamOpts.StylesheetHref = "s.xsl"
+		var buf bytes.Buffer
+		if err := WriteXML(&buf, data, streamOpts); err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(buf.String(), `?><?xml-stylesheet type="text/xsl" href="s.xsl"?><root`) {
+			t.Errorf("expected stylesheet in streamed output, got %s", buf.String())
+		}
+	})
+
+	t.Run("not written without a root", func(t *testing.T) {
+		opts := opts
+		opts.Root = false
+		if result := string(DictToXML(data, opts)); strings.Contains(result, "xml-stylesheet") {
+			t.Errorf("expected no stylesheet, got %s", result)
+		}
+	})
+
+	t.Run("survives pretty printing", func(t *testing.T) {
+		pretty, err := PrettyPrint(DictToXML(data, opts))
+		if err != nil {
+			t.Fatal(err)
+		}
+		lines := strings.Split(pretty, "\n")
+		if len(lines) < 3 || lines[1] != pi || lines[2] != "<root>" {
+			t.Errorf("expected the stylesheet on its own line, got %s", pretty)
 		}
 	})
+}
+
+func TestOmitEmptyCollections(t *testing.T) {
+	data := map[string]any{
+		"tags":    []any{},
+		"ids":     []int{1},
+		"meta":    map[string]any{},
+		"owner":   map[string]any{"name": "ann", "roles": []any{}, "extra": map[string]any{}},
+		"matrix":  []any{[]any{}, []any{1}},
+		"missing": []string(nil),
+	}
+	opts := DefaultOptions()
+	opts.Root = false
+	opts.AttrType = false
+
+	tests := []struct {
+		name     string
+		apply    func(*Options)
+		expected string
+	}{
+		{
+			"defaults keep everything",
+			func(*Options) {},
+			`<ids><item>1</item></ids><matrix><item></item><item><item>1</item></item></matrix><meta></meta><missing></missing>` +
+				`<owner><extra></extra><name>ann</name><roles></roles></owner><tags></tags>`,
+		},
+		{
+			"lists",
+			func(o *Options) { o.OmitEmptyLists = true },
+			`<ids><item>1</item></ids><matrix><item></item><item><item>1</item></item></matrix><meta></meta>` +
+				`<owner><extra></extra><name>ann</name></owner>`,
+		},
+		{
+			"objects",
+			func(o *Options) { o.OmitEmptyObjects = true },
+			`<ids><item>1</item></ids><matrix><item></item><item><item>1</item></item></matrix><missing></missing>` +
+				`<owner><name>ann</name><roles></roles></owner><tags></tags>`,
+		},
+		{
+			"both",
+			func(o *Options) { o.OmitEmptyLists, o.OmitEmptyObjects = true, true },
+			`<ids><item>1</item></ids><matrix><item></item><item><item>1</item></item></matrix><owner><name>ann</name></owner>`,
+		},
+		{
+			"nil slices stay null",
+			func(o *Options) { o.OmitEmptyLists, o.DistinguishNilSlice = true, true },
+			`<ids><item>1</item></ids><matrix><item></item><item><item>1</item></item></matrix><meta></meta><missing></missing>` +
+				`<owner><extra></extra><name>ann</name></owner>`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := opts
+			tt.apply(&opts)
+			result := string(DictToXML(data, opts))
+			if result != tt.expected {
+				t.Errorf("expected %s, got %s", tt.expected, result)
+			}
+		})
+	}
 
-	t.Run("boolean values", func(t *testing.T) {
-		data := map[string]any{"flag": true}
+	t.Run("XPath", func(t *testing.T) {
 		opts := DefaultOptions()
-		opts.Root = false
-		opts.AttrType = false
-		result := DictToXML(data, opts)
-
-		if string(result) != "<flag>true</flag>" {
-			t.Errorf("expected '<flag>true</flag>', got %s", string(result))
+		opts.XPathFormat = true
+		opts.OmitEmptyLists = true
+		result := string(DictToXML(map[string]any{"a": []any{}, "b": 1}, opts))
+		if strings.Contains(result, `key="a"`) || !strings.Contains(result, `key="b"`) {
+			t.Errorf("expected only b, got %s", result)
 		}
 	})
 
-	t.Run("null values", func(t *testing.T) {
-		data := map[string]any{"empty": nil}
+	t.Run("schema skips omitted entries", func(t *testing.T) {
 		opts := DefaultOptions()
-		opts.Root = false
-		opts.AttrType = false
-		result := DictToXML(data, opts)
-
-		if string(result) != "<empty></empty>" {
-			t.Errorf("expected '<empty></empty>', got %s", string(result))
+		opts.OmitEmptyLists = true
+		xsd, err := GenerateXSD(map[string]any{"a": []any{}, "b": 1}, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.Contains(string(xsd), `name="a"`) {
+			t.Errorf("expected no element for a, got %s", xsd)
 		}
 	})
+}
 
-	t.Run("nested dict", func(t *testing.T) {
-		data := map[string]any{
-			"person": map[string]any{
-				"name": "John",
-				"age":  30,
-			},
-		}
+func TestItemIndexAttr(t *testing.T) {
+	scalars := map[string]any{"tags": []any{"a", "b", "c"}}
+	maps := map[string]any{"rows": []any{map[string]any{"id": 1}, map[string]any{"id": 2}, map[string]any{"id": 3}}}
+
+	tests := []struct {
+		name     string
+		data     any
+		apply    func(*Options)
+		expected string
+	}{
+		{
+			"scalar items", scalars, func(*Options) {},
+			`<tags><item index="0">a</item><item index="1">b</item><item index="2">c</item></tags>`,
+		},
+		{
+			"map items", maps, func(*Options) {},
+			`<rows><item index="0"><id>1</id></item><item index="1"><id>2</id></item><item index="2"><id>3</id></item></rows>`,
+		},
+		{
+			"with type attributes", scalars, func(o *Options) { o.AttrType = true },
+			`<tags type="list"><item index="0" type="str">a</item><item index="1" type="str">b</item><item index="2" type="str">c</item></tags>`,
+		},
+		{
+			"unwrapped scalars", scalars, func(o *Options) { o.ItemWrap = false },
+			`<tags index="0">a</tags><tags index="1">b</tags><tags index="2">c</tags>`,
+		},
+		{
+			"list headers", maps, func(o *Options) { o.ListHeaders = true },
+			`<rows index="0"><id>1</id></rows><rows index="1"><id>2</id></rows><rows index="2"><id>3</id></rows>`,
+		},
+		{
+			"list headers unwrapped", maps, func(o *Options) { o.ListHeaders, o.ItemWrap = true, false },
+			`<rows index="0"><id>1</id></rows><rows index="1"><id>2</id></rows><rows index="2"><id>3</id></rows>`,
+		},
+		{
+			"nested lists count separately", map[string]any{"m": []any{[]any{"x", "y"}, "z"}}, func(*Options) {},
+			`<m><item index="0"><item index="0">x</item><item index="1">y</item></item><item index="1">z</item></m>`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := DefaultOptions()
+			opts.Root = false
+			opts.AttrType = false
+			opts.ItemIndexAttr = "index"
+			tt.apply(&opts)
+			result := string(DictToXML(tt.data, opts))
+			if result != tt.expected {
+				t.Errorf("expected %s, got %s", tt.expected, result)
+			}
+		})
+	}
+
+	t.Run("NDJSON records", func(t *testing.T) {
 		opts := DefaultOptions()
 		opts.Root = false
 		opts.AttrType = false
-		result := DictToXML(data, opts)
-
-		if !strings.Contains(string(result), "<person>") || !strings.Contains(string(result), "<name>John</name>") {
-			t.Errorf("expected nested structure, got %s", string(result))
+		opts.ItemIndexAttr = "n"
+		var buf bytes.Buffer
+		if err := ConvertNDJSON(strings.NewReader("1\n\n2\n"), &buf, opts); err != nil {
+			t.Fatal(err)
+		}
+		expected := "<item n=\"0\">1</item>\n<item n=\"1\">2</item>\n"
+		if buf.String() != expected {
+			t.Errorf("expected %q, got %q", expected, buf.String())
 		}
 	})
+}
 
-	t.Run("ampersand in value", func(t *testing.T) {
-		data := map[string]any{"Bicycles": "Wheels & Steers"}
+func TestCollapseSingleItemLists(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     map[string]any
+		expected string
+	}{
+		{"one item", map[string]any{"tags": []any{"a"}}, `<tags type="str">a</tags>`},
+		{"no items", map[string]any{"tags": []any{}}, `<tags type="list"></tags>`},
+		{"two items", map[string]any{"tags": []any{"a", "b"}}, `<tags type="list"><item type="str">a</item><item type="str">b</item></tags>`},
+		{"one map", map[string]any{"owner": []any{map[string]any{"id": 1}}}, `<owner type="dict"><id type="int">1</id></owner>`},
+		{"nested", map[string]any{"m": []any{[]any{3}}}, `<m type="int">3</m>`},
+		{"typed slice", map[string]any{"ids": []int{7}}, `<ids type="int">7</ids>`},
+		{"inside lists", map[string]any{"m": []any{[]any{1}, 2}}, `<m type="list"><item type="list"><item type="int">1</item></item><item type="int">2</item></m>`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := DefaultOptions()
+			opts.Root = false
+			opts.CollapseSingleItemLists = true
+			result := string(DictToXML(tt.data, opts))
+			if result != tt.expected {
+				t.Errorf("expected %s, got %s", tt.expected, result)
+			}
+		})
+	}
+
+	t.Run("off by default", func(t *testing.T) {
 		opts := DefaultOptions()
 		opts.Root = false
 		opts.AttrType = false
-		result := DictToXML(data, opts)
-
-		expected := "<Bicycles>Wheels &amp; Steers</Bicycles>"
-		if string(result) != expected {
-			t.Errorf("expected %s, got %s", expected, string(result))
+		if result := string(DictToXML(map[string]any{"tags": []any{"a"}}, opts)); result != `<tags><item>a</item></tags>` {
+			t.Errorf("expected the list to stay, got %s", result)
 		}
 	})
 
-	t.Run("datetime conversion", func(t *testing.T) {
-		dt := time.Date(2023, 2, 15, 12, 30, 45, 0, time.UTC)
-		data := map[string]any{"key": dt}
+	t.Run("schema matches", func(t *testing.T) {
 		opts := DefaultOptions()
-		opts.AttrType = false
-		result := DictToXML(data, opts)
-
-		if !strings.Contains(string(result), "2023-02-15") {
-			t.Errorf("expected datetime in ISO format, got %s", string(result))
+		opts.CollapseSingleItemLists = true
+		xsd, err := GenerateXSD(map[string]any{"tags": []any{"a"}}, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.Contains(string(xsd), `name="item"`) {
+			t.Errorf("expected no item element, got %s", xsd)
 		}
 	})
+}
 
-	t.Run("list with dict items", func(t *testing.T) {
-		data := map[string]any{
-			"items": []any{
-				map[string]any{"key1": "value1"},
-				map[string]any{"key2": "value2"},
-			},
-		}
-		opts := DefaultOptions()
-		opts.Root = false
-		opts.AttrType = false
-		result := DictToXML(data, opts)
+func TestEmptyStringAsNull(t *testing.T) {
+	opts := DefaultOptions()
+	opts.Root = false
 
-		if !strings.Contains(string(result), "<item><key1>value1</key1></item>") {
-			t.Errorf("expected item wrapped dicts, got %s", string(result))
+	t.Run("off by default", func(t *testing.T) {
+		result := string(DictToXML(map[string]any{"x": ""}, opts))
+		if result != `<x type="str"></x>` {
+			t.Errorf("unexpected output %s", result)
 		}
 	})
 
-	t.Run("CDATA wrapping", func(t *testing.T) {
-		data := map[string]any{"key": "value"}
-		opts := DefaultOptions()
-		opts.Root = false
-		opts.AttrType = false
-		opts.CDATA = true
-		result := DictToXML(data, opts)
+	opts.EmptyStringAsNull = true
 
-		if !strings.Contains(string(result), "<![CDATA[value]]>") {
-			t.Errorf("expected CDATA wrapped value, got %s", string(result))
+	tests := []struct {
+		name     string
+		data     any
+		modify   func(*Options)
+		expected string
+	}{
+		{"map value", map[string]any{"x": "", "y": " "}, nil, `<x type="null"></x><y type="str"> </y>`},
+		{"list items", map[string]any{"v": []any{"", "a"}}, nil, `<v type="list"><item type="null"></item><item type="str">a</item></v>`},
+		{"with NilAttr", map[string]any{"x": ""}, func(o *Options) { o.AttrType = false; o.NilAttr = "xsi:nil" }, `<x xsi:nil="true"></x>`},
+		{"unwrapped list", map[string]any{"v": []any{""}}, func(o *Options) { o.AttrType = false; o.ItemWrap = false; o.NilAttr = "nil" }, `<v nil="true"></v>`},
+		{"map entries", map[string]any{"m": map[string]any{"x": ""}}, func(o *Options) { o.AttrType = false; o.MapAsEntries = true }, `<entry key="m"><entry key="x"/></entry>`},
+		{"XPath", map[string]any{"x": ""}, func(o *Options) { o.XPathFormat = true }, `<?xml version="1.0" encoding="UTF-8" ?><map xmlns="http://www.w3.org/2005/xpath-functions"><null key="x"/></map>`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := opts
+			if tt.modify != nil {
+				tt.modify(&opts)
+			}
+			result := string(DictToXML(tt.data, opts))
+			if result != tt.expected {
+				t.Errorf("expected %s, got %s", tt.expected, result)
+			}
+		})
+	}
+
+	t.Run("root", func(t *testing.T) {
+		opts := DefaultOptions()
+		opts.EmptyStringAsNull = true
+		result := string(DictToXML("", opts))
+		if !strings.Contains(result, `<root type="null"></root>`) {
+			t.Errorf("expected a null root, got %s", result)
 		}
 	})
 }
 
-func TestDictToXMLXPathFormat(t *testing.T) {
-	t.Run("basic types", func(t *testing.T) {
-		data := map[string]any{"name": "John", "age": 30, "active": true}
-		opts := DefaultOptions()
-		opts.XPathFormat = true
-		result := DictToXML(data, opts)
+func TestTypeElementNames(t *testing.T) {
+	names := map[string]string{"str": "string", "int": "number", "float": "number", "bool": "boolean", "null": "null"}
+	data := map[string]any{"v": []any{"a", 1, 2.5, true, nil, map[string]any{"k": "x"}, []any{"b"}}}
+	opts := DefaultOptions()
+	opts.Root = false
+	opts.AttrType = false
+	opts.TypeElementNames = names
+
+	result := string(DictToXML(data, opts))
+	expected := `<v><string>a</string><number>1</number><number>2.5</number><boolean>true</boolean><null></null>` +
+		`<item><k>x</k></item><item><string>b</string></item></v>`
+	if result != expected {
+		t.Errorf("expected %s, got %s", expected, result)
+	}
 
-		if !bytes.Contains(result, []byte(`xmlns="http://www.w3.org/2005/xpath-functions"`)) {
-			t.Errorf("expected XPath namespace, got %s", string(result))
-		}
-		if !bytes.Contains(result, []byte(`<string key="name">John</string>`)) {
-			t.Errorf("expected string element, got %s", string(result))
-		}
-		if !bytes.Contains(result, []byte(`<number key="age">30</number>`)) {
-			t.Errorf("expected number element, got %s", string(result))
-		}
-		if !bytes.Contains(result, []byte(`<boolean key="active">true</boolean>`)) {
-			t.Errorf("expected boolean element, got %s", string(result))
+	t.Run("type attributes still written", func(t *testing.T) {
+		opts := opts
+		opts.AttrType = true
+		result := string(DictToXML(map[string]any{"v": []any{"a", 1}}, opts))
+		expected := `<v type="list"><string type="str">a</string><number type="int">1</number></v>`
+		if result != expected {
+			t.Errorf("expected %s, got %s", expected, result)
 		}
 	})
 
-	t.Run("nested dict", func(t *testing.T) {
-		data := map[string]any{
-			"person": map[string]any{"name": "Alice", "age": 25},
+	t.Run("detailed types and dates", func(t *testing.T) {
+		opts := opts
+		opts.DetailedTypes = true
+		opts.DetectDates = true
+		opts.TypeElementNames = map[string]string{"int64": "long", "date": "day"}
+		result := string(DictToXML(map[string]any{"v": []any{int64(7), "2024-01-02", "a"}}, opts))
+		expected := `<v><long>7</long><day>2024-01-02</day><item>a</item></v>`
+		if result != expected {
+			t.Errorf("expected %s, got %s", expected, result)
 		}
-		opts := DefaultOptions()
-		opts.XPathFormat = true
-		result := DictToXML(data, opts)
+	})
 
-		if !bytes.Contains(result, []byte(`<map key="person">`)) {
-			t.Errorf("expected nested map, got %s", string(result))
+	t.Run("indexed names take precedence", func(t *testing.T) {
+		opts := opts
+		opts.ArrayAsIndexedObject = true
+		result := string(DictToXML(map[string]any{"v": []any{"a"}}, opts))
+		if result != `<v><_0>a</_0></v>` {
+			t.Errorf("unexpected output %s", result)
 		}
 	})
 
-	t.Run("array", func(t *testing.T) {
-		data := map[string]any{"numbers": []any{1, 2, 3}}
-		opts := DefaultOptions()
-		opts.XPathFormat = true
-		result := DictToXML(data, opts)
-
-		if !bytes.Contains(result, []byte(`<array key="numbers">`)) {
-			t.Errorf("expected array element, got %s", string(result))
+	t.Run("empty strings as null", func(t *testing.T) {
+		opts := opts
+		opts.EmptyStringAsNull = true
+		result := string(DictToXML(map[string]any{"v": []any{"", "a"}}, opts))
+		if result != `<v><null></null><string>a</string></v>` {
+			t.Errorf("unexpected output %s", result)
 		}
 	})
+}
 
-	t.Run("null value", func(t *testing.T) {
-		data := map[string]any{"value": nil}
-		opts := DefaultOptions()
-		opts.XPathFormat = true
-		result := DictToXML(data, opts)
+func TestBigNumbers(t *testing.T) {
+	huge, _ := new(big.Int).SetString("123456789012345678901234567890", 10)
+	negative, _ := new(big.Int).SetString("-98765432109876543210", 10)
+	price, _ := new(big.Float).SetPrec(200).SetString("12345678901234567890.123456789")
+	third := new(big.Float).SetPrec(100).Quo(big.NewFloat(1), big.NewFloat(3))
 
-		if !bytes.Contains(result, []byte(`<null key="value"/>`)) {
-			t.Errorf("expected null element, got %s", string(result))
-		}
-	})
+	opts := DefaultOptions()
+	opts.Root = false
 
-	t.Run("root level array", func(t *testing.T) {
-		data := []any{1, 2, 3}
-		opts := DefaultOptions()
-		opts.XPathFormat = true
-		result := DictToXML(data, opts)
+	tests := []struct {
+		name     string
+		data     any
+		expected string
+	}{
+		{"big.Int", map[string]any{"n": huge}, `<n type="int">123456789012345678901234567890</n>`},
+		{"negative big.Int", map[string]any{"n": negative}, `<n type="int">-98765432109876543210</n>`},
+		{"big.Int value", map[string]any{"n": *big.NewInt(42)}, `<n type="int">42</n>`},
+		{"big.Float", map[string]any{"p": price}, `<p type="float">12345678901234567890.123456789</p>`},
+		{"integral big.Float", map[string]any{"p": big.NewFloat(3)}, `<p type="float">3</p>`},
+		{"list", []any{huge, third}, `<item type="int">123456789012345678901234567890</item><item type="float">` + third.Text('f', -1) + `</item>`},
+		{"nil pointer", map[string]any{"n": (*big.Int)(nil)}, `<n type="null"></n>`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := string(DictToXML(tt.data, opts))
+			if result != tt.expected {
+				t.Errorf("expected %s, got %s", tt.expected, result)
+			}
+		})
+	}
 
-		if !bytes.Contains(result, []byte(`<array xmlns="http://www.w3.org/2005/xpath-functions">`)) {
-			t.Errorf("expected array with namespace, got %s", string(result))
+	t.Run("attribute", func(t *testing.T) {
+		opts := opts
+		opts.AttrType = false
+		data := map[string]any{"p": map[string]any{"@attrs": map[string]any{"amount": price}, "@val": "x"}}
+		result := string(DictToXML(data, opts))
+		if result != `<p amount="12345678901234567890.123456789">x</p>` {
+			t.Errorf("unexpected output %s", result)
 		}
 	})
-}
 
-func TestListHeaders(t *testing.T) {
-	t.Run("list headers true", func(t *testing.T) {
-		data := map[string]any{
-			"Bike": []any{
-				map[string]any{"frame_color": "red"},
-				map[string]any{"frame_color": "green"},
-			},
+	t.Run("struct field", func(t *testing.T) {
+		type account struct {
+			Balance *big.Int
 		}
-		opts := DefaultOptions()
-		opts.Root = false
-		opts.AttrType = false
-		opts.ItemWrap = false
-		opts.ListHeaders = true
-		result := DictToXML(data, opts)
-
-		expected := "<Bike><frame_color>red</frame_color></Bike><Bike><frame_color>green</frame_color></Bike>"
-		if string(result) != expected {
-			t.Errorf("expected %s, got %s", expected, string(result))
+		result := string(DictToXML(account{Balance: huge}, opts))
+		if result != `<Balance type="int">123456789012345678901234567890</Balance>` {
+			t.Errorf("unexpected output %s", result)
 		}
 	})
-}
 
-func TestFlatList(t *testing.T) {
-	t.Run("flat list notation", func(t *testing.T) {
-		data := map[string]any{
-			"flat_list@flat": []any{1, 2, 3},
-			"non_flat_list":  []any{4, 5, 6},
+	t.Run("root", func(t *testing.T) {
+		result := string(DictToXML(huge, DefaultOptions()))
+		if !strings.Contains(result, `<root type="int">123456789012345678901234567890</root>`) {
+			t.Errorf("unexpected output %s", result)
 		}
-		opts := DefaultOptions()
-		opts.AttrType = false
-		result := DictToXML(data, opts)
+	})
 
-		// flat_list should not be wrapped
-		if !strings.Contains(string(result), "<item>1</item><item>2</item><item>3</item>") {
-			t.Errorf("expected flat list items, got %s", string(result))
-		}
-		// non_flat_list should be wrapped
-		if !strings.Contains(string(result), "<non_flat_list><item>4</item><item>5</item><item>6</item></non_flat_list>") {
-			t.Errorf("expected wrapped list, got %s", string(result))
+	t.Run("Convert", func(t *testing.T) {
+		result := Convert(huge, opts, "n")
+		if result != `<item type="int">123456789012345678901234567890</item>` {
+			t.Errorf("unexpected output %s", result)
 		}
 	})
-}
 
-func TestCustomItemFunc(t *testing.T) {
-	t.Run("custom item function", func(t *testing.T) {
-		data := map[string]any{"items": []any{1, 2, 3}}
-		opts := DefaultOptions()
-		opts.Root = false
-		opts.AttrType = false
-		opts.ItemFunc = func(parent string) string {
-			return "custom"
+	t.Run("infinite big.Float", func(t *testing.T) {
+		inf := new(big.Float).SetInf(false)
+		for _, data := range []any{
+			map[string]any{"p": inf},
+			[]any{*new(big.Float).SetInf(true)},
+			inf,
+		} {
+			if _, err := DictToXMLErr(data, opts); !errors.Is(err, ErrInvalidData) {
+				t.Errorf("%v: expected ErrInvalidData, got %v", data, err)
+			}
 		}
-		result := DictToXML(data, opts)
+	})
 
-		if !strings.Contains(string(result), "<custom>") {
-			t.Errorf("expected custom item names, got %s", string(result))
+	t.Run("XPath", func(t *testing.T) {
+		opts := opts
+		opts.XPathFormat = true
+		result := string(DictToXML(map[string]any{"n": huge}, opts))
+		if !strings.Contains(result, `<number key="n">123456789012345678901234567890</number>`) {
+			t.Errorf("unexpected output %s", result)
 		}
 	})
 }
 
-func TestPrettyPrint(t *testing.T) {
-	t.Run("formats XML with indentation", func(t *testing.T) {
-		input := []byte(`<?xml version="1.0" encoding="UTF-8" ?><root><child>value</child></root>`)
-		result, err := PrettyPrint(input)
+func TestInvalidAttrNames(t *testing.T) {
+	opts := DefaultOptions()
+	opts.Root = false
+	opts.AttrType = false
+
+	t.Run("prefixed keys stay children", func(t *testing.T) {
+		opts := opts
+		opts.AttrPrefix = "@"
+		result, err := DictToXMLErr(map[string]any{"a": map[string]any{"@a b": 1, "@id": 7}}, opts)
 		if err != nil {
 			t.Fatalf("expected no error, got %v", err)
 		}
+		if expected := `<a id="7"><key name="@a b">1</key></a>`; string(result) != expected {
+			t.Errorf("expected %s, got %s", expected, result)
+		}
+		if err := ValidateXML(result); err != nil {
+			t.Errorf("expected well-formed output, got %v", err)
+		}
+	})
 
-		if !strings.Contains(result, "\n") {
-			t.Errorf("expected formatted output with newlines, got %s", result)
+	for name, attrs := range map[string]any{
+		"@attrs map":  map[string]any{"a b": 1},
+		"pairs":       []any{[]any{"ok", 1}, []any{"1st", 2}},
+		"Attr values": []Attr{{Name: "a=b", Value: 1}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			data := map[string]any{"a": map[string]any{"@attrs": attrs, "@val": "v"}}
+			if _, err := DictToXMLErr(data, opts); !errors.Is(err, ErrInvalidData) {
+				t.Errorf("expected ErrInvalidData, got %v", err)
+			}
+			if result := DictToXML(data, opts); result == nil {
+				t.Error("expected DictToXML to drop the attribute and write the element")
+			}
+		})
+	}
+
+	t.Run("NameValidator decides", func(t *testing.T) {
+		opts := opts
+		opts.NameValidator = func(name string) bool { return !strings.HasPrefix(name, "x") }
+		data := map[string]any{"a": map[string]any{"@attrs": map[string]any{"xid": 1}, "@val": "v"}}
+		if _, err := DictToXMLErr(data, opts); !errors.Is(err, ErrInvalidData) {
+			t.Errorf("expected ErrInvalidData, got %v", err)
 		}
 	})
 }
 
+func TestPythonCompatOptions(t *testing.T) {
+	data, err := ReadFromJSONUseNumber("testdata/python_compat.json")
+	if err != nil {
+		t.Fatalf("failed to read input: %v", err)
+	}
+	golden, err := os.ReadFile("testdata/python_compat.xml")
+	if err != nil {
+		t.Fatalf("failed to read golden file: %v", err)
+	}
+
+	result := DictToXML(data, PythonCompatOptions())
+	if expected := bytes.TrimSpace(golden); !bytes.Equal(result, expected) {
+		t.Errorf("output differs from Python json2xml\nexpected: %s\ngot:      %s", expected, result)
+	}
+}
+
 // Fuzz tests for dicttoxml functions
 
 func FuzzEscapeXML(f *testing.F) {
@@ -742,8 +3602,14 @@ func FuzzEscapeXML(f *testing.F) {
 		if strings.Contains(result, "<") && !strings.Contains(result, "&lt;") {
 			// this is fine, we only escape < to &lt;
 		}
-		// should not panic, that's the main check
-		_ = result
+
+		// sanitized text must always be valid element content
+		for _, mode := range []InvalidCharMode{InvalidCharDrop, InvalidCharReplace} {
+			doc := "<a>" + EscapeXML(SanitizeXMLText(input, mode)) + "</a>"
+			if err := checkWellFormed([]byte(doc)); err != nil {
+				t.Errorf("mode %d: sanitized %q is not valid XML: %v", mode, input, err)
+			}
+		}
 	})
 }
 
@@ -0,0 +1,78 @@
+package json2xml
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"io"
+)
+
+// Document is converted data that implements xml.Marshaler, so that it can
+// be embedded in a document built with encoding/xml:
+//
+//	type Envelope struct {
+//		XMLName xml.Name          `xml:"envelope"`
+//		Payload json2xml.Document `xml:"payload"`
+//	}
+//
+// The element is named like any other marshaled value, by the field name,
+// tag or XMLName, and holds Data converted with Opts as if Root were
+// false. Root, CustomRoot and the other root element options, the XML
+// declaration and namespace declarations are not written; declare
+// namespaces on an enclosing element instead. CDATA sections are written
+// as escaped text.
+type Document struct {
+	Data any
+	Opts Options
+}
+
+// MarshalXML implements xml.Marshaler, writing the converted data as the
+// content of start.
+func (d Document) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	opts := d.Opts
+	opts.Root = false
+	opts.Minify = false
+	content, err := DictToXMLErr(d.Data, opts)
+	if err != nil {
+		return err
+	}
+
+	if err := e.EncodeToken(start); err != nil {
+		return err
+	}
+	decoder := xml.NewDecoder(bytes.NewReader(content))
+	for {
+		tok, err := decoder.RawToken()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if tok = documentToken(tok); tok != nil {
+			if err := e.EncodeToken(tok); err != nil {
+				return err
+			}
+		}
+	}
+	return e.EncodeToken(start.End())
+}
+
+// documentToken prepares a raw token of converted output for an encoder.
+// Prefixed names are passed as written, since the encoder would otherwise
+// treat the prefix as a namespace URL and declare it.
+func documentToken(tok xml.Token) xml.Token {
+	switch t := tok.(type) {
+	case xml.StartElement:
+		start := xml.StartElement{Name: xml.Name{Local: qualifiedName(t.Name)}}
+		for _, attr := range t.Attr {
+			start.Attr = append(start.Attr, xml.Attr{Name: xml.Name{Local: qualifiedName(attr.Name)}, Value: attr.Value})
+		}
+		return start
+	case xml.EndElement:
+		return xml.EndElement{Name: xml.Name{Local: qualifiedName(t.Name)}}
+	case xml.CharData:
+		return t.Copy()
+	}
+	return nil
+}
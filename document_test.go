@@ -0,0 +1,88 @@
+package json2xml
+
+import (
+	"encoding/xml"
+	"errors"
+	"strings"
+	"testing"
+)
+
+type envelope struct {
+	XMLName xml.Name `xml:"envelope"`
+	ID      string   `xml:"id,attr"`
+	Body    Document `xml:"body"`
+}
+
+func TestDocumentMarshalXML(t *testing.T) {
+	opts := DefaultOptions()
+	opts.AttrType = false
+	doc := Document{Data: map[string]any{"name": "a<b", "tags": []any{"x", "y"}}, Opts: opts}
+
+	got, err := xml.Marshal(envelope{ID: "7", Body: doc})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	want := `<envelope id="7"><body><name>a&lt;b</name><tags><item>x</item><item>y</item></tags></body></envelope>`
+	if string(got) != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+
+	t.Run("matches conversion", func(t *testing.T) {
+		opts := DefaultOptions()
+		opts.Root = false
+		fragment, err := DictToXMLErr(doc.Data, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := xml.Marshal(struct {
+			XMLName xml.Name `xml:"wrap"`
+			Doc     Document
+		}{Doc: Document{Data: doc.Data, Opts: DefaultOptions()}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := "<wrap><Doc>" + string(fragment) + "</Doc></wrap>"; string(got) != want {
+			t.Errorf("got %s, want %s", got, want)
+		}
+	})
+
+	t.Run("indent", func(t *testing.T) {
+		got, err := xml.MarshalIndent(envelope{Body: Document{Data: map[string]any{"a": 1}, Opts: opts}}, "", "  ")
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := "<envelope id=\"\">\n  <body>\n    <a>1</a>\n  </body>\n</envelope>"
+		if string(got) != want {
+			t.Errorf("got %q, want %q", got, want)
+		}
+	})
+
+	t.Run("prefixed names", func(t *testing.T) {
+		opts := opts
+		opts.NilAttr = "xsi:nil"
+		got, err := xml.Marshal(envelope{Body: Document{Data: map[string]any{"ns:a": nil}, Opts: opts}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(string(got), `<ns:a xsi:nil="true"></ns:a>`) {
+			t.Errorf("unexpected output %s", got)
+		}
+	})
+
+	t.Run("nil data", func(t *testing.T) {
+		got, err := xml.Marshal(envelope{Body: Document{Opts: opts}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := `<envelope id=""><body><item></item></body></envelope>`; string(got) != want {
+			t.Errorf("got %s, want %s", got, want)
+		}
+	})
+
+	t.Run("conversion error", func(t *testing.T) {
+		_, err := xml.Marshal(envelope{Body: Document{Data: map[string]any{"f": func() {}}, Opts: opts}})
+		if !errors.Is(err, ErrInvalidData) {
+			t.Errorf("expected ErrInvalidData, got %v", err)
+		}
+	})
+}
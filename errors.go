@@ -8,6 +8,9 @@ var (
 	// ErrJSONRead is returned when there is an error reading JSON data.
 	ErrJSONRead = errors.New("invalid JSON file")
 
+	// ErrYAMLRead is returned when there is an error reading YAML data.
+	ErrYAMLRead = errors.New("invalid YAML data")
+
 	// ErrInvalidData is returned when the data is invalid.
 	ErrInvalidData = errors.New("invalid data")
 
@@ -16,4 +19,19 @@ var (
 
 	// ErrStringRead is returned when there is an error reading from a string.
 	ErrStringRead = errors.New("input is not a proper JSON string")
+
+	// ErrUnsupportedType is returned when a value's kind is not allowed by Options.AllowedKinds.
+	ErrUnsupportedType = errors.New("unsupported value type")
+
+	// ErrMaxDepth is returned when data is nested deeper than Options.MaxDepth,
+	// which includes data that contains itself.
+	ErrMaxDepth = errors.New("maximum nesting depth exceeded")
+
+	// ErrDuplicateName is returned when keys collide on one element name
+	// and Options.OnDuplicateName is DuplicateNameError.
+	ErrDuplicateName = errors.New("duplicate element name")
+
+	// ErrUndeclaredPrefix is returned when an element name uses a namespace
+	// prefix that is not declared and Options.StrictNamespaces is set.
+	ErrUndeclaredPrefix = errors.New("undeclared namespace prefix")
 )
@@ -1,3 +1,8 @@
 module github.com/vinitkumar/json2xml-go
 
 go 1.25.4
+
+require (
+	golang.org/x/text v0.41.0
+	gopkg.in/yaml.v3 v3.0.1
+)
@@ -22,6 +22,11 @@ package json2xml
 
 import (
 	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"reflect"
 )
 
 // Version information
@@ -33,15 +38,35 @@ const (
 
 // JSON2xml is the main converter struct.
 type JSON2xml struct {
-	data        any
-	wrapper     string
-	root        bool
-	pretty      bool
-	attrType    bool
-	itemWrap    bool
-	cdata       bool
-	listHeaders bool
-	xpathFormat bool
+	data          any
+	wrapper       string
+	root          bool
+	pretty        bool
+	attrType      bool
+	itemWrap      bool
+	cdata         bool
+	cdataAuto     bool
+	listHeaders   bool
+	xpathFormat   bool
+	ids           bool
+	idSeed        *int64
+	namespaces    map[string]any
+	itemFunc      ItemFunc
+	prefix        string
+	indent        string
+	selfClose     bool
+	declaration   *string
+	stylesheet    string
+	subtree       *string
+	timeLayout    string
+	compactLeaves bool
+	boolStrings   [2]string
+	minify        bool
+	sortKeys      bool
+	allowedKinds  []reflect.Kind
+	// base holds the options the builder has no method for, set by
+	// NewWithOptions.
+	base Options
 }
 
 // New creates a new JSON2xml converter with default options.
@@ -56,15 +81,56 @@ func New(data any) *JSON2xml {
 		cdata:       false,
 		listHeaders: false,
 		xpathFormat: false,
+		indent:      "  ",
+		sortKeys:    true,
 	}
 }
 
+// NewWithOptions creates a converter configured by opts, for callers that
+// already build Options for the package-level functions. The output is
+// pretty-printed unless opts.Minify is set; the With methods adjust the
+// configuration as usual.
+func NewWithOptions(data any, opts Options) *JSON2xml {
+	j := New(data)
+	j.base = opts
+	j.wrapper = opts.CustomRoot
+	j.root = opts.Root
+	j.attrType = opts.AttrType
+	j.itemWrap = opts.ItemWrap
+	j.itemFunc = opts.ItemFunc
+	j.cdata = opts.CDATA
+	j.cdataAuto = opts.CDATAAuto
+	j.listHeaders = opts.ListHeaders
+	j.xpathFormat = opts.XPathFormat
+	j.ids = opts.IDs
+	j.namespaces = opts.XMLNamespaces
+	j.selfClose = opts.SelfCloseEmpty
+	j.declaration = opts.XMLDeclaration
+	j.stylesheet = opts.StylesheetHref
+	j.timeLayout = opts.TimeLayout
+	j.compactLeaves = opts.CompactLeaves
+	j.boolStrings = opts.BoolStrings
+	j.minify = opts.Minify
+	j.sortKeys = opts.SortKeys
+	j.allowedKinds = opts.AllowedKinds
+	return j
+}
+
 // WithWrapper sets a custom wrapper element name.
+// The builder defaults to "all"; DefaultOptions, used by ConvertToXML and
+// DictToXML callers, defaults to "root". The name is only emitted when
+// WithRoot is true.
 func (j *JSON2xml) WithWrapper(wrapper string) *JSON2xml {
 	j.wrapper = wrapper
 	return j
 }
 
+// WithCustomRoot sets the root element name. It is an alias for WithWrapper
+// named after Options.CustomRoot.
+func (j *JSON2xml) WithCustomRoot(name string) *JSON2xml {
+	return j.WithWrapper(name)
+}
+
 // WithRoot sets whether to include root element.
 func (j *JSON2xml) WithRoot(root bool) *JSON2xml {
 	j.root = root
@@ -101,35 +167,164 @@ func (j *JSON2xml) WithCDATA(cdata bool) *JSON2xml {
 	return j
 }
 
+// WithCDATAAuto sets whether to wrap only string values containing markup
+// characters in CDATA sections (see Options.CDATAAuto).
+func (j *JSON2xml) WithCDATAAuto(cdataAuto bool) *JSON2xml {
+	j.cdataAuto = cdataAuto
+	return j
+}
+
 // WithListHeaders sets whether to repeat headers for each list item.
 func (j *JSON2xml) WithListHeaders(listHeaders bool) *JSON2xml {
 	j.listHeaders = listHeaders
 	return j
 }
 
+// WithIDs sets whether elements get unique id attributes.
+func (j *JSON2xml) WithIDs(ids bool) *JSON2xml {
+	j.ids = ids
+	return j
+}
+
+// WithIDSeed makes generated IDs deterministic: every conversion with the
+// same seed produces the same IDs.
+func (j *JSON2xml) WithIDSeed(seed int64) *JSON2xml {
+	j.idSeed = &seed
+	return j
+}
+
+// WithNamespaces sets the XML namespace declarations added to the root
+// element. Keys are prefixes; "xmlns" sets the default namespace and "xsi"
+// takes a map with schemaInstance and schemaLocation entries. Namespaces
+// are only emitted when a root element is.
+func (j *JSON2xml) WithNamespaces(namespaces map[string]any) *JSON2xml {
+	j.namespaces = namespaces
+	return j
+}
+
+// WithItemFunc sets the function that names list item elements.
+// A nil function restores DefaultItemFunc.
+func (j *JSON2xml) WithItemFunc(itemFunc ItemFunc) *JSON2xml {
+	j.itemFunc = itemFunc
+	return j
+}
+
+// WithSelfClose sets whether null values and empty strings are written as
+// self-closing elements.
+func (j *JSON2xml) WithSelfClose(selfClose bool) *JSON2xml {
+	j.selfClose = selfClose
+	return j
+}
+
+// WithIndent sets the line prefix and indentation used when pretty-printing.
+// The default is no prefix and two spaces.
+func (j *JSON2xml) WithIndent(prefix, indent string) *JSON2xml {
+	j.prefix = prefix
+	j.indent = indent
+	return j
+}
+
+// WithDeclaration replaces the XML declaration written before the root
+// element with decl, which is used as-is.
+func (j *JSON2xml) WithDeclaration(decl string) *JSON2xml {
+	j.declaration = &decl
+	return j
+}
+
+// WithoutDeclaration omits the XML declaration.
+func (j *JSON2xml) WithoutDeclaration() *JSON2xml {
+	return j.WithDeclaration("")
+}
+
+// WithStylesheet adds an xml-stylesheet processing instruction pointing
+// to the XSLT stylesheet at href (see Options.StylesheetHref).
+func (j *JSON2xml) WithStylesheet(href string) *JSON2xml {
+	j.stylesheet = href
+	return j
+}
+
+// WithSubtree converts only the part of the data that the JSON Pointer
+// selects (see SelectSubtree). The pointer is resolved on conversion, and
+// a pointer that does not resolve makes the conversion fail.
+func (j *JSON2xml) WithSubtree(pointer string) *JSON2xml {
+	j.subtree = &pointer
+	return j
+}
+
+// selected returns the data to convert, applying WithSubtree.
+func (j *JSON2xml) selected() (any, error) {
+	if j.subtree == nil || j.data == nil {
+		return j.data, nil
+	}
+	return SelectSubtree(j.data, *j.subtree)
+}
+
+// WithTimeLayout sets the time.Format layout for time.Time values.
+// The default is time.RFC3339.
+func (j *JSON2xml) WithTimeLayout(layout string) *JSON2xml {
+	j.timeLayout = layout
+	return j
+}
+
+// WithBoolStrings sets the texts written for true and false values,
+// such as "1" and "0" or "yes" and "no".
+func (j *JSON2xml) WithBoolStrings(trueStr, falseStr string) *JSON2xml {
+	j.boolStrings = [2]string{trueStr, falseStr}
+	return j
+}
+
+// WithCompactLeaves sets whether pretty-printing drops whitespace-only
+// text spanning lines (see Options.CompactLeaves).
+func (j *JSON2xml) WithCompactLeaves(compact bool) *JSON2xml {
+	j.compactLeaves = compact
+	return j
+}
+
+// WithMinify sets whether the output is minified (see Options.Minify).
+// Minified output is never pretty-printed, whatever WithPretty says.
+func (j *JSON2xml) WithMinify(minify bool) *JSON2xml {
+	j.minify = minify
+	return j
+}
+
+// WithSortKeys sets whether map keys are written in sorted order (default
+// true). Turning it off keeps the key order of OrderedMap values, such as
+// those decoded by ReadFromStringOrdered (see Options.SortKeys).
+func (j *JSON2xml) WithSortKeys(sortKeys bool) *JSON2xml {
+	j.sortKeys = sortKeys
+	return j
+}
+
+// WithAllowedKinds restricts the value kinds the data may hold, failing
+// the conversion with ErrUnsupportedType on any other kind (see
+// Options.AllowedKinds).
+func (j *JSON2xml) WithAllowedKinds(kinds ...reflect.Kind) *JSON2xml {
+	j.allowedKinds = kinds
+	return j
+}
+
 // ToXML converts the data to XML.
-// Returns the XML as a string when pretty=true, or as bytes when pretty=false.
-// Returns nil only when data is nil.
+// Returns the XML as a string when pretty=true, or as bytes when pretty=false
+// or the output is minified.
+// Returns nil only when data (or the selected subtree) is nil.
 func (j *JSON2xml) ToXML() (any, error) {
-	if j.data == nil {
-		return nil, nil
+	data, err := j.selected()
+	if data == nil || err != nil {
+		return nil, err
 	}
 
-	opts := Options{
-		Root:        j.root,
-		CustomRoot:  j.wrapper,
-		AttrType:    j.attrType,
-		ItemWrap:    j.itemWrap,
-		ItemFunc:    DefaultItemFunc,
-		CDATA:       j.cdata,
-		ListHeaders: j.listHeaders,
-		XPathFormat: j.xpathFormat,
+	xmlData, err := DictToXMLErr(data, j.options())
+	if err != nil {
+		return nil, err
 	}
+	return j.format(xmlData)
+}
 
-	xmlData := DictToXML(j.data, opts)
-
-	if j.pretty {
-		prettyXML, err := PrettyPrint(xmlData)
+// format pretty-prints xmlData when the builder is set to, returning a
+// string, and returns it unchanged as bytes otherwise.
+func (j *JSON2xml) format(xmlData []byte) (any, error) {
+	if j.pretty && !j.minify {
+		prettyXML, err := prettyPrint(xmlData, j.prettyConfig())
 		if err != nil {
 			return nil, fmt.Errorf("%w: %v", ErrInvalidData, err)
 		}
@@ -139,6 +334,179 @@ func (j *JSON2xml) ToXML() (any, error) {
 	return xmlData, nil
 }
 
+// ToXMLStringWithStats converts the data like ToXMLString and also returns
+// the statistics ConvertWithStats gathers, in a single conversion. Bytes
+// is the size of the returned XML, pretty-printed or not.
+func (j *JSON2xml) ToXMLStringWithStats() (string, Stats, error) {
+	data, err := j.selected()
+	if data == nil || err != nil {
+		return "", Stats{}, err
+	}
+
+	xmlData, stats, err := ConvertWithStats(data, j.options())
+	if err != nil {
+		return "", Stats{}, err
+	}
+	result, err := j.format(xmlData)
+	if err != nil {
+		return "", Stats{}, err
+	}
+	var xmlString string
+	switch v := result.(type) {
+	case string:
+		xmlString = v
+	case []byte:
+		xmlString = string(v)
+	}
+	stats.Bytes = len(xmlString)
+	return xmlString, stats, nil
+}
+
+// ToBoth converts the data once and returns both the compact XML and its
+// pretty-printed form, regardless of the pretty setting.
+// Returns nil and "" only when data (or the selected subtree) is nil.
+func (j *JSON2xml) ToBoth() (compact []byte, pretty string, err error) {
+	data, err := j.selected()
+	if data == nil || err != nil {
+		return nil, "", err
+	}
+
+	compact, err = DictToXMLErr(data, j.options())
+	if err != nil {
+		return nil, "", err
+	}
+	pretty, err = prettyPrint(compact, j.prettyConfig())
+	if err != nil {
+		return nil, "", fmt.Errorf("%w: %v", ErrInvalidData, err)
+	}
+	return compact, pretty, nil
+}
+
+// WriteTo writes the XML to w, implementing io.WriterTo. Compact output is
+// streamed as it is converted (see WriteXML); pretty-printed output is
+// converted in full first and then indented straight into w. Nothing is
+// written when data is nil.
+func (j *JSON2xml) WriteTo(w io.Writer) (int64, error) {
+	data, err := j.selected()
+	if data == nil || err != nil {
+		return 0, err
+	}
+
+	counter := &countingWriter{w: w}
+	if j.pretty && !j.minify {
+		compact, err := DictToXMLErr(data, j.options())
+		if err != nil {
+			return 0, err
+		}
+		if err := prettyPrintTo(counter, compact, j.prettyConfig()); err != nil {
+			return counter.n, fmt.Errorf("%w: %v", ErrInvalidData, err)
+		}
+		return counter.n, nil
+	}
+
+	err = WriteXML(counter, data, j.options())
+	return counter.n, err
+}
+
+// ToFile writes the XML to path with permissions perm, as WriteTo would
+// write it. The XML goes to a temporary file in the same directory that
+// replaces path only once it is complete, so a failed conversion never
+// leaves a partial file behind. An existing file at path is replaced.
+func (j *JSON2xml) ToFile(path string, perm os.FileMode) error {
+	return writeFileAtomic(path, perm, func(w io.Writer) error {
+		_, err := j.WriteTo(w)
+		return err
+	})
+}
+
+// writeFileAtomic calls write with a temporary file in the directory of
+// path and renames it to path with permissions perm once write succeeds.
+// On failure the temporary file is removed and path is left untouched.
+func writeFileAtomic(path string, perm os.FileMode, write func(io.Writer) error) (err error) {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			_ = tmp.Close()
+			_ = os.Remove(tmp.Name())
+		}
+	}()
+
+	if err = write(tmp); err != nil {
+		return err
+	}
+	if err = tmp.Chmod(perm); err != nil {
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// Reader returns the XML as a stream, written by WriteTo in a goroutine
+// through an io.Pipe, so that it can be copied into an HTTP response
+// without building the whole document first. Conversion errors are
+// returned by Read. Close the reader when not reading it to the end, such
+// as after a failed write to a disconnected client, so that the goroutine
+// stops. An error selecting the subtree is returned right away.
+func (j *JSON2xml) Reader() (io.ReadCloser, error) {
+	if _, err := j.selected(); err != nil {
+		return nil, err
+	}
+
+	pr, pw := io.Pipe()
+	go func() {
+		_, err := j.WriteTo(pw)
+		_ = pw.CloseWithError(err)
+	}()
+	return pr, nil
+}
+
+// options builds the conversion options from the builder settings.
+func (j *JSON2xml) options() Options {
+	opts := j.base
+	opts.Root = j.root
+	opts.CustomRoot = j.wrapper
+	opts.AttrType = j.attrType
+	opts.ItemWrap = j.itemWrap
+	opts.ItemFunc = j.itemFunc
+	opts.CDATA = j.cdata
+	opts.CDATAAuto = j.cdataAuto
+	opts.ListHeaders = j.listHeaders
+	opts.XPathFormat = j.xpathFormat
+	opts.IDs = j.ids
+	opts.XMLNamespaces = j.namespaces
+	opts.SelfCloseEmpty = j.selfClose
+	opts.XMLDeclaration = j.declaration
+	opts.StylesheetHref = j.stylesheet
+	opts.TimeLayout = j.timeLayout
+	opts.CompactLeaves = j.compactLeaves
+	opts.BoolStrings = j.boolStrings
+	opts.Minify = j.minify
+	opts.SortKeys = j.sortKeys
+	opts.AllowedKinds = j.allowedKinds
+	if opts.ItemFunc == nil {
+		opts.ItemFunc = DefaultItemFunc
+	}
+	if j.idSeed != nil {
+		opts.IDSource = rand.New(rand.NewSource(*j.idSeed))
+	}
+	return opts
+}
+
+// prettyConfig returns the pretty-printing settings for the builder.
+func (j *JSON2xml) prettyConfig() prettyConfig {
+	return prettyConfig{
+		prefix:        j.prefix,
+		indent:        j.indent,
+		declaration:   j.declaration,
+		compactLeaves: j.compactLeaves,
+	}
+}
+
 // ToXMLString converts the data to XML and returns it as a string.
 func (j *JSON2xml) ToXMLString() (string, error) {
 	result, err := j.ToXML()
@@ -158,6 +526,19 @@ func (j *JSON2xml) ToXMLString() (string, error) {
 	return "", nil
 }
 
+// ToXMLValidated converts the data like ToXMLString and checks the result
+// with ValidateXML, returning the XML only when it is well-formed.
+func (j *JSON2xml) ToXMLValidated() (string, error) {
+	result, err := j.ToXMLString()
+	if err != nil {
+		return "", err
+	}
+	if err := ValidateXML([]byte(result)); err != nil {
+		return "", err
+	}
+	return result, nil
+}
+
 // ToXMLBytes converts the data to XML and returns it as bytes.
 func (j *JSON2xml) ToXMLBytes() ([]byte, error) {
 	result, err := j.ToXML()
@@ -191,6 +572,5 @@ func ConvertToXML(data any, opts *Options) ([]byte, error) {
 	if opts.ItemFunc == nil {
 		opts.ItemFunc = DefaultItemFunc
 	}
-
-	return DictToXML(data, *opts), nil
+	return dictToXML(data, *opts)
 }
@@ -2,8 +2,16 @@ package json2xml
 
 import (
 	"bytes"
+	"errors"
+	"io"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
 	"strings"
 	"testing"
+	"time"
 )
 
 func TestNew(t *testing.T) {
@@ -40,6 +48,13 @@ func TestWithMethods(t *testing.T) {
 		}
 	})
 
+	t.Run("WithCustomRoot", func(t *testing.T) {
+		conv := New(nil).WithCustomRoot("custom")
+		if conv.wrapper != "custom" {
+			t.Errorf("expected wrapper 'custom', got %s", conv.wrapper)
+		}
+	})
+
 	t.Run("WithRoot", func(t *testing.T) {
 		conv := New(nil).WithRoot(false)
 		if conv.root {
@@ -82,6 +97,13 @@ func TestWithMethods(t *testing.T) {
 		}
 	})
 
+	t.Run("WithCDATAAuto", func(t *testing.T) {
+		conv := New(nil).WithCDATAAuto(true)
+		if !conv.cdataAuto {
+			t.Error("expected cdataAuto to be true")
+		}
+	})
+
 	t.Run("WithListHeaders", func(t *testing.T) {
 		conv := New(nil).WithListHeaders(true)
 		if !conv.listHeaders {
@@ -89,6 +111,34 @@ func TestWithMethods(t *testing.T) {
 		}
 	})
 
+	t.Run("WithIDs", func(t *testing.T) {
+		conv := New(nil).WithIDs(true)
+		if !conv.ids {
+			t.Error("expected ids to be true")
+		}
+	})
+
+	t.Run("WithIDSeed", func(t *testing.T) {
+		conv := New(nil).WithIDSeed(7)
+		if conv.idSeed == nil || *conv.idSeed != 7 {
+			t.Error("expected idSeed to be 7")
+		}
+	})
+
+	t.Run("WithNamespaces", func(t *testing.T) {
+		conv := New(nil).WithNamespaces(map[string]any{"ns1": "http://x"})
+		if conv.namespaces["ns1"] != "http://x" {
+			t.Errorf("expected ns1 namespace, got %v", conv.namespaces)
+		}
+	})
+
+	t.Run("WithItemFunc", func(t *testing.T) {
+		conv := New(nil).WithItemFunc(func(parent string) string { return "entry" })
+		if conv.itemFunc == nil || conv.itemFunc("x") != "entry" {
+			t.Error("expected custom itemFunc")
+		}
+	})
+
 	t.Run("method chaining", func(t *testing.T) {
 		conv := New(nil).
 			WithWrapper("test").
@@ -189,6 +239,23 @@ func TestToXML(t *testing.T) {
 		}
 	})
 
+	t.Run("custom root opens and closes document", func(t *testing.T) {
+		data := map[string]any{"login": "mojombo"}
+		for _, conv := range []*JSON2xml{
+			New(data).WithCustomRoot("user"),
+			New(data).WithWrapper("user"),
+		} {
+			xmlStr, err := conv.WithRoot(true).WithPretty(false).ToXMLString()
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			body := xmlStr[strings.Index(xmlStr, "?>")+2:]
+			if !strings.HasPrefix(body, "<user>") || !strings.HasSuffix(body, "</user>") {
+				t.Errorf("expected document wrapped in <user>, got %s", xmlStr)
+			}
+		}
+	})
+
 	t.Run("no root wrapper", func(t *testing.T) {
 		data := map[string]any{"login": "mojombo"}
 		result, err := New(data).WithRoot(false).WithPretty(false).ToXML()
@@ -409,6 +476,696 @@ func TestToXMLString(t *testing.T) {
 			t.Errorf("expected XML content, got %s", result)
 		}
 	})
+
+	t.Run("WithCDATA wraps string values", func(t *testing.T) {
+		data := map[string]any{"note": "a < b", "count": 2}
+		result, err := New(data).WithCDATA(true).WithPretty(false).ToXMLString()
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if !strings.Contains(result, `<note type="str"><![CDATA[a < b]]></note>`) {
+			t.Errorf("expected CDATA-wrapped string, got %s", result)
+		}
+	})
+
+	t.Run("WithCDATAAuto wraps only markup", func(t *testing.T) {
+		data := map[string]any{"note": "a < b", "name": "plain"}
+		result, err := New(data).WithCDATAAuto(true).WithPretty(false).WithAttrType(false).ToXMLString()
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if !strings.Contains(result, `<name>plain</name><note><![CDATA[a < b]]></note>`) {
+			t.Errorf("expected only the markup value in CDATA, got %s", result)
+		}
+	})
+
+	t.Run("WithIDs and a seed give deterministic IDs", func(t *testing.T) {
+		data := map[string]any{"a": 1, "b": map[string]any{"c": "d"}}
+		conv := New(data).WithIDs(true).WithIDSeed(42).WithPretty(false).WithAttrType(false)
+
+		expected := `<?xml version="1.0" encoding="UTF-8" ?><all><a id="all_172305">1</a>` +
+			`<b id="all_534987"><c id="b_481668">d</c></b></all>`
+		for i := 0; i < 2; i++ {
+			result, err := conv.ToXMLString()
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if result != expected {
+				t.Errorf("run %d: expected %s, got %s", i, expected, result)
+			}
+		}
+	})
+
+	t.Run("WithIDs without a seed", func(t *testing.T) {
+		result, err := New(map[string]any{"a": 1}).WithIDs(true).WithPretty(false).ToXMLString()
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if !strings.Contains(result, `<a id="all_`) {
+			t.Errorf("expected id attribute, got %s", result)
+		}
+	})
+
+	t.Run("WithNamespaces declares namespaces on the root", func(t *testing.T) {
+		data := map[string]any{"ns1:node": "value"}
+		result, err := New(data).
+			WithNamespaces(map[string]any{"ns1": "http://x"}).
+			WithPretty(false).
+			WithAttrType(false).
+			ToXMLString()
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		expected := `<?xml version="1.0" encoding="UTF-8" ?><all xmlns:ns1="http://x"><ns1:node>value</ns1:node></all>`
+		if result != expected {
+			t.Errorf("expected %s, got %s", expected, result)
+		}
+	})
+
+	t.Run("WithNamespaces is ignored without a root", func(t *testing.T) {
+		result, err := New(map[string]any{"node": "value"}).
+			WithNamespaces(map[string]any{"ns1": "http://x"}).
+			WithRoot(false).
+			WithPretty(false).
+			WithAttrType(false).
+			ToXMLString()
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if result != "<node>value</node>" {
+			t.Errorf("expected bare fragment, got %s", result)
+		}
+	})
+
+	t.Run("WithItemFunc names list items", func(t *testing.T) {
+		data := map[string]any{"colors": []any{"red", "green"}}
+		result, err := New(data).
+			WithItemFunc(func(parent string) string { return "entry" }).
+			WithRoot(false).
+			WithAttrType(false).
+			WithPretty(false).
+			ToXMLString()
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if result != "<colors><entry>red</entry><entry>green</entry></colors>" {
+			t.Errorf("unexpected output: %s", result)
+		}
+	})
+
+	t.Run("WithItemFunc nil falls back to default", func(t *testing.T) {
+		result, err := New(map[string]any{"colors": []any{"red"}}).
+			WithItemFunc(nil).
+			WithRoot(false).
+			WithAttrType(false).
+			WithPretty(false).
+			ToXMLString()
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if result != "<colors><item>red</item></colors>" {
+			t.Errorf("unexpected output: %s", result)
+		}
+	})
+
+	t.Run("WithListHeaders repeats parent tags", func(t *testing.T) {
+		data := map[string]any{
+			"Bike": []any{
+				map[string]any{"frame_color": "red"},
+				map[string]any{"frame_color": "green"},
+			},
+		}
+		result, err := New(data).
+			WithListHeaders(true).
+			WithItemWrap(false).
+			WithRoot(false).
+			WithAttrType(false).
+			WithPretty(false).
+			ToXMLString()
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		expected := "<Bike><frame_color>red</frame_color></Bike><Bike><frame_color>green</frame_color></Bike>"
+		if result != expected {
+			t.Errorf("expected %s, got %s", expected, result)
+		}
+	})
+}
+
+func TestToBoth(t *testing.T) {
+	t.Run("nil data", func(t *testing.T) {
+		compact, pretty, err := New(nil).ToBoth()
+		if err != nil || compact != nil || pretty != "" {
+			t.Errorf("expected empty results, got %q, %q, %v", compact, pretty, err)
+		}
+	})
+
+	t.Run("returns compact and pretty forms of the same document", func(t *testing.T) {
+		data := map[string]any{"name": "Bike", "parts": []any{"frame", "wheel"}}
+		compact, pretty, err := New(data).ToBoth()
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		if bytes.Contains(compact, []byte("\n")) {
+			t.Errorf("expected compact form without newlines, got %s", compact)
+		}
+		if !strings.Contains(pretty, "\n  <name") {
+			t.Errorf("expected indented pretty form, got %s", pretty)
+		}
+
+		expected, err := PrettyPrint(compact)
+		if err != nil {
+			t.Fatalf("failed to pretty-print compact form: %v", err)
+		}
+		if pretty != expected {
+			t.Errorf("pretty form does not match compact form:\n%s\n%s", pretty, expected)
+		}
+	})
+
+	t.Run("invalid document", func(t *testing.T) {
+		_, _, err := New(map[string]any{"a": 1}).WithWrapper("bad<root").ToBoth()
+		if !errors.Is(err, ErrInvalidData) {
+			t.Errorf("expected ErrInvalidData, got %v", err)
+		}
+	})
+}
+
+func TestWithSelfClose(t *testing.T) {
+	data := map[string]any{"none": nil, "blank": "", "name": "Bike"}
+
+	for _, pretty := range []bool{true, false} {
+		result, err := New(data).WithSelfClose(true).WithPretty(pretty).ToXMLString()
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		for _, want := range []string{`<none type="null"/>`, `<blank type="str"/>`, `<name type="str">Bike</name>`} {
+			if !strings.Contains(result, want) {
+				t.Errorf("pretty=%v: expected %s in %s", pretty, want, result)
+			}
+		}
+	}
+}
+
+func TestWithIndent(t *testing.T) {
+	data := map[string]any{"bike": map[string]any{"color": "red"}}
+
+	t.Run("tabs", func(t *testing.T) {
+		result, err := New(data).WithAttrType(false).WithIndent("", "\t").ToXMLString()
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if !strings.HasPrefix(result, `<?xml version="1.0" encoding="UTF-8" ?>`+"\n<all>") {
+			t.Errorf("expected declaration on its own line, got %q", result)
+		}
+		if !strings.Contains(result, "\n\t<bike>\n\t\t<color>red</color>\n\t</bike>") {
+			t.Errorf("expected tab indentation, got %q", result)
+		}
+	})
+
+	t.Run("default is two spaces", func(t *testing.T) {
+		result, err := New(data).WithAttrType(false).ToXMLString()
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if !strings.Contains(result, "\n  <bike>\n    <color>") {
+			t.Errorf("expected two-space indentation, got %q", result)
+		}
+	})
+
+	t.Run("ToBoth", func(t *testing.T) {
+		_, pretty, err := New(data).WithIndent("", "    ").ToBoth()
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if !strings.Contains(pretty, "\n    <bike") {
+			t.Errorf("expected four-space indentation, got %q", pretty)
+		}
+	})
+}
+
+func TestWithDeclaration(t *testing.T) {
+	data := map[string]any{"name": "Bike"}
+	decl := `<?xml version="1.0" encoding="ISO-8859-1"?>`
+
+	for _, pretty := range []bool{true, false} {
+		result, err := New(data).WithDeclaration(decl).WithPretty(pretty).ToXMLString()
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if !strings.HasPrefix(result, decl) || strings.Count(result, "<?xml") != 1 {
+			t.Errorf("pretty=%v: expected only the custom declaration, got %q", pretty, result)
+		}
+
+		result, err = New(data).WithoutDeclaration().WithPretty(pretty).ToXMLString()
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if !strings.HasPrefix(result, "<all>") {
+			t.Errorf("pretty=%v: expected no declaration, got %q", pretty, result)
+		}
+	}
+}
+
+func TestWithSubtree(t *testing.T) {
+	data := map[string]any{
+		"meta":    map[string]any{"page": 1},
+		"results": []any{map[string]any{"items": []any{"x", "y"}}},
+	}
+
+	result, err := New(data).WithSubtree("/results/0/items").WithAttrType(false).WithPretty(false).ToXMLString()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	expected := `<?xml version="1.0" encoding="UTF-8" ?><all><item>x</item><item>y</item></all>`
+	if result != expected {
+		t.Errorf("expected %s, got %s", expected, result)
+	}
+
+	var buf bytes.Buffer
+	if _, err := New(data).WithSubtree("/meta").WithPretty(false).WriteTo(&buf); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if strings.Contains(buf.String(), "results") || !strings.Contains(buf.String(), "<page") {
+		t.Errorf("expected only the meta subtree, got %s", buf.String())
+	}
+
+	if _, err := New(data).WithSubtree("/results/5").ToXML(); !errors.Is(err, ErrInvalidData) {
+		t.Errorf("expected ErrInvalidData for a missing path, got %v", err)
+	}
+	if _, _, err := New(data).WithSubtree("/nope").ToBoth(); !errors.Is(err, ErrInvalidData) {
+		t.Errorf("expected ErrInvalidData from ToBoth, got %v", err)
+	}
+}
+
+func TestWithTimeLayout(t *testing.T) {
+	data := map[string]any{"day": time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)}
+	result, err := New(data).WithTimeLayout("2006-01-02").WithPretty(false).ToXMLString()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if !strings.Contains(result, `<day type="str">2024-03-01</day>`) {
+		t.Errorf("expected date-only output, got %s", result)
+	}
+}
+
+func TestWithCompactLeaves(t *testing.T) {
+	data := map[string]any{"note": "\n\n", "name": "Bike"}
+
+	result, err := New(data).WithAttrType(false).WithCompactLeaves(true).ToXMLString()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if !strings.Contains(result, "  <note></note>\n") {
+		t.Errorf("expected a compact leaf, got %q", result)
+	}
+}
+
+func TestTopLevelScalarBuilder(t *testing.T) {
+	result, err := New("42").WithPretty(false).ToXMLString()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if expected := `<?xml version="1.0" encoding="UTF-8" ?><all type="str">42</all>`; result != expected {
+		t.Errorf("expected %s, got %s", expected, result)
+	}
+}
+
+func TestEmptyContainersProduceEmptyRoot(t *testing.T) {
+	for _, data := range []any{map[string]any{}, []any{}, map[string]int{}, []string{}} {
+		result, err := New(data).WithPretty(false).ToXMLString()
+		if err != nil {
+			t.Fatalf("%T: expected no error, got %v", data, err)
+		}
+		if expected := `<?xml version="1.0" encoding="UTF-8" ?><all></all>`; result != expected {
+			t.Errorf("%T: expected %s, got %q", data, expected, result)
+		}
+
+		pretty, err := New(data).ToXMLString()
+		if err != nil || !strings.HasSuffix(pretty, "\n<all></all>") {
+			t.Errorf("%T: expected an empty pretty root, got %q (%v)", data, pretty, err)
+		}
+
+		converted, err := ConvertToXML(data, nil)
+		if err != nil || !strings.HasSuffix(string(converted), "<root></root>") {
+			t.Errorf("%T: expected an empty root from ConvertToXML, got %q (%v)", data, converted, err)
+		}
+	}
+}
+
+func TestWithBoolStrings(t *testing.T) {
+	result, err := New(map[string]any{"ok": true}).WithBoolStrings("yes", "no").WithPretty(false).ToXMLString()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if !strings.Contains(result, `<ok type="bool">yes</ok>`) {
+		t.Errorf("expected yes, got %s", result)
+	}
+}
+
+func TestWithMinify(t *testing.T) {
+	data := map[string]any{"name": "Bike", "gears": []any{1, 2}}
+	expected := `<all><gears type="list"><item type="int">1</item><item type="int">2</item></gears><name type="str">Bike</name></all>`
+
+	result, err := New(data).WithMinify(true).ToXMLString()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if result != expected {
+		t.Errorf("expected %s, got %s", expected, result)
+	}
+
+	var buf bytes.Buffer
+	if _, err := New(data).WithMinify(true).WriteTo(&buf); err != nil || buf.String() != expected {
+		t.Errorf("expected WriteTo to minify, got %q (err %v)", buf.String(), err)
+	}
+}
+
+func TestWithSortKeys(t *testing.T) {
+	data, err := ReadFromStringOrdered(`{"name": "Bike", "id": 7}`)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	sorted, err := New(data).WithPretty(false).WithAttrType(false).ToXMLString()
+	if err != nil || !strings.HasSuffix(sorted, "<all><id>7</id><name>Bike</name></all>") {
+		t.Errorf("expected sorted keys by default, got %s (err %v)", sorted, err)
+	}
+	ordered, err := New(data).WithPretty(false).WithAttrType(false).WithSortKeys(false).ToXMLString()
+	if err != nil || !strings.HasSuffix(ordered, "<all><name>Bike</name><id>7</id></all>") {
+		t.Errorf("expected document order, got %s (err %v)", ordered, err)
+	}
+}
+
+func TestToXMLReportsInvalidData(t *testing.T) {
+	for _, converter := range []*JSON2xml{
+		New(map[string]any{"callback": func() {}}),
+		New(map[string]any{"a": 1}).WithWrapper("two words"),
+	} {
+		if _, err := converter.ToXML(); !errors.Is(err, ErrInvalidData) {
+			t.Errorf("expected ErrInvalidData, got %v", err)
+		}
+		if _, err := converter.WriteTo(&bytes.Buffer{}); !errors.Is(err, ErrInvalidData) {
+			t.Errorf("expected ErrInvalidData from WriteTo, got %v", err)
+		}
+	}
+}
+
+func TestToXMLValidated(t *testing.T) {
+	t.Run("valid output", func(t *testing.T) {
+		for _, pretty := range []bool{true, false} {
+			result, err := New(map[string]any{"a": []any{1, 2}}).WithPretty(pretty).ToXMLValidated()
+			if err != nil {
+				t.Fatalf("pretty=%v: expected no error, got %v", pretty, err)
+			}
+			if !strings.Contains(result, "<a") {
+				t.Errorf("pretty=%v: unexpected output %s", pretty, result)
+			}
+		}
+	})
+
+	t.Run("undeclared prefix", func(t *testing.T) {
+		result, err := New(map[string]any{"ns:a": 1}).WithPretty(false).ToXMLValidated()
+		if !errors.Is(err, ErrInvalidData) {
+			t.Fatalf("expected ErrInvalidData, got %v", err)
+		}
+		if result != "" {
+			t.Errorf("expected no output, got %s", result)
+		}
+	})
+
+	t.Run("declared prefix", func(t *testing.T) {
+		conv := New(map[string]any{"ns:a": 1}).WithNamespaces(map[string]any{"ns": "urn:ns"})
+		if _, err := conv.ToXMLValidated(); err != nil {
+			t.Errorf("expected no error, got %v", err)
+		}
+	})
+}
+
+func TestTypedMaps(t *testing.T) {
+	tests := []struct {
+		name  string
+		typed any
+		plain any
+	}{
+		{"map[string]int", map[string]int{"a": 1, "b": 2}, map[string]any{"a": 1, "b": 2}},
+		{"map[string]string", map[string]string{"a": "x < y"}, map[string]any{"a": "x < y"}},
+		{"map[string]float64", map[string]float64{"a": 1e6}, map[string]any{"a": 1e6}},
+		{"map[string]bool", map[string]bool{"a": true}, map[string]any{"a": true}},
+		{"map[string][]string", map[string][]string{"a": {"x", "y"}}, map[string]any{"a": []any{"x", "y"}}},
+		{"nested typed map", map[string]map[string]int{"o": {"a": 1}}, map[string]any{"o": map[string]any{"a": 1}}},
+		{"[]map[string]int", []map[string]int{{"a": 1}}, []any{map[string]any{"a": 1}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, pretty := range []bool{true, false} {
+				typed, err := New(tt.typed).WithPretty(pretty).ToXMLString()
+				if err != nil {
+					t.Fatalf("expected no error, got %v", err)
+				}
+				plain, err := New(tt.plain).WithPretty(pretty).ToXMLString()
+				if err != nil {
+					t.Fatalf("expected no error, got %v", err)
+				}
+				if typed != plain {
+					t.Errorf("pretty=%v: typed output\n%s\ndiffers from\n%s", pretty, typed, plain)
+				}
+			}
+		})
+	}
+}
+
+func TestReader(t *testing.T) {
+	data := map[string]any{"name": "Bike", "parts": []any{"wheel", "frame"}}
+
+	for _, pretty := range []bool{true, false} {
+		conv := New(data).WithPretty(pretty)
+		reader, err := conv.Reader()
+		if err != nil {
+			t.Fatalf("pretty=%v: expected no error, got %v", pretty, err)
+		}
+		recorder := httptest.NewRecorder()
+		if _, err := io.Copy(recorder, reader); err != nil {
+			t.Fatalf("pretty=%v: copy failed: %v", pretty, err)
+		}
+		expected, err := conv.ToXMLString()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if recorder.Body.String() != expected {
+			t.Errorf("pretty=%v: expected %s, got %s", pretty, expected, recorder.Body.String())
+		}
+	}
+
+	t.Run("nil data", func(t *testing.T) {
+		reader, err := New(nil).Reader()
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if got, err := io.ReadAll(reader); err != nil || len(got) != 0 {
+			t.Errorf("expected empty stream, got %q, %v", got, err)
+		}
+	})
+
+	t.Run("conversion error is returned by Read", func(t *testing.T) {
+		reader, err := New(data).WithCustomRoot("not valid").Reader()
+		if err != nil {
+			t.Fatalf("expected no error yet, got %v", err)
+		}
+		if _, err := io.ReadAll(reader); !errors.Is(err, ErrInvalidData) {
+			t.Errorf("expected ErrInvalidData, got %v", err)
+		}
+	})
+
+	t.Run("subtree error is returned right away", func(t *testing.T) {
+		if _, err := New(data).WithSubtree("/missing").Reader(); err == nil {
+			t.Error("expected an error for a missing subtree")
+		}
+	})
+
+	t.Run("close stops the stream", func(t *testing.T) {
+		reader, err := New(data).WithPretty(false).Reader()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := reader.Read(make([]byte, 4)); err != nil {
+			t.Fatalf("expected first read to succeed, got %v", err)
+		}
+		if err := reader.Close(); err != nil {
+			t.Fatalf("expected close to succeed, got %v", err)
+		}
+		if _, err := reader.Read(make([]byte, 4)); !errors.Is(err, io.ErrClosedPipe) {
+			t.Errorf("expected io.ErrClosedPipe after close, got %v", err)
+		}
+	})
+}
+
+func TestWithStylesheet(t *testing.T) {
+	result, err := New(map[string]any{"a": 1}).WithStylesheet("report.xsl").WithAttrType(false).ToXMLString()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	expected := `<?xml version="1.0" encoding="UTF-8" ?>
+<?xml-stylesheet type="text/xsl" href="report.xsl"?>
+<all>
+  <a>1</a>
+</all>`
+	if result != expected {
+		t.Errorf("expected %s, got %s", expected, result)
+	}
+}
+
+func TestToFile(t *testing.T) {
+	data := map[string]any{"name": "Bike", "parts": []any{"wheel", "frame"}}
+
+	for _, pretty := range []bool{true, false} {
+		path := filepath.Join(t.TempDir(), "out.xml")
+		conv := New(data).WithPretty(pretty)
+		if err := conv.ToFile(path, 0o600); err != nil {
+			t.Fatalf("pretty=%v: expected no error, got %v", pretty, err)
+		}
+		got, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected, err := conv.ToXMLString()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != expected {
+			t.Errorf("pretty=%v: expected %s, got %s", pretty, expected, got)
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if runtime.GOOS != "windows" && info.Mode().Perm() != 0o600 {
+			t.Errorf("expected mode 0600, got %v", info.Mode().Perm())
+		}
+	}
+
+	t.Run("failure keeps the old file", func(t *testing.T) {
+		dir := t.TempDir()
+		path := filepath.Join(dir, "out.xml")
+		if err := os.WriteFile(path, []byte("old"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		err := New(data).WithCustomRoot("not valid").ToFile(path, 0o644)
+		if !errors.Is(err, ErrInvalidData) {
+			t.Fatalf("expected ErrInvalidData, got %v", err)
+		}
+		if got, _ := os.ReadFile(path); string(got) != "old" {
+			t.Errorf("expected the old file to stay, got %s", got)
+		}
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(entries) != 1 {
+			t.Errorf("expected no temporary files left, got %d entries", len(entries))
+		}
+	})
+
+	t.Run("missing directory", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "missing", "out.xml")
+		if err := New(data).ToFile(path, 0o644); err == nil {
+			t.Error("expected an error for a missing directory")
+		}
+	})
+}
+
+func TestNewWithOptions(t *testing.T) {
+	data := map[string]any{"userName": "Ada", "tags": []any{"a"}, "missing": nil}
+	opts := DefaultOptions()
+	opts.AttrType = false
+	opts.NilAttr = "nil"
+	opts.KeyTransform = strings.ToLower
+
+	t.Run("matches DictToXMLErr", func(t *testing.T) {
+		expected, err := DictToXMLErr(data, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		result, err := NewWithOptions(data, opts).WithPretty(false).ToXMLBytes()
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if !bytes.Equal(result, expected) {
+			t.Errorf("expected %s, got %s", expected, result)
+		}
+	})
+
+	t.Run("pretty by default", func(t *testing.T) {
+		result, err := NewWithOptions(data, opts).ToXMLString()
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if !strings.Contains(result, "\n  <username>Ada</username>") || !strings.Contains(result, `<missing nil="true">`) {
+			t.Errorf("unexpected output %s", result)
+		}
+	})
+
+	t.Run("With methods still apply", func(t *testing.T) {
+		result, err := NewWithOptions(data, opts).WithWrapper("doc").WithPretty(false).ToXMLString()
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if !strings.Contains(result, "<doc>") {
+			t.Errorf("expected the <doc> wrapper, got %s", result)
+		}
+	})
+}
+
+func TestWriteTo(t *testing.T) {
+	data := map[string]any{"name": "Bike", "gears": []any{1, 2}}
+
+	t.Run("compact", func(t *testing.T) {
+		var buf bytes.Buffer
+		n, err := New(data).WithPretty(false).WriteTo(&buf)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		expected, _ := New(data).WithPretty(false).ToXMLBytes()
+		if !bytes.Equal(buf.Bytes(), expected) {
+			t.Errorf("expected %s, got %s", expected, buf.Bytes())
+		}
+		if n != int64(buf.Len()) {
+			t.Errorf("expected %d bytes reported, got %d", buf.Len(), n)
+		}
+	})
+
+	t.Run("pretty", func(t *testing.T) {
+		var buf bytes.Buffer
+		n, err := New(data).WriteTo(&buf)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		expected, _ := New(data).ToXMLString()
+		if buf.String() != expected || n != int64(len(expected)) {
+			t.Errorf("expected %q (%d bytes), got %q (%d bytes)", expected, len(expected), buf.String(), n)
+		}
+	})
+
+	t.Run("nil data", func(t *testing.T) {
+		var buf bytes.Buffer
+		n, err := New(nil).WriteTo(&buf)
+		if err != nil || n != 0 || buf.Len() != 0 {
+			t.Errorf("expected nothing written, got %d bytes, err %v", n, err)
+		}
+	})
+
+	t.Run("pretty print error", func(t *testing.T) {
+		var buf bytes.Buffer
+		if _, err := New(data).WithWrapper("bad<root").WriteTo(&buf); !errors.Is(err, ErrInvalidData) {
+			t.Errorf("expected ErrInvalidData, got %v", err)
+		}
+	})
+
+	t.Run("implements io.WriterTo", func(t *testing.T) {
+		var _ io.WriterTo = New(data)
+	})
 }
 
 func TestToXMLBytes(t *testing.T) {
@@ -468,6 +1225,147 @@ func TestConvertToXMLFunction(t *testing.T) {
 			t.Errorf("expected custom root, got %s", string(result))
 		}
 	})
+
+	t.Run("disallowed kind returns ErrUnsupportedType", func(t *testing.T) {
+		data := map[string]any{"name": "Bike", "callback": func() {}}
+		opts := DefaultOptions()
+		opts.AllowedKinds = []reflect.Kind{reflect.Map, reflect.String}
+		result, err := ConvertToXML(data, &opts)
+		if !errors.Is(err, ErrUnsupportedType) {
+			t.Fatalf("expected ErrUnsupportedType, got %v", err)
+		}
+		if result != nil {
+			t.Errorf("expected nil result, got %s", string(result))
+		}
+	})
+
+	t.Run("every error-returning path checks kinds", func(t *testing.T) {
+		data := map[string]any{"n": 1.5, "tags": []any{"a"}}
+		opts := DefaultOptions()
+		opts.AllowedKinds = []reflect.Kind{reflect.Map, reflect.Slice, reflect.String}
+
+		if result, err := DictToXMLErr(data, opts); !errors.Is(err, ErrUnsupportedType) {
+			t.Errorf("DictToXMLErr: expected ErrUnsupportedType, got %v and %s", err, result)
+		}
+		if result := DictToXML(data, opts); !bytes.Contains(result, []byte(`<n type="float">1.5</n>`)) {
+			t.Errorf("DictToXML: expected AllowedKinds to be ignored, got %s", result)
+		}
+		var buf bytes.Buffer
+		if err := WriteXML(&buf, data, opts); !errors.Is(err, ErrUnsupportedType) {
+			t.Errorf("WriteXML: expected ErrUnsupportedType, got %v", err)
+		}
+		if _, err := ConvertBatch([]any{data}, opts, 1); !errors.Is(err, ErrUnsupportedType) {
+			t.Errorf("ConvertBatch: expected ErrUnsupportedType, got %v", err)
+		}
+
+		converter := New(data).WithAllowedKinds(reflect.Map, reflect.Slice, reflect.String)
+		if _, err := converter.ToXMLString(); !errors.Is(err, ErrUnsupportedType) {
+			t.Errorf("ToXMLString: expected ErrUnsupportedType, got %v", err)
+		}
+		if _, err := converter.WithPretty(false).WriteTo(&buf); !errors.Is(err, ErrUnsupportedType) {
+			t.Errorf("WriteTo: expected ErrUnsupportedType, got %v", err)
+		}
+		if _, err := New(data).WithAllowedKinds(reflect.Map, reflect.Slice, reflect.String, reflect.Float64).ToXMLString(); err != nil {
+			t.Errorf("expected allowed kinds to convert, got %v", err)
+		}
+	})
+
+	t.Run("pointers are checked by what they point to", func(t *testing.T) {
+		type point struct{ X string }
+		name := "Bike"
+		data := map[string]any{"p": &point{X: "1"}, "name": &name, "nothing": (*point)(nil)}
+		opts := DefaultOptions()
+		opts.AllowedKinds = []reflect.Kind{reflect.Map, reflect.Struct, reflect.String}
+		if _, err := DictToXMLErr(data, opts); err != nil {
+			t.Errorf("expected pointers to allowed kinds to convert, got %v", err)
+		}
+		opts.AllowedKinds = []reflect.Kind{reflect.Map, reflect.Pointer, reflect.String}
+		if _, err := DictToXMLErr(data, opts); !errors.Is(err, ErrUnsupportedType) || !strings.Contains(err.Error(), "point") {
+			t.Errorf("expected the struct behind the pointer to be rejected, got %v", err)
+		}
+	})
+
+	t.Run("allowed kinds convert normally", func(t *testing.T) {
+		data := map[string]any{"name": "Bike", "gears": []any{1.0, 2.0}}
+		opts := DefaultOptions()
+		opts.AllowedKinds = []reflect.Kind{reflect.Map, reflect.Slice, reflect.String, reflect.Float64}
+		result, err := ConvertToXML(data, &opts)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if !bytes.Contains(result, []byte("<name type=\"str\">Bike</name>")) {
+			t.Errorf("expected converted output, got %s", string(result))
+		}
+	})
+}
+
+func TestMaxDepth(t *testing.T) {
+	cyclic := map[string]any{"name": "loop"}
+	cyclic["self"] = cyclic
+	cyclicList := []any{1}
+	cyclicList = append(cyclicList, nil)
+	cyclicList[1] = cyclicList
+
+	t.Run("self-referential map", func(t *testing.T) {
+		if _, err := ConvertToXML(cyclic, nil); !errors.Is(err, ErrMaxDepth) {
+			t.Errorf("expected ErrMaxDepth, got %v", err)
+		}
+		opts := DefaultOptions()
+		opts.MaxDepth = 3
+		if result := string(DictToXML(cyclic, opts)); strings.Count(result, "<self") != 3 {
+			t.Errorf("expected DictToXML to cut the cycle, got %s", result)
+		}
+		if _, err := New(cyclic).ToXML(); !errors.Is(err, ErrMaxDepth) {
+			t.Errorf("expected ErrMaxDepth from ToXML, got %v", err)
+		}
+		if _, _, err := New(cyclic).ToBoth(); !errors.Is(err, ErrMaxDepth) {
+			t.Errorf("expected ErrMaxDepth from ToBoth, got %v", err)
+		}
+		if err := WriteXML(&bytes.Buffer{}, cyclic, DefaultOptions()); !errors.Is(err, ErrMaxDepth) {
+			t.Errorf("expected ErrMaxDepth from WriteXML, got %v", err)
+		}
+	})
+
+	t.Run("self-referential list", func(t *testing.T) {
+		if _, err := ConvertToXML(cyclicList, nil); !errors.Is(err, ErrMaxDepth) {
+			t.Errorf("expected ErrMaxDepth, got %v", err)
+		}
+	})
+
+	t.Run("recursive functions called directly", func(t *testing.T) {
+		opts := DefaultOptions()
+		opts.MaxDepth = 5
+		result := ConvertDict(cyclic, opts, "root")
+		if strings.Count(result, "<self") != 5 {
+			t.Errorf("expected the cycle cut after 5 levels, got %s", result)
+		}
+		if result := ConvertList(cyclicList, opts, "root"); strings.Count(result, "<item type=\"int\">1</item>") != 5 {
+			t.Errorf("expected the cycle cut after 5 levels, got %s", result)
+		}
+		if result := ConvertToXPath31(cyclic, ""); !strings.Contains(result, "<map key=\"self\"/>") {
+			t.Errorf("expected the cycle cut at the default limit, got %.200s", result)
+		}
+
+		var failure error
+		opts.failure = &failure
+		Convert(cyclic, opts, "root")
+		if !errors.Is(failure, ErrMaxDepth) {
+			t.Errorf("expected ErrMaxDepth to be recorded, got %v", failure)
+		}
+	})
+
+	t.Run("custom limit", func(t *testing.T) {
+		data := map[string]any{"a": map[string]any{"b": []int{1}}}
+		opts := DefaultOptions()
+		opts.MaxDepth = 2
+		if _, err := ConvertToXML(data, &opts); !errors.Is(err, ErrMaxDepth) {
+			t.Errorf("expected ErrMaxDepth for three levels, got %v", err)
+		}
+		opts.MaxDepth = 3
+		if _, err := ConvertToXML(data, &opts); err != nil {
+			t.Errorf("expected three levels to convert, got %v", err)
+		}
+	})
 }
 
 func TestIntegration(t *testing.T) {
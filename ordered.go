@@ -0,0 +1,148 @@
+package json2xml
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+)
+
+// OrderedMap is a JSON object that remembers the order its keys were
+// first set in. It converts like a map[string]any; with Options.SortKeys
+// off, its elements are written in that order instead of sorted.
+// ReadFromStringOrdered decodes JSON objects into *OrderedMap values.
+type OrderedMap struct {
+	keys   []string
+	values map[string]any
+}
+
+// NewOrderedMap returns an empty OrderedMap.
+func NewOrderedMap() *OrderedMap {
+	return &OrderedMap{values: make(map[string]any)}
+}
+
+// Set sets the value of key. A new key goes after the existing ones; an
+// existing key keeps its position.
+func (m *OrderedMap) Set(key string, value any) {
+	if m.values == nil {
+		m.values = make(map[string]any)
+	}
+	if _, ok := m.values[key]; !ok {
+		m.keys = append(m.keys, key)
+	}
+	m.values[key] = value
+}
+
+// Get returns the value of key and whether it is set.
+func (m *OrderedMap) Get(key string) (any, bool) {
+	value, ok := m.values[key]
+	return value, ok
+}
+
+// Keys returns the keys in the order they were first set.
+func (m *OrderedMap) Keys() []string {
+	return slices.Clone(m.keys)
+}
+
+// Len returns the number of keys.
+func (m *OrderedMap) Len() int {
+	return len(m.keys)
+}
+
+// ReadFromStringOrdered parses a JSON string like ReadFromString, but
+// decodes objects into *OrderedMap so that converting with
+// Options.SortKeys off keeps their keys in document order. When a key is
+// repeated, the last value wins at the position of the first.
+func ReadFromStringOrdered(jsonData string) (any, error) {
+	if jsonData == "" {
+		return nil, ErrStringRead
+	}
+
+	decoder := json.NewDecoder(bomReader(strings.NewReader(jsonData)))
+	result, err := decodeOrdered(decoder)
+	if err == nil {
+		if _, tokErr := decoder.Token(); tokErr != io.EOF {
+			err = errors.New("invalid character after top-level value")
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrStringRead, err)
+	}
+
+	return result, nil
+}
+
+// decodeOrdered decodes the next JSON value from decoder, with objects as
+// *OrderedMap and arrays as []any.
+func decodeOrdered(decoder *json.Decoder) (any, error) {
+	tok, err := decoder.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	switch tok {
+	case json.Delim('{'):
+		m := NewOrderedMap()
+		for decoder.More() {
+			keyTok, err := decoder.Token()
+			if err != nil {
+				return nil, err
+			}
+			value, err := decodeOrdered(decoder)
+			if err != nil {
+				return nil, err
+			}
+			m.Set(keyTok.(string), value)
+		}
+		_, err := decoder.Token()
+		return m, err
+	case json.Delim('['):
+		items := []any{}
+		for decoder.More() {
+			item, err := decodeOrdered(decoder)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, item)
+		}
+		_, err := decoder.Token()
+		return items, err
+	}
+	return tok, nil
+}
+
+// withKeyOrder returns opts for writing val. When val is an OrderedMap
+// and SortKeys is off, its keys are written in their own order; any other
+// value clears the order carried for the map written before it.
+func (opts Options) withKeyOrder(val any) Options {
+	opts.mapKeys = nil
+	if opts.SortKeys {
+		return opts
+	}
+	if m, ok := indirect(val).(OrderedMap); ok {
+		opts.mapKeys = m.keys
+	}
+	return opts
+}
+
+// keys returns the keys of m in the order they are written: the order
+// carried by withKeyOrder for the OrderedMap m comes from, or sorted.
+// m may be a filtered copy of that map, such as the children left once
+// @attrs and @val are taken out.
+func (opts Options) keys(m map[string]any) []string {
+	if opts.mapKeys == nil {
+		return sortedKeys(m)
+	}
+	keys := make([]string, 0, len(m))
+	for _, key := range opts.mapKeys {
+		if _, ok := m[key]; ok {
+			keys = append(keys, key)
+		}
+	}
+	if len(keys) != len(m) {
+		return sortedKeys(m)
+	}
+	return keys
+}
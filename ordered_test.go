@@ -0,0 +1,186 @@
+package json2xml
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestOrderedMap(t *testing.T) {
+	m := NewOrderedMap()
+	m.Set("b", 1)
+	m.Set("a", 2)
+	m.Set("b", 3)
+
+	if !reflect.DeepEqual(m.Keys(), []string{"b", "a"}) || m.Len() != 2 {
+		t.Errorf("expected keys [b a], got %v", m.Keys())
+	}
+	if v, ok := m.Get("b"); !ok || v != 3 {
+		t.Errorf("expected b=3, got %v (%v)", v, ok)
+	}
+	if _, ok := m.Get("c"); ok {
+		t.Error("expected c to be unset")
+	}
+
+	var zero OrderedMap
+	zero.Set("x", 1)
+	if !reflect.DeepEqual(zero.Keys(), []string{"x"}) {
+		t.Errorf("expected the zero value to be usable, got %v", zero.Keys())
+	}
+}
+
+func TestReadFromStringOrdered(t *testing.T) {
+	data, err := ReadFromStringOrdered(`{"z": 1, "a": {"y": [true, null, {"q": "r"}], "b": "c"}, "z": 2}`)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	m := data.(*OrderedMap)
+	if !reflect.DeepEqual(m.Keys(), []string{"z", "a"}) {
+		t.Errorf("expected keys [z a], got %v", m.Keys())
+	}
+	if z, _ := m.Get("z"); z != float64(2) {
+		t.Errorf("expected the last z to win, got %v", z)
+	}
+	a, _ := m.Get("a")
+	if keys := a.(*OrderedMap).Keys(); !reflect.DeepEqual(keys, []string{"y", "b"}) {
+		t.Errorf("expected keys [y b], got %v", keys)
+	}
+	y, _ := a.(*OrderedMap).Get("y")
+	if items := y.([]any); len(items) != 3 || items[0] != true || items[1] != nil {
+		t.Errorf("unexpected array %v", items)
+	}
+
+	for _, input := range []string{"", `{"a": }`, `{"a": 1} {}`, `[1, 2`} {
+		if _, err := ReadFromStringOrdered(input); !errors.Is(err, ErrStringRead) {
+			t.Errorf("%q: expected ErrStringRead, got %v", input, err)
+		}
+	}
+}
+
+func TestSortKeys(t *testing.T) {
+	data, err := ReadFromStringOrdered(`{"name": "Bike", "id": 7, "parts": [{"size": 2, "kind": "wheel"}], "meta": {"@attrs": {"v": "1"}, "z": 1, "a": 2}}`)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	opts := DefaultOptions()
+	opts.AttrType = false
+
+	sorted := `<root><id>7</id><meta v="1"><a>2</a><z>1</z></meta><name>Bike</name><parts><item><kind>wheel</kind><size>2</size></item></parts></root>`
+	if result := string(DictToXML(data, opts)); !strings.HasSuffix(result, sorted) {
+		t.Errorf("expected sorted keys %s, got %s", sorted, result)
+	}
+
+	opts.SortKeys = false
+	ordered := `<root><name>Bike</name><id>7</id><parts><item><size>2</size><kind>wheel</kind></item></parts><meta v="1"><z>1</z><a>2</a></meta></root>`
+	result := string(DictToXML(data, opts))
+	if !strings.HasSuffix(result, ordered) {
+		t.Errorf("expected document order %s, got %s", ordered, result)
+	}
+
+	var buf bytes.Buffer
+	if err := WriteXML(&buf, data, opts); err != nil || buf.String() != result {
+		t.Errorf("expected WriteXML to match DictToXML, got %q (err %v)", buf.String(), err)
+	}
+
+	t.Run("typed root", func(t *testing.T) {
+		typedOpts := DefaultOptions()
+		typedOpts.RootAttrType = true
+		if result := string(DictToXML(data, typedOpts)); !strings.Contains(result, `<root type="dict">`) {
+			t.Errorf("expected a dict-typed root, got %s", result)
+		}
+	})
+
+	t.Run("plain maps stay sorted", func(t *testing.T) {
+		result := string(DictToXML(map[string]any{"b": 1, "a": 2}, opts))
+		if !strings.HasSuffix(result, "<root><a>2</a><b>1</b></root>") {
+			t.Errorf("expected sorted keys, got %s", result)
+		}
+	})
+
+	t.Run("recursive functions called directly", func(t *testing.T) {
+		m := NewOrderedMap()
+		m.Set("b", 1)
+		m.Set("a", 2)
+		plain := Options{ItemWrap: true}
+		if result := Convert(m, plain, "root"); result != "<b>1</b><a>2</a>" {
+			t.Errorf("expected document order from Convert, got %s", result)
+		}
+		if result := Convert(*m, plain, "root"); result != "<b>1</b><a>2</a>" {
+			t.Errorf("expected document order for an OrderedMap value, got %s", result)
+		}
+		if result := ConvertList([]any{m}, plain, "root"); result != "<item><b>1</b><a>2</a></item>" {
+			t.Errorf("expected document order from ConvertList, got %s", result)
+		}
+		if result := ConvertToXPath31(m, ""); strings.Index(result, `key="b"`) > strings.Index(result, `key="a"`) {
+			t.Errorf("expected document order from ConvertToXPath31, got %s", result)
+		}
+		plain.SortKeys = true
+		if result := Convert(m, plain, "root"); result != "<a>2</a><b>1</b>" {
+			t.Errorf("expected sorted keys, got %s", result)
+		}
+	})
+
+	t.Run("AllowedKinds treats OrderedMap as a map", func(t *testing.T) {
+		allowed := opts
+		allowed.AllowedKinds = []reflect.Kind{reflect.Map, reflect.Slice, reflect.String, reflect.Float64}
+		if _, err := DictToXMLErr(data, allowed); err != nil {
+			t.Errorf("expected ordered data to pass, got %v", err)
+		}
+		allowed.AllowedKinds = []reflect.Kind{reflect.Slice, reflect.String, reflect.Float64}
+		if _, err := DictToXMLErr(data, allowed); !errors.Is(err, ErrUnsupportedType) {
+			t.Errorf("expected ErrUnsupportedType without Map, got %v", err)
+		}
+	})
+
+	t.Run("order does not leak into nested maps", func(t *testing.T) {
+		inner := NewOrderedMap()
+		inner.Set("@val", []any{map[string]any{"z": 1, "a": 2}})
+		m := NewOrderedMap()
+		m.Set("z", map[string]any{"y": 1, "x": 2})
+		m.Set("p", inner)
+		result := Convert(m, Options{ItemWrap: true}, "root")
+		if expected := "<z><x>2</x><y>1</y></z><p><item><a>2</a><z>1</z></item></p>"; result != expected {
+			t.Errorf("expected %s, got %s", expected, result)
+		}
+	})
+
+	t.Run("XPath", func(t *testing.T) {
+		xpathOpts := opts
+		xpathOpts.XPathFormat = true
+		result := string(DictToXML(data, xpathOpts))
+		if strings.Index(result, `key="name"`) > strings.Index(result, `key="id"`) {
+			t.Errorf("expected name before id, got %s", result)
+		}
+		xpathOpts.SortKeys = true
+		result = string(DictToXML(data, xpathOpts))
+		if strings.Index(result, `key="id"`) > strings.Index(result, `key="name"`) {
+			t.Errorf("expected id before name, got %s", result)
+		}
+	})
+
+	t.Run("map entries", func(t *testing.T) {
+		entryOpts := opts
+		entryOpts.MapAsEntries = true
+		result := string(DictToXML(data, entryOpts))
+		if strings.Index(result, `key="name"`) > strings.Index(result, `key="id"`) {
+			t.Errorf("expected name before id, got %s", result)
+		}
+	})
+
+	t.Run("inside structs", func(t *testing.T) {
+		type wrapper struct {
+			Data *OrderedMap `json:"data"`
+		}
+		m := NewOrderedMap()
+		m.Set("b", 1)
+		m.Set("a", 2)
+		result := string(DictToXML(wrapper{Data: m}, opts))
+		if !strings.HasSuffix(result, "<root><data><b>1</b><a>2</a></data></root>") {
+			t.Errorf("expected document order, got %s", result)
+		}
+	})
+}
@@ -0,0 +1,90 @@
+package json2xml
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// SelectSubtree returns the value in data that the RFC 6901 JSON Pointer
+// refers to, such as "/results/0/items", so that only that part of a
+// document is converted. The empty pointer selects data itself. Within a
+// reference token "~1" stands for "/" and "~0" for "~". Maps and slices of
+// any type can be navigated; array indexes must be decimal without leading
+// zeros. A missing key, an out-of-range index or a malformed pointer
+// returns an ErrInvalidData error naming the failing location.
+func SelectSubtree(data any, pointer string) (any, error) {
+	if pointer == "" {
+		return data, nil
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("%w: JSON pointer %q must start with /", ErrInvalidData, pointer)
+	}
+
+	current := data
+	path := ""
+	for _, raw := range strings.Split(pointer[1:], "/") {
+		token, err := unescapePointerToken(raw)
+		if err != nil {
+			return nil, fmt.Errorf("%w: JSON pointer %q: %v", ErrInvalidData, pointer, err)
+		}
+		path += "/" + raw
+
+		switch v := normalizeValue(current).(type) {
+		case map[string]any:
+			child, ok := v[token]
+			if !ok {
+				return nil, fmt.Errorf("%w: JSON pointer %q: no key %q at %s", ErrInvalidData, pointer, token, path)
+			}
+			current = child
+		case []any:
+			index, err := pointerIndex(token)
+			if err != nil {
+				return nil, fmt.Errorf("%w: JSON pointer %q: %v at %s", ErrInvalidData, pointer, err, path)
+			}
+			if index >= len(v) {
+				return nil, fmt.Errorf("%w: JSON pointer %q: index %d out of range for %d items at %s", ErrInvalidData, pointer, index, len(v), path)
+			}
+			current = v[index]
+		default:
+			return nil, fmt.Errorf("%w: JSON pointer %q: cannot select %q from a %s at %s", ErrInvalidData, pointer, token, GetXMLType(current), path)
+		}
+	}
+	return current, nil
+}
+
+// unescapePointerToken decodes the ~0 and ~1 escapes of a reference token.
+func unescapePointerToken(token string) (string, error) {
+	if !strings.Contains(token, "~") {
+		return token, nil
+	}
+	var b strings.Builder
+	for i := 0; i < len(token); i++ {
+		if token[i] != '~' {
+			b.WriteByte(token[i])
+			continue
+		}
+		if i+1 == len(token) || (token[i+1] != '0' && token[i+1] != '1') {
+			return "", fmt.Errorf("invalid escape in %q", token)
+		}
+		if token[i+1] == '0' {
+			b.WriteByte('~')
+		} else {
+			b.WriteByte('/')
+		}
+		i++
+	}
+	return b.String(), nil
+}
+
+// pointerIndex parses an array index reference token.
+func pointerIndex(token string) (int, error) {
+	if token == "" || (len(token) > 1 && token[0] == '0') || strings.TrimLeft(token, "0123456789") != "" {
+		return 0, fmt.Errorf("invalid array index %q", token)
+	}
+	index, err := strconv.Atoi(token)
+	if err != nil {
+		return 0, fmt.Errorf("invalid array index %q", token)
+	}
+	return index, nil
+}
@@ -0,0 +1,63 @@
+package json2xml
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestSelectSubtree(t *testing.T) {
+	data := map[string]any{
+		"results": []any{
+			map[string]any{"items": []any{"a", "b"}},
+		},
+		"a/b": 1,
+		"m~n": 2,
+		"":    3,
+		"typed": map[string][]int{
+			"nums": {10, 20},
+		},
+	}
+
+	tests := []struct {
+		pointer  string
+		expected any
+	}{
+		{"", data},
+		{"/results/0/items", []any{"a", "b"}},
+		{"/results/0/items/1", "b"},
+		{"/a~1b", 1},
+		{"/m~0n", 2},
+		{"/", 3},
+		{"/typed/nums/1", 20},
+	}
+	for _, tt := range tests {
+		t.Run(tt.pointer, func(t *testing.T) {
+			got, err := SelectSubtree(data, tt.pointer)
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("expected %#v, got %#v", tt.expected, got)
+			}
+		})
+	}
+
+	for _, pointer := range []string{
+		"results",
+		"/missing",
+		"/results/1",
+		"/results/01",
+		"/results/-",
+		"/results/x",
+		"/a~1b/deeper",
+		"/m~2n",
+		"/m~",
+	} {
+		t.Run("error "+pointer, func(t *testing.T) {
+			if _, err := SelectSubtree(data, pointer); !errors.Is(err, ErrInvalidData) {
+				t.Errorf("expected ErrInvalidData, got %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,55 @@
+package json2xml
+
+// Stats describes the XML produced by ConvertWithStats.
+type Stats struct {
+	// Elements is the number of elements written, including the root and
+	// any <chunk> elements but not those inside RawXMLKeys fragments.
+	Elements int
+	// Attributes is the number of attributes written, including type
+	// attributes and namespace declarations.
+	Attributes int
+	// MaxDepth is the deepest element nesting, counting the root (or the
+	// outermost elements without one) as 1.
+	MaxDepth int
+	// ListSizes holds the number of items of every list converted, in
+	// document order.
+	ListSizes []int
+	// Bytes is the size of the output.
+	Bytes int
+}
+
+// ConvertWithStats converts data like DictToXML and also returns
+// statistics gathered while converting, to help find what makes a
+// document unexpectedly large. With XPathFormat only Bytes is filled in.
+func ConvertWithStats(data any, opts Options) ([]byte, Stats, error) {
+	var stats Stats
+	opts.stats = &stats
+	output, err := dictToXML(data, opts)
+	if err != nil {
+		return nil, Stats{}, err
+	}
+	stats.Bytes = len(output)
+	return output, stats, nil
+}
+
+// countElement records an element entered at opts.depth.
+func (opts Options) countElement() {
+	if opts.stats != nil {
+		opts.stats.Elements++
+		opts.stats.MaxDepth = max(opts.stats.MaxDepth, opts.depth+1)
+	}
+}
+
+// countAttributes records n attributes written on one element.
+func (opts Options) countAttributes(n int) {
+	if opts.stats != nil {
+		opts.stats.Attributes += n
+	}
+}
+
+// countList records a list of n items.
+func (opts Options) countList(n int) {
+	if opts.stats != nil {
+		opts.stats.ListSizes = append(opts.stats.ListSizes, n)
+	}
+}
@@ -0,0 +1,117 @@
+package json2xml
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestConvertWithStats(t *testing.T) {
+	data := map[string]any{
+		"name":  "Bike",
+		"parts": []any{map[string]any{"id": 1}, map[string]any{"id": 2}},
+		"tags":  []any{"a", "b", "c"},
+	}
+
+	output, stats, err := ConvertWithStats(data, DefaultOptions())
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if !bytes.Equal(output, DictToXML(data, DefaultOptions())) {
+		t.Errorf("expected the DictToXML output, got %s", output)
+	}
+
+	expected := Stats{Elements: 11, Attributes: 10, MaxDepth: 4, ListSizes: []int{2, 3}, Bytes: len(output)}
+	if !reflect.DeepEqual(stats, expected) {
+		t.Errorf("expected %+v, got %+v", expected, stats)
+	}
+
+	t.Run("without a root", func(t *testing.T) {
+		opts := DefaultOptions()
+		opts.Root = false
+		opts.AttrType = false
+		_, stats, err := ConvertWithStats(data, opts)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if stats.Elements != 10 || stats.Attributes != 0 || stats.MaxDepth != 3 {
+			t.Errorf("unexpected stats %+v", stats)
+		}
+	})
+
+	t.Run("namespaces and nested lists", func(t *testing.T) {
+		opts := DefaultOptions()
+		opts.AttrType = false
+		opts.XMLNamespaces = map[string]any{"xmlns": "http://example.com/"}
+		_, stats, err := ConvertWithStats([]any{[]any{1, 2}, []any{}}, opts)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if stats.Attributes != 1 || !reflect.DeepEqual(stats.ListSizes, []int{2, 2, 0}) {
+			t.Errorf("unexpected stats %+v", stats)
+		}
+	})
+
+	t.Run("XPath fills in only the size", func(t *testing.T) {
+		opts := DefaultOptions()
+		opts.XPathFormat = true
+		output, stats, err := ConvertWithStats(data, opts)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if !reflect.DeepEqual(stats, Stats{Bytes: len(output)}) {
+			t.Errorf("unexpected stats %+v", stats)
+		}
+	})
+
+	t.Run("with a root element count", func(t *testing.T) {
+		opts := DefaultOptions()
+		opts.RootElementCountAttr = "count"
+		output, stats, err := ConvertWithStats(data, opts)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if !bytes.Contains(output, []byte(`count="10"`)) {
+			t.Errorf("expected the root to count 10 elements, got %s", output)
+		}
+		if stats.Elements != 11 || stats.Attributes != 11 {
+			t.Errorf("unexpected stats %+v", stats)
+		}
+	})
+
+	t.Run("builder", func(t *testing.T) {
+		calls := 0
+		opts := DefaultOptions()
+		opts.OnElement = func(string, int) { calls++ }
+		xmlString, stats, err := NewWithOptions(data, opts).ToXMLStringWithStats()
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if calls != 11 {
+			t.Errorf("expected one conversion of 11 elements, got %d calls", calls)
+		}
+		pretty, err := NewWithOptions(data, DefaultOptions()).ToXMLString()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if xmlString != pretty {
+			t.Errorf("expected the ToXMLString output, got %s", xmlString)
+		}
+		if stats.Elements != 11 || stats.Bytes != len(xmlString) {
+			t.Errorf("unexpected stats %+v", stats)
+		}
+
+		if xmlString, stats, err := New(nil).ToXMLStringWithStats(); xmlString != "" || stats.Elements != 0 || err != nil {
+			t.Errorf("expected nothing for nil data, got %q, %+v, %v", xmlString, stats, err)
+		}
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		opts := DefaultOptions()
+		opts.MaxDepth = 1
+		if _, _, err := ConvertWithStats(data, opts); !errors.Is(err, ErrMaxDepth) {
+			t.Errorf("expected ErrMaxDepth, got %v", err)
+		}
+	})
+}
@@ -0,0 +1,357 @@
+package json2xml
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"strings"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/ianaindex"
+	"golang.org/x/text/transform"
+)
+
+// StreamFile converts the JSON document at inPath to XML written to outPath
+// without holding the whole document in memory.
+//
+// When the top-level value is an array, its items are decoded, converted and
+// written one at a time. Other top-level values are decoded whole, as are
+// documents converted with XPathFormat, RepairOutput or Minify, which need
+// the full tree. Output is never pretty-printed.
+//
+// Like the other error-returning conversions, StreamFile enforces MaxDepth
+// and AllowedKinds, checking each array item before it is converted. The
+// XML goes to a temporary file that replaces outPath, with permissions
+// 0644, only once the conversion succeeds, so a failure leaves an existing
+// file at outPath untouched.
+func StreamFile(inPath, outPath string, opts Options) error {
+	in, err := os.Open(inPath)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrJSONRead, err)
+	}
+	defer func() { _ = in.Close() }()
+
+	return writeFileAtomic(outPath, 0o644, func(out io.Writer) error {
+		writer := bufio.NewWriter(out)
+		if err := streamJSON(in, writer, opts); err != nil {
+			return err
+		}
+		return writer.Flush()
+	})
+}
+
+// WriteXML converts data to XML and writes it to w. The elements for each
+// top-level map entry or list item are written as soon as they are
+// converted, so the complete document is never held in memory; only the
+// largest single entry is. The output is identical to DictToXML.
+//
+// Documents converted with XPathFormat, RepairOutput, Minify or
+// RootElementCountAttr need the full tree, and top-level scalars are
+// small; both are built whole first.
+func WriteXML(w io.Writer, data any, opts Options) error {
+	if opts.ItemFunc == nil {
+		opts.ItemFunc = DefaultItemFunc
+	}
+	if err := checkData(data, opts); err != nil {
+		return err
+	}
+	if err := checkDocument(opts); err != nil {
+		return err
+	}
+	if opts.XPathFormat || opts.RepairOutput || opts.Minify || opts.RootElementCountAttr != "" || !isContainer(data, opts) {
+		return writeDocument(w, data, opts)
+	}
+
+	var failure error
+	opts.failure = &failure
+	writer := bufio.NewWriter(w)
+	if opts.Root {
+		startTag, childOpts := rootStartTag(opts, GetXMLType(data))
+		if _, err := io.WriteString(writer, opts.prolog()+startTag); err != nil {
+			return err
+		}
+		if err := writeValue(writer, data, childOpts, opts.CustomRoot); err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintf(writer, "</%s>", opts.CustomRoot); err != nil {
+			return err
+		}
+	} else if err := writeValue(writer, data, opts, ""); err != nil {
+		return err
+	}
+	if failure != nil {
+		return failure
+	}
+	return writer.Flush()
+}
+
+// writeDocument converts data in full with DictToXML and writes it to w.
+func writeDocument(w io.Writer, data any, opts Options) error {
+	output, err := dictToXML(data, opts)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(output)
+	return err
+}
+
+// WriteXMLEncoded writes data like WriteXML, transcoded to opts.Charset.
+// The declaration names the charset unless XMLDeclaration overrides it.
+// Characters the charset cannot represent are written as numeric
+// character references (&#8364;), which is only valid in text and
+// attribute values: names that need them, and CDATA sections, come out
+// wrong, so avoid CDATA with narrow charsets.
+//
+// An empty Charset or UTF-8 writes exactly what WriteXML does, without
+// transcoding. Charset names are IANA names such as "windows-1252" or
+// "ISO-8859-1"; unknown or unsupported names return ErrInvalidData.
+func WriteXMLEncoded(w io.Writer, data any, opts Options) error {
+	enc, err := charsetEncoding(opts.Charset)
+	if err != nil {
+		return err
+	}
+	if enc == nil {
+		return WriteXML(w, data, opts)
+	}
+
+	if opts.XMLDeclaration == nil {
+		decl := fmt.Sprintf(`<?xml version="1.0" encoding="%s" ?>`, opts.Charset)
+		opts.XMLDeclaration = &decl
+	}
+	writer := transform.NewWriter(w, encoding.HTMLEscapeUnsupported(enc.NewEncoder()))
+	if err := WriteXML(writer, data, opts); err != nil {
+		return err
+	}
+	return writer.Close()
+}
+
+// charsetEncoding looks up an IANA charset name, returning nil for UTF-8.
+func charsetEncoding(charset string) (encoding.Encoding, error) {
+	if charset == "" || strings.EqualFold(charset, "utf-8") || strings.EqualFold(charset, "utf8") {
+		return nil, nil
+	}
+	enc, err := ianaindex.IANA.Encoding(charset)
+	if err != nil || enc == nil {
+		return nil, fmt.Errorf("%w: unsupported charset %q", ErrInvalidData, charset)
+	}
+	return enc, nil
+}
+
+// writeValue writes obj like Convert, streaming the entries of maps and lists.
+func writeValue(w io.Writer, obj any, opts Options, parent string) error {
+	if isContainer(obj, opts) {
+		switch v := normalizeValue(obj).(type) {
+		case map[string]any:
+			return writeDict(w, v, opts.withKeyOrder(obj), parent)
+		case []any:
+			return writeList(w, v, opts, parent)
+		}
+	}
+	_, err := io.WriteString(w, Convert(obj, opts, parent))
+	return err
+}
+
+// isContainer reports whether obj converts as a map or a list. Structs
+// convert as maps.
+func isContainer(obj any, opts Options) bool {
+	if raw, ok := obj.(json.RawMessage); ok {
+		obj = decodeRawMessage(raw)
+	}
+	if _, ok := handleType(obj, opts); ok || obj == nil {
+		return false
+	}
+	switch reflect.ValueOf(obj).Kind() {
+	case reflect.Map, reflect.Struct, reflect.Slice, reflect.Array:
+		return true
+	case reflect.Pointer:
+		return isContainer(indirect(obj), opts)
+	}
+	return false
+}
+
+// ConvertNDJSON converts newline-delimited JSON read from r, one value per
+// line, writing one XML fragment per record to w as it goes. Each record is
+// converted like an item of a top-level array, so it becomes a single
+// element named by ItemFunc. Fragments are separated by newlines, or
+// minified and written back to back with Minify; when
+// Root is set they are wrapped in the root element, which is opened before
+// the first record and closed after the last. Blank lines are skipped.
+// A malformed line stops the conversion with an ErrJSONRead error giving
+// its line number.
+func ConvertNDJSON(r io.Reader, w io.Writer, opts Options) error {
+	if opts.ItemFunc == nil {
+		opts.ItemFunc = DefaultItemFunc
+	}
+	if err := checkDocument(opts); err != nil {
+		return err
+	}
+
+	separator := "\n"
+	if opts.Minify {
+		separator = ""
+	}
+
+	writer := bufio.NewWriter(w)
+	parent := ""
+	itemOpts := listOptions(opts)
+	if opts.Root {
+		parent = opts.CustomRoot
+		var startTag string
+		startTag, itemOpts = rootStartTag(itemOpts, "list")
+		if _, err := io.WriteString(writer, opts.prolog()+startTag+separator); err != nil {
+			return err
+		}
+	}
+	var failure error
+	itemOpts.failure = &failure
+
+	reader := bufio.NewReader(bomReader(r))
+	for lineNum, index := 1, 0; ; lineNum++ {
+		line, readErr := reader.ReadBytes('\n')
+		if readErr != nil && readErr != io.EOF {
+			return fmt.Errorf("%w: line %d: %v", ErrJSONRead, lineNum, readErr)
+		}
+
+		if line = bytes.TrimSpace(line); len(line) > 0 {
+			var record any
+			if err := json.Unmarshal(line, &record); err != nil {
+				return fmt.Errorf("%w: line %d: %v", ErrJSONRead, lineNum, err)
+			}
+			if err := checkData([]any{record}, opts); err != nil {
+				return fmt.Errorf("line %d: %w", lineNum, err)
+			}
+			fragment := convertListItem(record, index, parent, itemOpts)
+			if failure != nil {
+				return fmt.Errorf("line %d: %w", lineNum, failure)
+			}
+			if opts.Minify {
+				fragment = string(minifyXML([]byte(fragment)))
+			}
+			if _, err := io.WriteString(writer, fragment+separator); err != nil {
+				return err
+			}
+			index++
+		}
+
+		if readErr == io.EOF {
+			break
+		}
+	}
+
+	if opts.Root {
+		if _, err := fmt.Fprintf(writer, "</%s>", opts.CustomRoot); err != nil {
+			return err
+		}
+	}
+	return writer.Flush()
+}
+
+// countingWriter counts the bytes written to an underlying writer.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// streamJSON decodes JSON from r and writes the converted XML to w.
+func streamJSON(r io.Reader, w io.Writer, opts Options) error {
+	if opts.ItemFunc == nil {
+		opts.ItemFunc = DefaultItemFunc
+	}
+	if err := checkDocument(opts); err != nil {
+		return err
+	}
+
+	reader := bufio.NewReader(bomReader(r))
+	first, err := peekNonSpace(reader)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrJSONRead, err)
+	}
+
+	decoder := json.NewDecoder(reader)
+	if first != '[' || opts.XPathFormat || opts.RepairOutput || opts.Minify {
+		var data any
+		if err := decoder.Decode(&data); err != nil {
+			return fmt.Errorf("%w: %v", ErrJSONRead, err)
+		}
+		return writeDocument(w, data, opts)
+	}
+
+	return streamJSONArray(decoder, w, opts)
+}
+
+// streamJSONArray converts a top-level JSON array item by item.
+func streamJSONArray(decoder *json.Decoder, w io.Writer, opts Options) error {
+	if _, err := decoder.Token(); err != nil {
+		return fmt.Errorf("%w: %v", ErrJSONRead, err)
+	}
+
+	parent := ""
+	itemOpts := listOptions(opts)
+	if opts.Root {
+		parent = opts.CustomRoot
+		var startTag string
+		startTag, itemOpts = rootStartTag(itemOpts, "list")
+		if _, err := io.WriteString(w, opts.prolog()+startTag); err != nil {
+			return err
+		}
+	}
+	var failure error
+	itemOpts.failure = &failure
+	for i := 0; decoder.More(); i++ {
+		var item any
+		if err := decoder.Decode(&item); err != nil {
+			return fmt.Errorf("%w: %v", ErrJSONRead, err)
+		}
+		// Checked inside its array, the item counts the top-level
+		// nesting level as the whole document would.
+		if err := checkData([]any{item}, opts); err != nil {
+			return fmt.Errorf("item %d: %w", i, err)
+		}
+		fragment := convertListItem(item, i, parent, itemOpts)
+		if failure != nil {
+			return failure
+		}
+		if _, err := io.WriteString(w, fragment); err != nil {
+			return err
+		}
+	}
+
+	if _, err := decoder.Token(); err != nil {
+		return fmt.Errorf("%w: %v", ErrJSONRead, err)
+	}
+
+	if opts.Root {
+		if _, err := fmt.Fprintf(w, "</%s>", opts.CustomRoot); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// peekNonSpace skips leading JSON whitespace and returns the next byte without consuming it.
+func peekNonSpace(reader *bufio.Reader) (byte, error) {
+	for {
+		b, err := reader.Peek(1)
+		if err != nil {
+			return 0, err
+		}
+		switch b[0] {
+		case ' ', '\t', '\n', '\r':
+			if _, err := reader.ReadByte(); err != nil {
+				return 0, err
+			}
+		default:
+			return b[0], nil
+		}
+	}
+}
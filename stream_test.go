@@ -0,0 +1,425 @@
+package json2xml
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestStreamFile(t *testing.T) {
+	dir := t.TempDir()
+
+	t.Run("small array matches in-memory conversion", func(t *testing.T) {
+		input := `[{"name": "Bike", "gears": [1, 2]}, "plain", 3.5, true, null]`
+		inPath := filepath.Join(dir, "small.json")
+		outPath := filepath.Join(dir, "small.xml")
+		if err := os.WriteFile(inPath, []byte(input), 0644); err != nil {
+			t.Fatalf("failed to write input: %v", err)
+		}
+
+		for _, root := range []bool{true, false} {
+			opts := DefaultOptions()
+			opts.Root = root
+			if err := StreamFile(inPath, outPath, opts); err != nil {
+				t.Fatalf("StreamFile returned error: %v", err)
+			}
+
+			got, err := os.ReadFile(outPath)
+			if err != nil {
+				t.Fatalf("failed to read output: %v", err)
+			}
+			data, _ := ReadFromString(input)
+			if expected := DictToXML(data, opts); !bytes.Equal(got, expected) {
+				t.Errorf("root=%v: expected %s, got %s", root, expected, got)
+			}
+		}
+	})
+
+	t.Run("large generated array", func(t *testing.T) {
+		inPath := filepath.Join(dir, "large.json")
+		outPath := filepath.Join(dir, "large.xml")
+
+		var input strings.Builder
+		input.WriteString("[\n")
+		const count = 20000
+		for i := 0; i < count; i++ {
+			if i > 0 {
+				input.WriteString(",\n")
+			}
+			fmt.Fprintf(&input, `{"id": %d, "name": "record %d"}`, i, i)
+		}
+		input.WriteString("\n]")
+		if err := os.WriteFile(inPath, []byte(input.String()), 0644); err != nil {
+			t.Fatalf("failed to write input: %v", err)
+		}
+
+		opts := DefaultOptions()
+		opts.AttrType = false
+		if err := StreamFile(inPath, outPath, opts); err != nil {
+			t.Fatalf("StreamFile returned error: %v", err)
+		}
+
+		got, err := os.ReadFile(outPath)
+		if err != nil {
+			t.Fatalf("failed to read output: %v", err)
+		}
+		if err := checkWellFormed(got); err != nil {
+			t.Fatalf("expected well-formed output: %v", err)
+		}
+		if n := bytes.Count(got, []byte("<item>")); n != count {
+			t.Errorf("expected %d items, got %d", count, n)
+		}
+		if !bytes.Contains(got, []byte("<item><id>19999</id><name>record 19999</name></item></root>")) {
+			t.Errorf("unexpected tail: %s", got[len(got)-100:])
+		}
+	})
+
+	t.Run("object documents are converted whole", func(t *testing.T) {
+		inPath := filepath.Join(dir, "object.json")
+		outPath := filepath.Join(dir, "object.xml")
+		if err := os.WriteFile(inPath, []byte(` {"b": 1, "a": [2]}`), 0644); err != nil {
+			t.Fatalf("failed to write input: %v", err)
+		}
+
+		opts := DefaultOptions()
+		if err := StreamFile(inPath, outPath, opts); err != nil {
+			t.Fatalf("StreamFile returned error: %v", err)
+		}
+		got, _ := os.ReadFile(outPath)
+		expected := DictToXML(map[string]any{"b": 1.0, "a": []any{2.0}}, opts)
+		if !bytes.Equal(got, expected) {
+			t.Errorf("expected %s, got %s", expected, got)
+		}
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		if err := StreamFile(filepath.Join(dir, "missing.json"), filepath.Join(dir, "out.xml"), DefaultOptions()); !errors.Is(err, ErrJSONRead) {
+			t.Errorf("expected ErrJSONRead for missing input, got %v", err)
+		}
+
+		badPath := filepath.Join(dir, "bad.json")
+		if err := os.WriteFile(badPath, []byte(`[1, oops]`), 0644); err != nil {
+			t.Fatalf("failed to write input: %v", err)
+		}
+		if err := StreamFile(badPath, filepath.Join(dir, "out.xml"), DefaultOptions()); !errors.Is(err, ErrJSONRead) {
+			t.Errorf("expected ErrJSONRead for malformed input, got %v", err)
+		}
+
+		if err := StreamFile(badPath, dir, DefaultOptions()); err == nil {
+			t.Error("expected error when output path is a directory")
+		}
+	})
+
+	t.Run("byte order marks", func(t *testing.T) {
+		for name, input := range map[string][]byte{
+			"UTF-8 array":     []byte("\xEF\xBB\xBF[\"a\", 1]"),
+			"UTF-8 object":    []byte("\xEF\xBB\xBF{\"a\": 1}"),
+			"UTF-16LE array":  utf16Bytes(`["a", 1]`, false),
+			"UTF-16BE object": utf16Bytes(`{"a": 1}`, true),
+		} {
+			inPath := filepath.Join(dir, "bom.json")
+			outPath := filepath.Join(dir, "bom.xml")
+			if err := os.WriteFile(inPath, input, 0644); err != nil {
+				t.Fatalf("failed to write input: %v", err)
+			}
+			if err := StreamFile(inPath, outPath, DefaultOptions()); err != nil {
+				t.Fatalf("%s: StreamFile returned error: %v", name, err)
+			}
+			got, _ := os.ReadFile(outPath)
+			data, err := ReadFromJSON(inPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if expected := DictToXML(data, DefaultOptions()); !bytes.Equal(got, expected) {
+				t.Errorf("%s: expected %s, got %s", name, expected, got)
+			}
+		}
+	})
+
+	t.Run("depth and kind limits", func(t *testing.T) {
+		deep := strings.Repeat(`{"a":`, 50) + "1" + strings.Repeat("}", 50)
+		opts := DefaultOptions()
+		opts.MaxDepth = 10
+		for name, input := range map[string]string{"array": "[" + deep + "]", "object": deep} {
+			inPath := filepath.Join(dir, "deep-"+name+".json")
+			if err := os.WriteFile(inPath, []byte(input), 0644); err != nil {
+				t.Fatalf("failed to write input: %v", err)
+			}
+			if err := StreamFile(inPath, filepath.Join(dir, "deep.xml"), opts); !errors.Is(err, ErrMaxDepth) {
+				t.Errorf("%s: expected ErrMaxDepth, got %v", name, err)
+			}
+		}
+
+		inPath := filepath.Join(dir, "floats.json")
+		if err := os.WriteFile(inPath, []byte(`["a", {"n": 1.5}]`), 0644); err != nil {
+			t.Fatalf("failed to write input: %v", err)
+		}
+		opts = DefaultOptions()
+		opts.AllowedKinds = []reflect.Kind{reflect.Slice, reflect.Map, reflect.String}
+		if err := StreamFile(inPath, filepath.Join(dir, "floats.xml"), opts); !errors.Is(err, ErrUnsupportedType) {
+			t.Errorf("expected ErrUnsupportedType, got %v", err)
+		}
+	})
+
+	t.Run("failure keeps the existing output", func(t *testing.T) {
+		sub := t.TempDir()
+		outPath := filepath.Join(sub, "out.xml")
+		if err := os.WriteFile(outPath, []byte("<old/>"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		badPath := filepath.Join(sub, "bad.json")
+		if err := os.WriteFile(badPath, []byte(`[1, 2, oops]`), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := StreamFile(badPath, outPath, DefaultOptions()); !errors.Is(err, ErrJSONRead) {
+			t.Fatalf("expected ErrJSONRead, got %v", err)
+		}
+		if got, _ := os.ReadFile(outPath); string(got) != "<old/>" {
+			t.Errorf("expected the old file to survive, got %q", got)
+		}
+		entries, err := os.ReadDir(sub)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(entries) != 2 {
+			t.Errorf("expected no temporary files left, got %v", entries)
+		}
+	})
+}
+
+type failingWriter struct{}
+
+func (failingWriter) Write(p []byte) (int, error) {
+	return 0, errors.New("write failed")
+}
+
+func TestWriteXML(t *testing.T) {
+	data := map[string]any{
+		"name":  "Bike",
+		"gears": []any{1.0, 2.0},
+		"owner": map[string]any{"first": "Ada"},
+		"sold":  nil,
+	}
+
+	cases := map[string]func(*Options){
+		"defaults":     func(o *Options) {},
+		"no root":      func(o *Options) { o.Root = false },
+		"no item wrap": func(o *Options) { o.ItemWrap = false },
+		"entries":      func(o *Options) { o.MapAsEntries = true },
+		"xpath":        func(o *Options) { o.XPathFormat = true },
+		"count":        func(o *Options) { o.RootElementCountAttr = "count" },
+	}
+	for name, configure := range cases {
+		t.Run(name, func(t *testing.T) {
+			opts := DefaultOptions()
+			configure(&opts)
+
+			var buf bytes.Buffer
+			if err := WriteXML(&buf, data, opts); err != nil {
+				t.Fatalf("WriteXML returned error: %v", err)
+			}
+			if expected := DictToXML(data, opts); !bytes.Equal(buf.Bytes(), expected) {
+				t.Errorf("expected %s, got %s", expected, buf.Bytes())
+			}
+		})
+	}
+
+	t.Run("top-level list and scalar", func(t *testing.T) {
+		for _, value := range []any{[]any{"a", map[string]any{"b": 1}}, "plain", nil} {
+			var buf bytes.Buffer
+			if err := WriteXML(&buf, value, Options{Root: true, CustomRoot: "root"}); err != nil {
+				t.Fatalf("WriteXML returned error: %v", err)
+			}
+			if expected := DictToXML(value, Options{Root: true, CustomRoot: "root"}); !bytes.Equal(buf.Bytes(), expected) {
+				t.Errorf("expected %s, got %s", expected, buf.Bytes())
+			}
+		}
+	})
+
+	t.Run("write errors", func(t *testing.T) {
+		for _, root := range []bool{true, false} {
+			opts := DefaultOptions()
+			opts.Root = root
+			if err := WriteXML(failingWriter{}, data, opts); err == nil {
+				t.Errorf("root=%v: expected write error", root)
+			}
+		}
+	})
+
+	t.Run("large list streams every item", func(t *testing.T) {
+		items := make([]any, 5000)
+		for i := range items {
+			items[i] = fmt.Sprintf("item-%d", i)
+		}
+		var buf bytes.Buffer
+		if err := WriteXML(&buf, items, DefaultOptions()); err != nil {
+			t.Fatalf("WriteXML returned error: %v", err)
+		}
+		if got := strings.Count(buf.String(), "<item "); got != len(items) {
+			t.Errorf("expected %d items, got %d", len(items), got)
+		}
+	})
+}
+
+func TestWriteXMLEncoded(t *testing.T) {
+	data := map[string]any{"name": "Café ✓", "price": "12 €"}
+
+	t.Run("windows-1252", func(t *testing.T) {
+		opts := DefaultOptions()
+		opts.Charset = "windows-1252"
+		var buf bytes.Buffer
+		if err := WriteXMLEncoded(&buf, data, opts); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		expected := "<?xml version=\"1.0\" encoding=\"windows-1252\" ?><root>" +
+			"<name type=\"str\">Caf\xe9 &#10003;</name><price type=\"str\">12 \x80</price></root>"
+		if buf.String() != expected {
+			t.Errorf("expected %q, got %q", expected, buf.String())
+		}
+	})
+
+	t.Run("ISO-8859-1 escapes the euro sign", func(t *testing.T) {
+		opts := DefaultOptions()
+		opts.Charset = "ISO-8859-1"
+		var buf bytes.Buffer
+		if err := WriteXMLEncoded(&buf, data, opts); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if !strings.Contains(buf.String(), "12 &#8364;") {
+			t.Errorf("expected a character reference for the euro sign, got %q", buf.String())
+		}
+	})
+
+	t.Run("custom declaration wins", func(t *testing.T) {
+		opts := DefaultOptions()
+		opts.Charset = "windows-1252"
+		empty := ""
+		opts.XMLDeclaration = &empty
+		var buf bytes.Buffer
+		if err := WriteXMLEncoded(&buf, data, opts); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if !strings.HasPrefix(buf.String(), "<root>") {
+			t.Errorf("expected no declaration, got %q", buf.String())
+		}
+	})
+
+	t.Run("UTF-8 matches WriteXML", func(t *testing.T) {
+		for _, charset := range []string{"", "UTF-8"} {
+			opts := DefaultOptions()
+			opts.Charset = charset
+			var buf bytes.Buffer
+			if err := WriteXMLEncoded(&buf, data, opts); err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if expected := string(DictToXML(data, opts)); buf.String() != expected {
+				t.Errorf("charset %q: expected %q, got %q", charset, expected, buf.String())
+			}
+		}
+	})
+
+	t.Run("unknown charset", func(t *testing.T) {
+		opts := DefaultOptions()
+		opts.Charset = "klingon"
+		if err := WriteXMLEncoded(&bytes.Buffer{}, data, opts); !errors.Is(err, ErrInvalidData) {
+			t.Errorf("expected ErrInvalidData, got %v", err)
+		}
+	})
+}
+
+func TestConvertNDJSON(t *testing.T) {
+	input := "{\"name\": \"Bike\", \"gears\": 21}\n\n  \n[1, 2]\n\"plain\"\r\nnull"
+
+	t.Run("with root", func(t *testing.T) {
+		var buf bytes.Buffer
+		if err := ConvertNDJSON(strings.NewReader(input), &buf, DefaultOptions()); err != nil {
+			t.Fatalf("ConvertNDJSON returned error: %v", err)
+		}
+		expected := `<?xml version="1.0" encoding="UTF-8" ?><root>` + "\n" +
+			`<item type="dict"><gears type="float">21</gears><name type="str">Bike</name></item>` + "\n" +
+			`<item type="list"><item type="float">1</item><item type="float">2</item></item>` + "\n" +
+			`<item type="str">plain</item>` + "\n" +
+			`<item type="null"></item>` + "\n" +
+			`</root>`
+		if buf.String() != expected {
+			t.Errorf("expected %s, got %s", expected, buf.String())
+		}
+		if err := checkWellFormed(buf.Bytes()); err != nil {
+			t.Errorf("expected well-formed output, got %v", err)
+		}
+	})
+
+	t.Run("byte order mark", func(t *testing.T) {
+		opts := DefaultOptions()
+		opts.Root = false
+		opts.AttrType = false
+		var buf bytes.Buffer
+		if err := ConvertNDJSON(strings.NewReader("\xEF\xBB\xBF{\"a\": 1}\n{\"a\": 2}\n"), &buf, opts); err != nil {
+			t.Fatalf("ConvertNDJSON returned error: %v", err)
+		}
+		if expected := "<item><a>1</a></item>\n<item><a>2</a></item>\n"; buf.String() != expected {
+			t.Errorf("expected %q, got %q", expected, buf.String())
+		}
+	})
+
+	t.Run("fragments without root", func(t *testing.T) {
+		opts := DefaultOptions()
+		opts.Root = false
+		opts.AttrType = false
+		var buf bytes.Buffer
+		if err := ConvertNDJSON(strings.NewReader("{\"a\": 1}\n{\"a\": 2}\n"), &buf, opts); err != nil {
+			t.Fatalf("ConvertNDJSON returned error: %v", err)
+		}
+		if expected := "<item><a>1</a></item>\n<item><a>2</a></item>\n"; buf.String() != expected {
+			t.Errorf("expected %q, got %q", expected, buf.String())
+		}
+	})
+
+	t.Run("typed root", func(t *testing.T) {
+		opts := DefaultOptions()
+		opts.RootAttrType = true
+		var buf bytes.Buffer
+		if err := ConvertNDJSON(strings.NewReader("1\n"), &buf, opts); err != nil {
+			t.Fatalf("ConvertNDJSON returned error: %v", err)
+		}
+		if !strings.Contains(buf.String(), `<root type="list">`) {
+			t.Errorf("expected a list-typed root, got %s", buf.String())
+		}
+	})
+
+	t.Run("minified", func(t *testing.T) {
+		opts := DefaultOptions()
+		opts.AttrType = false
+		opts.Minify = true
+		var buf bytes.Buffer
+		if err := ConvertNDJSON(strings.NewReader("{\"a\": 1}\n{\"a\": 2}\n"), &buf, opts); err != nil {
+			t.Fatalf("ConvertNDJSON returned error: %v", err)
+		}
+		expected := "<root><item><a>1</a></item><item><a>2</a></item></root>"
+		if buf.String() != expected {
+			t.Errorf("expected %s, got %s", expected, buf.String())
+		}
+	})
+
+	t.Run("malformed line", func(t *testing.T) {
+		var buf bytes.Buffer
+		err := ConvertNDJSON(strings.NewReader("{\"a\": 1}\n\n{\"a\": \n"), &buf, DefaultOptions())
+		if !errors.Is(err, ErrJSONRead) {
+			t.Fatalf("expected ErrJSONRead, got %v", err)
+		}
+		if !strings.Contains(err.Error(), "line 3") {
+			t.Errorf("expected line number in error, got %v", err)
+		}
+	})
+
+	t.Run("write errors", func(t *testing.T) {
+		if err := ConvertNDJSON(strings.NewReader(strings.Repeat("{\"a\": \"x\"}\n", 1000)), failingWriter{}, DefaultOptions()); err == nil {
+			t.Error("expected write error")
+		}
+	})
+}
@@ -0,0 +1,112 @@
+package json2xml
+
+import (
+	"reflect"
+	"strings"
+)
+
+// structToMap returns the fields of the struct rv keyed the way
+// encoding/json names them: by the name in their json tag, or else by the
+// field name. Unexported fields, fields tagged "-", and empty fields
+// tagged omitempty or zero fields tagged omitzero are left out. The fields
+// of embedded structs without a tag name are promoted unless a field of
+// the outer struct has the same name. Unlike encoding/json, MarshalJSON
+// methods are not called and the string option is ignored.
+func structToMap(rv reflect.Value) map[string]any {
+	fields := make(map[string]any, rv.NumField())
+	var embedded []reflect.Value
+
+	for i := 0; i < rv.NumField(); i++ {
+		field := rv.Type().Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, options, _ := strings.Cut(tag, ",")
+		value := rv.Field(i)
+
+		if field.Anonymous && name == "" {
+			inner := value
+			if inner.Kind() == reflect.Pointer {
+				if inner.IsNil() {
+					continue
+				}
+				inner = inner.Elem()
+			}
+			if inner.Kind() == reflect.Struct {
+				embedded = append(embedded, inner)
+				continue
+			}
+		}
+		if !field.IsExported() || !value.CanInterface() {
+			continue
+		}
+		if omitField(value, options) {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		fields[name] = value.Interface()
+	}
+
+	for _, inner := range embedded {
+		for name, value := range structToMap(inner) {
+			if _, ok := fields[name]; !ok {
+				fields[name] = value
+			}
+		}
+	}
+	return fields
+}
+
+// omitField reports whether the json tag options drop value.
+func omitField(value reflect.Value, options string) bool {
+	for option := range strings.SplitSeq(options, ",") {
+		switch option {
+		case "omitempty":
+			if isEmptyValue(value) {
+				return true
+			}
+		case "omitzero":
+			if value.IsZero() {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// isEmptyValue reports whether value is empty in the sense of omitempty:
+// false, 0, a nil pointer or interface, or an empty array, map, slice or
+// string.
+func isEmptyValue(value reflect.Value) bool {
+	switch value.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return value.Len() == 0
+	case reflect.Bool:
+		return !value.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return value.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return value.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return value.Float() == 0
+	case reflect.Interface, reflect.Pointer:
+		return value.IsNil()
+	}
+	return false
+}
+
+// indirect returns the value val points to, or nil for a nil pointer.
+// Other values are returned as they are.
+func indirect(val any) any {
+	rv := reflect.ValueOf(val)
+	if rv.Kind() != reflect.Pointer {
+		return val
+	}
+	if rv.IsNil() {
+		return nil
+	}
+	return rv.Elem().Interface()
+}
@@ -0,0 +1,161 @@
+package json2xml
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type structAddress struct {
+	City string `json:"city"`
+	Zip  string `json:"zip,omitempty"`
+}
+
+type structBase struct {
+	ID      int `json:"id"`
+	Created time.Time
+}
+
+type structUser struct {
+	structBase
+	Name     string         `json:"name"`
+	Email    string         `json:"email,omitempty"`
+	Password string         `json:"-"`
+	Dash     string         `json:"-,"`
+	Age      int            `json:",omitempty"`
+	Home     structAddress  `json:"home"`
+	Work     *structAddress `json:"work"`
+	Tags     []string       `json:"tags"`
+	Score    float64        `json:"score,omitzero"`
+	secret   string
+}
+
+func TestStructToMap(t *testing.T) {
+	created := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	user := structUser{
+		structBase: structBase{ID: 7, Created: created},
+		Name:       "Ada",
+		Password:   "hunter2",
+		Dash:       "d",
+		Home:       structAddress{City: "London"},
+		Tags:       []string{"a", "b"},
+		secret:     "s",
+	}
+
+	got := structToMap(reflect.ValueOf(user))
+	expected := map[string]any{
+		"id":      7,
+		"Created": created,
+		"name":    "Ada",
+		"-":       "d",
+		"home":    structAddress{City: "London"},
+		"work":    (*structAddress)(nil),
+		"tags":    []string{"a", "b"},
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %#v, got %#v", expected, got)
+	}
+
+	t.Run("outer fields win over promoted ones", func(t *testing.T) {
+		type inner struct{ Name, Kind string }
+		type outer struct {
+			inner
+			Name string
+		}
+		got := structToMap(reflect.ValueOf(outer{inner: inner{Name: "in", Kind: "k"}, Name: "out"}))
+		if got["Name"] != "out" || got["Kind"] != "k" {
+			t.Errorf("expected outer Name and promoted Kind, got %v", got)
+		}
+	})
+
+	t.Run("tagged and nil embedded structs", func(t *testing.T) {
+		type Address struct{ City string }
+		type Base struct{ ID int }
+		type outer struct {
+			Address `json:"address"`
+			*Base
+		}
+		got := structToMap(reflect.ValueOf(outer{Address: Address{City: "Paris"}}))
+		if len(got) != 1 || got["address"] != (Address{City: "Paris"}) {
+			t.Errorf("expected only the tagged address, got %v", got)
+		}
+	})
+}
+
+func TestConvertStructs(t *testing.T) {
+	opts := DefaultOptions()
+	opts.AttrType = false
+
+	user := structUser{
+		structBase: structBase{ID: 7, Created: time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)},
+		Name:       "Ada",
+		Home:       structAddress{City: "London", Zip: "N1"},
+		Work:       &structAddress{City: "Cambridge"},
+		Tags:       []string{"a", "b"},
+	}
+
+	expected := `<root><key name="-"></key><Created>2024-03-01T12:00:00Z</Created>` +
+		`<home><city>London</city><zip>N1</zip></home><id>7</id><name>Ada</name>` +
+		`<tags><item>a</item><item>b</item></tags><work><city>Cambridge</city></work></root>`
+	for _, data := range []any{user, &user, map[string]any{"user": user}} {
+		result := string(DictToXML(data, opts))
+		want := expected
+		if _, ok := data.(map[string]any); ok {
+			want = "<root><user>" + strings.TrimPrefix(strings.TrimSuffix(expected, "</root>"), "<root>") + "</user></root>"
+		}
+		if !strings.HasSuffix(result, want) {
+			t.Errorf("%T: expected %s, got %s", data, want, result)
+		}
+
+		var buf bytes.Buffer
+		if err := WriteXML(&buf, data, opts); err != nil || buf.String() != result {
+			t.Errorf("%T: expected WriteXML to match DictToXML, got %q (err %v)", data, buf.String(), err)
+		}
+	}
+
+	t.Run("type attributes", func(t *testing.T) {
+		result := string(DictToXML(map[string]any{"home": structAddress{City: "Oslo"}}, DefaultOptions()))
+		if !strings.Contains(result, `<home type="dict"><city type="str">Oslo</city></home>`) {
+			t.Errorf("expected a typed dict, got %s", result)
+		}
+	})
+
+	t.Run("lists of structs and nil pointers", func(t *testing.T) {
+		data := map[string]any{"places": []structAddress{{City: "A"}, {City: "B"}}, "none": (*structAddress)(nil)}
+		result := string(DictToXML(data, opts))
+		if !strings.Contains(result, `<places><item><city>A</city></item><item><city>B</city></item></places>`) {
+			t.Errorf("expected a list of structs, got %s", result)
+		}
+		if !strings.Contains(result, `<none></none>`) {
+			t.Errorf("expected an empty element for a nil pointer, got %s", result)
+		}
+	})
+
+	t.Run("selecting a field", func(t *testing.T) {
+		city, err := SelectSubtree(user, "/work/city")
+		if err != nil || city != "Cambridge" {
+			t.Errorf("expected Cambridge, got %v (err %v)", city, err)
+		}
+	})
+
+	t.Run("cycles", func(t *testing.T) {
+		type node struct {
+			Name string
+			Next *node
+		}
+		loop := &node{Name: "a"}
+		loop.Next = loop
+		if _, err := ConvertToXML(loop, &opts); !errors.Is(err, ErrMaxDepth) {
+			t.Errorf("expected ErrMaxDepth, got %v", err)
+		}
+
+		self := new(any)
+		*self = self
+		if _, err := ConvertToXML(map[string]any{"p": self}, &opts); !errors.Is(err, ErrMaxDepth) {
+			t.Errorf("expected ErrMaxDepth for a pointer to itself, got %v", err)
+		}
+	})
+}
@@ -1,14 +1,26 @@
 package json2xml
 
 import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/text/encoding/unicode"
+	"golang.org/x/text/transform"
 )
 
-// ReadFromJSON reads a JSON file and returns the parsed data.
+// ReadFromJSON reads a JSON file and returns the parsed data. Gzipped
+// files, such as data.json.gz, are decompressed, and a leading byte order
+// mark is skipped, with UTF-16 input transcoded to UTF-8.
 func ReadFromJSON(filename string) (any, error) {
 	file, err := os.Open(filename)
 	if err != nil {
@@ -16,26 +28,74 @@ func ReadFromJSON(filename string) (any, error) {
 	}
 	defer func() { _ = file.Close() }()
 
-	data, err := io.ReadAll(file)
+	return ReadFromReaderMaybeGzip(file)
+}
+
+// ReadFromReader decodes a single JSON value from r, such as an HTTP body
+// or a decompressing reader, without buffering the whole input first.
+func ReadFromReader(r io.Reader) (any, error) {
+	result, err := decodeJSON(r, false)
 	if err != nil {
 		return nil, fmt.Errorf("%w: %v", ErrJSONRead, err)
 	}
 
-	var result any
-	if err := json.Unmarshal(data, &result); err != nil {
+	return result, nil
+}
+
+// ReadFromReaderMaybeGzip is ReadFromReader for input that may be gzipped:
+// input starting with the gzip magic bytes is decompressed first.
+func ReadFromReaderMaybeGzip(r io.Reader) (any, error) {
+	r, err := maybeGunzip(r)
+	if err != nil {
 		return nil, fmt.Errorf("%w: %v", ErrJSONRead, err)
 	}
+	return ReadFromReader(r)
+}
 
-	return result, nil
+// maybeGunzip returns a reader decompressing r if it starts with the gzip
+// magic bytes, and one reading r unchanged otherwise.
+func maybeGunzip(r io.Reader) (io.Reader, error) {
+	reader := bufio.NewReader(r)
+	magic, err := reader.Peek(2)
+	if err != nil || magic[0] != 0x1f || magic[1] != 0x8b {
+		return reader, nil
+	}
+	return gzip.NewReader(reader)
 }
 
 // ReadFromURL loads JSON data from a URL and returns the parsed data.
+// Responses with Content-Encoding: gzip are decompressed.
 func ReadFromURL(url string, params map[string]string) (any, error) {
-	req, err := http.NewRequest("GET", url, nil)
+	return readFromURL(context.Background(), http.DefaultClient, url, nil, params)
+}
+
+// ReadFromURLContext is ReadFromURL with a context that can cancel the
+// request or bound it with a deadline. A canceled or expired request
+// returns an error wrapping both ErrURLRead and the context's error.
+func ReadFromURLContext(ctx context.Context, url string, params map[string]string) (any, error) {
+	return readFromURL(ctx, http.DefaultClient, url, nil, params)
+}
+
+// ReadFromURLWithClient is ReadFromURL using the caller's client, for
+// timeouts, proxies or TLS configuration, and sending the given headers,
+// such as Authorization or User-Agent. A nil client uses http.DefaultClient.
+func ReadFromURLWithClient(client *http.Client, url string, headers map[string]string, params map[string]string) (any, error) {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return readFromURL(context.Background(), client, url, headers, params)
+}
+
+func readFromURL(ctx context.Context, client *http.Client, url string, headers map[string]string, params map[string]string) (any, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
 		return nil, fmt.Errorf("%w: %v", ErrURLRead, err)
 	}
 
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+
 	// Add query parameters if provided
 	if params != nil {
 		q := req.URL.Query()
@@ -45,10 +105,9 @@ func ReadFromURL(url string, params map[string]string) (any, error) {
 		req.URL.RawQuery = q.Encode()
 	}
 
-	client := &http.Client{}
 	resp, err := client.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("%w: %v", ErrURLRead, err)
+		return nil, fmt.Errorf("%w: %w", ErrURLRead, err)
 	}
 	defer func() { _ = resp.Body.Close() }()
 
@@ -56,29 +115,207 @@ func ReadFromURL(url string, params map[string]string) (any, error) {
 		return nil, ErrURLRead
 	}
 
-	data, err := io.ReadAll(resp.Body)
+	var body io.Reader = resp.Body
+	if strings.EqualFold(resp.Header.Get("Content-Encoding"), "gzip") && !resp.Uncompressed {
+		gz, err := gzip.NewReader(resp.Body)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrURLRead, err)
+		}
+		body = gz
+	}
+
+	data, err := io.ReadAll(body)
 	if err != nil {
-		return nil, fmt.Errorf("%w: %v", ErrURLRead, err)
+		return nil, fmt.Errorf("%w: %w", ErrURLRead, err)
 	}
 
 	var result any
-	if err := json.Unmarshal(data, &result); err != nil {
+	if err := json.Unmarshal(stripBOM(data), &result); err != nil {
 		return nil, fmt.Errorf("%w: %v", ErrURLRead, err)
 	}
 
 	return result, nil
 }
 
-// ReadFromString parses a JSON string and returns the data.
+// ReadFromString parses a JSON string and returns the data. A leading byte
+// order mark is handled as in ReadFromJSON.
 func ReadFromString(jsonData string) (any, error) {
 	if jsonData == "" {
 		return nil, ErrStringRead
 	}
 
 	var result any
-	if err := json.Unmarshal([]byte(jsonData), &result); err != nil {
+	if err := json.Unmarshal(stripBOM([]byte(jsonData)), &result); err != nil {
 		return nil, fmt.Errorf("%w: %v", ErrStringRead, err)
 	}
 
 	return result, nil
 }
+
+// ReadFromJSONUseNumber reads a JSON file like ReadFromJSON, but keeps
+// numbers as json.Number so integers convert with type="int" and their
+// exact digits instead of as float64.
+func ReadFromJSONUseNumber(filename string) (any, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrJSONRead, err)
+	}
+	defer func() { _ = file.Close() }()
+
+	r, err := maybeGunzip(file)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrJSONRead, err)
+	}
+	result, err := decodeJSON(r, true)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrJSONRead, err)
+	}
+
+	return result, nil
+}
+
+// ReadFromStringUseNumber parses a JSON string like ReadFromString, but
+// keeps numbers as json.Number (see ReadFromJSONUseNumber).
+func ReadFromStringUseNumber(jsonData string) (any, error) {
+	if jsonData == "" {
+		return nil, ErrStringRead
+	}
+
+	result, err := decodeJSON(strings.NewReader(jsonData), true)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrStringRead, err)
+	}
+
+	return result, nil
+}
+
+// decodeJSON decodes exactly one JSON value from r, rejecting trailing
+// data as json.Unmarshal does.
+func decodeJSON(r io.Reader, useNumber bool) (any, error) {
+	decoder := json.NewDecoder(bomReader(r))
+	if useNumber {
+		decoder.UseNumber()
+	}
+
+	var result any
+	if err := decoder.Decode(&result); err != nil {
+		return nil, err
+	}
+	if _, err := decoder.Token(); err != io.EOF {
+		return nil, errors.New("invalid character after top-level value")
+	}
+
+	return result, nil
+}
+
+// bomReader returns a reader for r without a leading byte order mark.
+// Input with a UTF-16 BOM, as some Windows editors save it, is transcoded
+// to UTF-8; input without a BOM is read unchanged.
+func bomReader(r io.Reader) io.Reader {
+	return transform.NewReader(r, unicode.BOMOverride(transform.Nop))
+}
+
+// stripBOM is bomReader for input already in memory.
+func stripBOM(data []byte) []byte {
+	out, _, err := transform.Bytes(unicode.BOMOverride(transform.Nop), data)
+	if err != nil {
+		return data
+	}
+	return out
+}
+
+// decodeRawMessage decodes a json.RawMessage found in the data so it
+// converts like the value it holds, keeping numbers as json.Number. An
+// empty message is null, and one that is not valid JSON converts as its
+// text.
+func decodeRawMessage(raw json.RawMessage) any {
+	if len(bytes.TrimSpace(raw)) == 0 {
+		return nil
+	}
+	value, err := decodeJSON(bytes.NewReader(raw), true)
+	if err != nil {
+		return string(raw)
+	}
+	return value
+}
+
+// ReadFromJSONC parses JSON with comments (JSONC), as used by VS Code
+// configuration files. Line (//) and block (/* */) comments are removed
+// before parsing; comment markers inside string values are preserved.
+func ReadFromJSONC(data []byte) (any, error) {
+	var result any
+	if err := json.Unmarshal(stripJSONComments(stripBOM(data)), &result); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrJSONRead, err)
+	}
+
+	return result, nil
+}
+
+// stripJSONComments replaces comments with spaces so that error offsets
+// reported by the JSON decoder still match the original input.
+func stripJSONComments(data []byte) []byte {
+	out := make([]byte, len(data))
+	copy(out, data)
+
+	inString := false
+	for i := 0; i < len(out); i++ {
+		c := out[i]
+		switch {
+		case inString:
+			if c == '\\' {
+				i++
+			} else if c == '"' {
+				inString = false
+			}
+		case c == '"':
+			inString = true
+		case c == '/' && i+1 < len(out) && out[i+1] == '/':
+			for ; i < len(out) && out[i] != '\n'; i++ {
+				out[i] = ' '
+			}
+		case c == '/' && i+1 < len(out) && out[i+1] == '*':
+			out[i], out[i+1] = ' ', ' '
+			for i += 2; i < len(out); i++ {
+				if out[i] == '*' && i+1 < len(out) && out[i+1] == '/' {
+					out[i], out[i+1] = ' ', ' '
+					i++
+					break
+				}
+				if out[i] != '\n' {
+					out[i] = ' '
+				}
+			}
+		}
+	}
+	return out
+}
+
+// MergeInputs combines several parsed inputs, keyed by file name, into one
+// document with a child per input. Each child is keyed by the base name of
+// its file without the extension, so "data/users.json" becomes <users>;
+// a ".gz" suffix goes too, so "users.json.gz" does as well. Inputs whose
+// base names collide keep their names as given instead.
+func MergeInputs(inputs map[string]any) map[string]any {
+	key := func(name string) string {
+		base := filepath.Base(name)
+		if ext := filepath.Ext(base); strings.EqualFold(ext, ".gz") {
+			base = strings.TrimSuffix(base, ext)
+		}
+		return strings.TrimSuffix(base, filepath.Ext(base))
+	}
+
+	seen := make(map[string]int, len(inputs))
+	for name := range inputs {
+		seen[key(name)]++
+	}
+
+	merged := make(map[string]any, len(inputs))
+	for name, data := range inputs {
+		if k := key(name); seen[k] == 1 {
+			merged[k] = data
+		} else {
+			merged[name] = data
+		}
+	}
+	return merged
+}
@@ -1,10 +1,18 @@
 package json2xml
 
 import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
 	"errors"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
+	"unicode/utf16"
 )
 
 func TestReadFromJSON(t *testing.T) {
@@ -67,6 +75,212 @@ func TestReadFromJSON(t *testing.T) {
 	})
 }
 
+func TestReadFromReader(t *testing.T) {
+	t.Run("strings.Reader", func(t *testing.T) {
+		data, err := ReadFromReader(strings.NewReader(`{"login":"mojombo","id":1}`))
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if m, ok := data.(map[string]any); !ok || m["login"] != "mojombo" {
+			t.Errorf("unexpected result: %v", data)
+		}
+	})
+
+	t.Run("bytes.Buffer", func(t *testing.T) {
+		data, err := ReadFromReader(bytes.NewBufferString(`[1, "two", null]`))
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if s, ok := data.([]any); !ok || len(s) != 3 {
+			t.Errorf("unexpected result: %v", data)
+		}
+	})
+
+	t.Run("invalid input", func(t *testing.T) {
+		for _, input := range []string{"", `{"a":`, `{} {}`, `{}x`} {
+			if _, err := ReadFromReader(strings.NewReader(input)); !errors.Is(err, ErrJSONRead) {
+				t.Errorf("input %q: expected ErrJSONRead, got %v", input, err)
+			}
+		}
+	})
+}
+
+func gzipBytes(t *testing.T, data string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	if _, err := gz.Write([]byte(data)); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestReadGzip(t *testing.T) {
+	const doc = `{"name": "Bike", "wheels": 2}`
+	expected := map[string]any{"name": "Bike", "wheels": float64(2)}
+	compressed := gzipBytes(t, doc)
+
+	t.Run("reader", func(t *testing.T) {
+		for name, input := range map[string][]byte{"gzipped": compressed, "plain": []byte(doc)} {
+			data, err := ReadFromReaderMaybeGzip(bytes.NewReader(input))
+			if err != nil {
+				t.Fatalf("%s: expected no error, got %v", name, err)
+			}
+			if !reflect.DeepEqual(data, expected) {
+				t.Errorf("%s: expected %v, got %v", name, expected, data)
+			}
+		}
+	})
+
+	t.Run("corrupt gzip", func(t *testing.T) {
+		if _, err := ReadFromReaderMaybeGzip(bytes.NewReader(compressed[:12])); !errors.Is(err, ErrJSONRead) {
+			t.Errorf("expected ErrJSONRead, got %v", err)
+		}
+	})
+
+	t.Run("file", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "data.json.gz")
+		if err := os.WriteFile(path, compressed, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		data, err := ReadFromJSON(path)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if !reflect.DeepEqual(data, expected) {
+			t.Errorf("expected %v, got %v", expected, data)
+		}
+
+		data, err = ReadFromJSONUseNumber(path)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if n := data.(map[string]any)["wheels"]; n != json.Number("2") {
+			t.Errorf("expected json.Number 2, got %#v", n)
+		}
+	})
+
+	t.Run("URL with Content-Encoding gzip", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Encoding", "gzip")
+			_, _ = w.Write(compressed)
+		}))
+		defer server.Close()
+
+		// An explicit Accept-Encoding stops the transport from
+		// decompressing the body itself.
+		headers := map[string]string{"Accept-Encoding": "gzip"}
+		data, err := ReadFromURLWithClient(nil, server.URL, headers, nil)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if !reflect.DeepEqual(data, expected) {
+			t.Errorf("expected %v, got %v", expected, data)
+		}
+
+		data, err = ReadFromURL(server.URL, nil)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if !reflect.DeepEqual(data, expected) {
+			t.Errorf("expected %v, got %v", expected, data)
+		}
+	})
+}
+
+// utf16Bytes encodes s as UTF-16 with a byte order mark.
+func utf16Bytes(s string, bigEndian bool) []byte {
+	var out []byte
+	for _, u := range utf16.Encode([]rune("\uFEFF" + s)) {
+		if bigEndian {
+			out = append(out, byte(u>>8), byte(u))
+		} else {
+			out = append(out, byte(u), byte(u>>8))
+		}
+	}
+	return out
+}
+
+func TestReadBOM(t *testing.T) {
+	const doc = `{"name": "Café", "wheels": 2}`
+	expected := map[string]any{"name": "Café", "wheels": float64(2)}
+	inputs := map[string][]byte{
+		"UTF-8":    append([]byte("\xEF\xBB\xBF"), doc...),
+		"UTF-16BE": utf16Bytes(doc, true),
+		"UTF-16LE": utf16Bytes(doc, false),
+		"no BOM":   []byte(doc),
+	}
+
+	for name, input := range inputs {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "data.json")
+			if err := os.WriteFile(path, input, 0o644); err != nil {
+				t.Fatal(err)
+			}
+			readers := map[string]func() (any, error){
+				"ReadFromJSON":            func() (any, error) { return ReadFromJSON(path) },
+				"ReadFromJSONUseNumber":   func() (any, error) { return ReadFromJSONUseNumber(path) },
+				"ReadFromString":          func() (any, error) { return ReadFromString(string(input)) },
+				"ReadFromStringUseNumber": func() (any, error) { return ReadFromStringUseNumber(string(input)) },
+				"ReadFromReader":          func() (any, error) { return ReadFromReader(bytes.NewReader(input)) },
+				"ReadFromJSONC":           func() (any, error) { return ReadFromJSONC(input) },
+				"gzipped file": func() (any, error) {
+					return ReadFromReaderMaybeGzip(bytes.NewReader(gzipBytes(t, string(input))))
+				},
+			}
+			for reader, read := range readers {
+				data, err := read()
+				if err != nil {
+					t.Fatalf("%s: expected no error, got %v", reader, err)
+				}
+				if name := data.(map[string]any)["name"]; name != "Café" {
+					t.Errorf("%s: expected name Café, got %v", reader, name)
+				}
+			}
+
+			data, err := ReadFromJSON(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(data, expected) {
+				t.Errorf("expected %v, got %v", expected, data)
+			}
+
+			ordered, err := ReadFromStringOrdered(string(input))
+			if err != nil {
+				t.Fatalf("ReadFromStringOrdered: expected no error, got %v", err)
+			}
+			if keys := ordered.(*OrderedMap).Keys(); !reflect.DeepEqual(keys, []string{"name", "wheels"}) {
+				t.Errorf("ReadFromStringOrdered: unexpected keys %v", keys)
+			}
+		})
+	}
+
+	t.Run("URL", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write(inputs["UTF-8"])
+		}))
+		defer server.Close()
+
+		data, err := ReadFromURL(server.URL, nil)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if !reflect.DeepEqual(data, expected) {
+			t.Errorf("expected %v, got %v", expected, data)
+		}
+	})
+
+	t.Run("BOM only in the middle", func(t *testing.T) {
+		if _, err := ReadFromString("{} \uFEFF"); !errors.Is(err, ErrStringRead) {
+			t.Errorf("expected ErrStringRead, got %v", err)
+		}
+	})
+}
+
 func TestReadFromString(t *testing.T) {
 	t.Run("valid JSON string", func(t *testing.T) {
 		jsonStr := `{"login":"mojombo","id":1,"avatar_url":"https://avatars0.githubusercontent.com/u/1?v=4"}`
@@ -150,6 +364,157 @@ func TestReadFromString(t *testing.T) {
 	})
 }
 
+func TestReadFromStringUseNumber(t *testing.T) {
+	t.Run("numbers keep their type and digits", func(t *testing.T) {
+		data, err := ReadFromStringUseNumber(`{"id":1,"big":12345678901234567890,"neg":-42,"million":1000000,"ratio":2.5,"exp":1e3}`)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		opts := DefaultOptions()
+		result := string(DictToXML(data, opts))
+		for _, want := range []string{
+			`<id type="int">1</id>`,
+			`<big type="int">12345678901234567890</big>`,
+			`<neg type="int">-42</neg>`,
+			`<million type="int">1000000</million>`,
+			`<ratio type="float">2.5</ratio>`,
+			`<exp type="float">1e3</exp>`,
+		} {
+			if !strings.Contains(result, want) {
+				t.Errorf("expected %s in %s", want, result)
+			}
+		}
+	})
+
+	t.Run("numbers in lists", func(t *testing.T) {
+		data, err := ReadFromStringUseNumber(`[3, -0.5]`)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		result := string(DictToXML(data, DefaultOptions()))
+		if !strings.Contains(result, `<item type="int">3</item>`) || !strings.Contains(result, `<item type="float">-0.5</item>`) {
+			t.Errorf("unexpected list output: %s", result)
+		}
+	})
+
+	t.Run("default decoding uses float64", func(t *testing.T) {
+		data, err := ReadFromString(`{"million":1000000}`)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if _, ok := data.(map[string]any)["million"].(float64); !ok {
+			t.Errorf("expected float64, got %T", data.(map[string]any)["million"])
+		}
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		for _, input := range []string{"", `{"id":1`, `{"id":1} {}`} {
+			if _, err := ReadFromStringUseNumber(input); !errors.Is(err, ErrStringRead) {
+				t.Errorf("input %q: expected ErrStringRead, got %v", input, err)
+			}
+		}
+	})
+}
+
+func TestReadFromJSONUseNumber(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data.json")
+	if err := os.WriteFile(path, []byte(`{"id": 7}`), 0o644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+
+	data, err := ReadFromJSONUseNumber(path)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if n, ok := data.(map[string]any)["id"].(json.Number); !ok || n.String() != "7" {
+		t.Errorf("expected json.Number 7, got %#v", data)
+	}
+
+	if _, err := ReadFromJSONUseNumber(filepath.Join(t.TempDir(), "missing.json")); !errors.Is(err, ErrJSONRead) {
+		t.Errorf("expected ErrJSONRead, got %v", err)
+	}
+	if err := os.WriteFile(path, []byte(`{`), 0o644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+	if _, err := ReadFromJSONUseNumber(path); !errors.Is(err, ErrJSONRead) {
+		t.Errorf("expected ErrJSONRead, got %v", err)
+	}
+}
+
+func TestReadFromJSONC(t *testing.T) {
+	t.Run("strips line and block comments", func(t *testing.T) {
+		input := []byte(`{
+	// editor settings
+	"url": "https://example.com/path", /* trailing */
+	/* multi
+	   line */
+	"pattern": "a/*b*/c",
+	"quote": "say \"hi\" // not a comment"
+}`)
+		data, err := ReadFromJSONC(input)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		m := data.(map[string]any)
+		if m["url"] != "https://example.com/path" {
+			t.Errorf("unexpected url: %v", m["url"])
+		}
+		if m["pattern"] != "a/*b*/c" {
+			t.Errorf("unexpected pattern: %v", m["pattern"])
+		}
+		if m["quote"] != `say "hi" // not a comment` {
+			t.Errorf("unexpected quote: %v", m["quote"])
+		}
+
+		xml := string(DictToXML(data, Options{Root: false, AttrType: false, ItemFunc: DefaultItemFunc}))
+		if !strings.Contains(xml, "<url>https://example.com/path</url>") {
+			t.Errorf("unexpected XML: %s", xml)
+		}
+	})
+
+	t.Run("invalid JSONC", func(t *testing.T) {
+		_, err := ReadFromJSONC([]byte(`{"a": 1 /* unterminated`))
+		if !errors.Is(err, ErrJSONRead) {
+			t.Errorf("expected ErrJSONRead, got %v", err)
+		}
+	})
+}
+
+func TestMergeInputs(t *testing.T) {
+	users := []any{map[string]any{"name": "Ada"}}
+	orders := map[string]any{"total": 2}
+
+	merged := MergeInputs(map[string]any{"data/users.json": users, "orders.json": orders})
+	expected := map[string]any{"users": users, "orders": orders}
+	if !reflect.DeepEqual(merged, expected) {
+		t.Fatalf("expected %#v, got %#v", expected, merged)
+	}
+
+	xml := string(DictToXML(merged, Options{Root: true, CustomRoot: "all", ItemFunc: DefaultItemFunc, ItemWrap: true}))
+	if !strings.HasSuffix(xml, "<all><orders><total>2</total></orders><users><item><name>Ada</name></item></users></all>") {
+		t.Errorf("unexpected XML: %s", xml)
+	}
+
+	t.Run("colliding base names", func(t *testing.T) {
+		merged := MergeInputs(map[string]any{"a/data.json": 1, "b/data.yaml": 2, "c.json": 3})
+		expected := map[string]any{"a/data.json": 1, "b/data.yaml": 2, "c": 3}
+		if !reflect.DeepEqual(merged, expected) {
+			t.Errorf("expected %#v, got %#v", expected, merged)
+		}
+	})
+
+	t.Run("gzipped inputs", func(t *testing.T) {
+		merged := MergeInputs(map[string]any{"data/users.json.gz": 1, "orders.GZ": 2})
+		expected := map[string]any{"users": 1, "orders": 2}
+		if !reflect.DeepEqual(merged, expected) {
+			t.Errorf("expected %#v, got %#v", expected, merged)
+		}
+	})
+}
+
 func TestReadFromJSONWithTempFile(t *testing.T) {
 	t.Run("create and read temp JSON file", func(t *testing.T) {
 		// Create temp file
@@ -0,0 +1,234 @@
+package json2xml
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+)
+
+// checkWellFormed parses xmlBytes to the end and returns the first syntax error.
+func checkWellFormed(xmlBytes []byte) error {
+	decoder := xml.NewDecoder(bytes.NewReader(xmlBytes))
+	for {
+		if _, err := decoder.Token(); err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+	}
+}
+
+// checkFragment reports whether fragment is well-formed element content.
+// Its tags must balance within it, so it cannot close the element it is
+// written into and start another.
+func checkFragment(fragment string) error {
+	const open, end = "<x>", "</x>"
+	decoder := xml.NewDecoder(strings.NewReader(open + fragment + end))
+	depth := 0
+	for {
+		tok, err := decoder.Token()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+		switch tok.(type) {
+		case xml.StartElement:
+			depth++
+		case xml.EndElement:
+			depth--
+			if depth == 0 && decoder.InputOffset() != int64(len(open)+len(fragment)+len(end)) {
+				return errors.New("fragment closes its enclosing element")
+			}
+		}
+	}
+}
+
+// ValidateXML reports whether xmlBytes is well-formed XML, returning the
+// first problem found as an ErrInvalidData error with its position. Besides
+// the syntax errors encoding/xml finds, it catches mismatched or unclosed
+// tags and element or attribute prefixes with no namespace declaration in
+// scope. Several top-level elements are accepted, as DictToXML writes them
+// when Root is false.
+func ValidateXML(xmlBytes []byte) error {
+	type element struct {
+		name     string
+		prefixes map[string]bool
+	}
+	var stack []element
+	declared := func(prefix string) bool {
+		if prefix == "" || prefix == "xml" || prefix == "xmlns" {
+			return true
+		}
+		for i := len(stack) - 1; i >= 0; i-- {
+			if stack[i].prefixes[prefix] {
+				return true
+			}
+		}
+		return false
+	}
+
+	decoder := xml.NewDecoder(bytes.NewReader(xmlBytes))
+	fail := func(format string, args ...any) error {
+		line, column := decoder.InputPos()
+		return fmt.Errorf("%w: line %d, column %d: %s", ErrInvalidData, line, column, fmt.Sprintf(format, args...))
+	}
+	for {
+		tok, err := decoder.RawToken()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidData, err)
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			elem := element{name: qualifiedName(t.Name)}
+			for _, attr := range t.Attr {
+				if attr.Name.Space == "xmlns" {
+					if elem.prefixes == nil {
+						elem.prefixes = make(map[string]bool)
+					}
+					elem.prefixes[attr.Name.Local] = true
+				}
+			}
+			stack = append(stack, elem)
+			if !declared(t.Name.Space) {
+				return fail("undeclared namespace prefix %q on element <%s>", t.Name.Space, elem.name)
+			}
+			for _, attr := range t.Attr {
+				if !declared(attr.Name.Space) {
+					return fail("undeclared namespace prefix %q on attribute %s", attr.Name.Space, qualifiedName(attr.Name))
+				}
+			}
+		case xml.EndElement:
+			name := qualifiedName(t.Name)
+			if len(stack) == 0 {
+				return fail("unexpected end element </%s>", name)
+			}
+			if open := stack[len(stack)-1].name; open != name {
+				return fail("element <%s> closed by </%s>", open, name)
+			}
+			stack = stack[:len(stack)-1]
+		}
+	}
+	if len(stack) > 0 {
+		return fail("unclosed element <%s>", stack[len(stack)-1].name)
+	}
+	return nil
+}
+
+// qualifiedName joins a raw token name back into prefix:local form.
+func qualifiedName(name xml.Name) string {
+	if name.Space == "" {
+		return name.Local
+	}
+	return name.Space + ":" + name.Local
+}
+
+// isXMLChar reports whether r is allowed by the XML 1.0 Char production.
+func isXMLChar(r rune) bool {
+	return r == '\t' || r == '\n' || r == '\r' ||
+		(r >= 0x20 && r <= 0xD7FF) ||
+		(r >= 0xE000 && r <= 0xFFFD) ||
+		(r >= 0x10000 && r <= 0x10FFFF)
+}
+
+// InvalidCharMode selects how text is handled when it contains characters
+// that XML 1.0 does not allow, such as most control characters below 0x20.
+type InvalidCharMode int
+
+const (
+	// InvalidCharDrop removes invalid characters. It is the default.
+	InvalidCharDrop InvalidCharMode = iota
+	// InvalidCharReplace replaces each invalid character with U+FFFD.
+	// Numeric character references such as &#x1; are not used because
+	// XML 1.0 forbids them for these characters too.
+	InvalidCharReplace
+	// InvalidCharKeep leaves text unchanged, which may produce XML that
+	// strict parsers reject.
+	InvalidCharKeep
+)
+
+// SanitizeXMLText applies mode to the characters in s that are not allowed
+// in XML 1.0. Invalid UTF-8 is replaced with U+FFFD unless mode is
+// InvalidCharKeep.
+func SanitizeXMLText(s string, mode InvalidCharMode) string {
+	switch mode {
+	case InvalidCharKeep:
+		return s
+	case InvalidCharReplace:
+		return strings.Map(func(r rune) rune {
+			if isXMLChar(r) {
+				return r
+			}
+			return utf8.RuneError
+		}, s)
+	default:
+		return strings.Map(func(r rune) rune {
+			if isXMLChar(r) {
+				return r
+			}
+			return -1
+		}, s)
+	}
+}
+
+// escapeText sanitizes s according to opts.InvalidCharMode and escapes it
+// with opts.Escaper, or EscapeXML when none is set.
+func escapeText(s string, opts Options) string {
+	s = SanitizeXMLText(s, opts.InvalidCharMode)
+	if opts.Escaper != nil {
+		return opts.Escaper(s)
+	}
+	return EscapeXML(s)
+}
+
+// stripInvalidXMLChars removes characters that can never appear in an XML 1.0 document.
+func stripInvalidXMLChars(xmlBytes []byte) []byte {
+	return bytes.Map(func(r rune) rune {
+		if isXMLChar(r) {
+			return r
+		}
+		return -1
+	}, xmlBytes)
+}
+
+// sanitizeName returns name if it is a valid element name, or a safe replacement.
+func sanitizeName(name string) string {
+	sanitized, _ := MakeValidXMLName(name, nil)
+	return sanitized
+}
+
+// repairXML is the safety net behind Options.RepairOutput. It first strips
+// characters that are illegal in XML 1.0, then, if the output is still not
+// well-formed, regenerates it with the root and item names sanitized.
+// The best attempt is returned even if it could not be repaired, and
+// rebuilt reports whether it came from a second conversion.
+func repairXML(xmlBytes []byte, obj any, opts Options) (repaired []byte, rebuilt bool) {
+	if checkWellFormed(xmlBytes) == nil {
+		return xmlBytes, false
+	}
+
+	repaired = stripInvalidXMLChars(xmlBytes)
+	if checkWellFormed(repaired) == nil {
+		return repaired, false
+	}
+
+	if opts.stats != nil {
+		*opts.stats = Stats{}
+	}
+	itemFunc := opts.ItemFunc
+	opts.CustomRoot = sanitizeName(opts.CustomRoot)
+	opts.ItemFunc = func(parent string) string {
+		return sanitizeName(itemFunc(parent))
+	}
+	return stripInvalidXMLChars(buildStandardXML(obj, opts)), true
+}
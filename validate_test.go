@@ -0,0 +1,163 @@
+package json2xml
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestRepairOutput(t *testing.T) {
+	t.Run("strips illegal control characters", func(t *testing.T) {
+		data := map[string]any{"note": "bad\x00value\x1b"}
+		opts := DefaultOptions()
+		opts.InvalidCharMode = InvalidCharKeep
+
+		if err := checkWellFormed(DictToXML(data, opts)); err == nil {
+			t.Fatal("expected unrepaired output to be malformed")
+		}
+
+		opts.RepairOutput = true
+		result := DictToXML(data, opts)
+		if err := checkWellFormed(result); err != nil {
+			t.Fatalf("expected well-formed output, got %v: %s", err, result)
+		}
+		if !bytes.Contains(result, []byte(`<note type="str">badvalue</note>`)) {
+			t.Errorf("unexpected repaired output: %s", result)
+		}
+	})
+
+	t.Run("sanitizes root and item names", func(t *testing.T) {
+		data := map[string]any{"rows": []any{map[string]any{"id": 1}}}
+		opts := DefaultOptions()
+		opts.CustomRoot = "my root"
+		opts.ItemFunc = func(parent string) string { return "row<" }
+		opts.RepairOutput = true
+		result := DictToXML(data, opts)
+
+		if err := checkWellFormed(result); err != nil {
+			t.Fatalf("expected well-formed output, got %v: %s", err, result)
+		}
+		if !bytes.Contains(result, []byte("<my_root>")) {
+			t.Errorf("expected sanitized root name, got %s", result)
+		}
+	})
+
+	t.Run("leaves valid output untouched", func(t *testing.T) {
+		data := map[string]any{"name": "Bike"}
+		opts := DefaultOptions()
+		expected := DictToXML(data, opts)
+
+		opts.RepairOutput = true
+		if result := DictToXML(data, opts); !bytes.Equal(result, expected) {
+			t.Errorf("expected %s, got %s", expected, result)
+		}
+	})
+}
+
+func TestSanitizeXMLText(t *testing.T) {
+	input := "a\x00b\x08c\td\ne\rf\x0bg\x0ch\x1fi\x20j\x7fk\ufffel\uffffm\ud7ffn\ue000o\U0010ffff"
+	tests := []struct {
+		mode     InvalidCharMode
+		expected string
+	}{
+		{InvalidCharDrop, "abc\td\ne\rfghi j\x7fklm\ud7ffn\ue000o\U0010ffff"},
+		{InvalidCharReplace, "a\ufffdb\ufffdc\td\ne\rf\ufffdg\ufffdh\ufffdi j\x7fk\ufffdl\ufffdm\ud7ffn\ue000o\U0010ffff"},
+		{InvalidCharKeep, input},
+	}
+	for _, tt := range tests {
+		if got := SanitizeXMLText(input, tt.mode); got != tt.expected {
+			t.Errorf("mode %d: expected %q, got %q", tt.mode, tt.expected, got)
+		}
+	}
+
+	t.Run("invalid UTF-8", func(t *testing.T) {
+		if got := SanitizeXMLText("a\xffb", InvalidCharDrop); got != "a\ufffdb" {
+			t.Errorf("expected replacement character, got %q", got)
+		}
+	})
+}
+
+func TestInvalidCharMode(t *testing.T) {
+	data := map[string]any{
+		"text":       "a\x01b",
+		"list":       []any{"c\x02d"},
+		"bad\x03key": "e",
+	}
+
+	tests := []struct {
+		name  string
+		opts  func(*Options)
+		wants []string
+	}{
+		{"drop by default", func(o *Options) {}, []string{
+			`<text type="str">ab</text>`, `<item type="str">cd</item>`, `<key name="badkey" type="str">e</key>`,
+		}},
+		{"replace", func(o *Options) { o.InvalidCharMode = InvalidCharReplace }, []string{
+			"<text type=\"str\">a\ufffdb</text>", "<item type=\"str\">c\ufffdd</item>",
+		}},
+		{"cdata", func(o *Options) { o.CDATA = true }, []string{`<text type="str"><![CDATA[ab]]></text>`}},
+		{"xpath", func(o *Options) { o.XPathFormat = true }, []string{`<string key="text">ab</string>`}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := DefaultOptions()
+			tt.opts(&opts)
+			result := DictToXML(data, opts)
+			if err := checkWellFormed(result); err != nil {
+				t.Fatalf("expected well-formed output, got %v: %q", err, result)
+			}
+			for _, want := range tt.wants {
+				if !bytes.Contains(result, []byte(want)) {
+					t.Errorf("expected %q in %q", want, result)
+				}
+			}
+		})
+	}
+}
+
+func TestValidateXML(t *testing.T) {
+	t.Run("converter output", func(t *testing.T) {
+		data := map[string]any{"a": []any{1, "x < y", nil}, "b": map[string]any{"c": true}}
+		for _, root := range []bool{true, false} {
+			opts := DefaultOptions()
+			opts.Root = root
+			if err := ValidateXML(DictToXML(data, opts)); err != nil {
+				t.Errorf("Root=%v: expected valid XML, got %v", root, err)
+			}
+		}
+	})
+
+	t.Run("declared namespaces", func(t *testing.T) {
+		input := `<r xmlns:x="urn:x" xmlns="urn:d"><x:a x:b="1"><c xml:lang="en"/></x:a></r>`
+		if err := ValidateXML([]byte(input)); err != nil {
+			t.Errorf("expected valid XML, got %v", err)
+		}
+	})
+
+	tests := []struct {
+		name    string
+		input   string
+		message string
+	}{
+		{"mismatched tag", "<a><b></a></b>", "line 1, column 11: element <b> closed by </a>"},
+		{"unclosed element", "<a>\n<b></b>", "line 2, column 8: unclosed element <a>"},
+		{"stray end tag", "<a></a></b>", "unexpected end element </b>"},
+		{"undeclared element prefix", "<r><ns:a/></r>", `undeclared namespace prefix "ns" on element <ns:a>`},
+		{"undeclared attribute prefix", `<r><a xsi:nil="true"/></r>`, `undeclared namespace prefix "xsi" on attribute xsi:nil`},
+		{"prefix out of scope", `<r><a xmlns:p="urn:p"/><p:b/></r>`, `undeclared namespace prefix "p"`},
+		{"unquoted attribute", "<a b=1></a>", "line 1"},
+		{"unknown entity", "<a>&nbsp;</a>", "line 1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateXML([]byte(tt.input))
+			if !errors.Is(err, ErrInvalidData) {
+				t.Fatalf("expected ErrInvalidData, got %v", err)
+			}
+			if !strings.Contains(err.Error(), tt.message) {
+				t.Errorf("expected error containing %q, got %v", tt.message, err)
+			}
+		})
+	}
+}
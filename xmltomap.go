@@ -0,0 +1,193 @@
+package json2xml
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// xmlNode is a parsed element used by XMLToMap.
+type xmlNode struct {
+	name     string
+	attrs    map[string]string
+	children []*xmlNode
+	text     strings.Builder
+}
+
+// XMLToMap parses XML produced by DictToXML back into Go values: maps
+// become map[string]any, lists []any, and scalars are typed from their
+// type attribute (int64, float64, bool, nil or string). opts should match
+// the options used for the conversion; Root and ItemFunc are consulted.
+//
+// Reconstruction is best effort. Without type attributes, an element with
+// children is a list when every child has the ItemFunc item name, and a map
+// otherwise; leaf elements become strings. Repeated child names in a map
+// (as produced by @flat or ItemWrap=false) are collected into a list.
+// Attributes other than type are dropped, and namespaces are ignored.
+func XMLToMap(xmlBytes []byte, opts Options) (any, error) {
+	if opts.ItemFunc == nil {
+		opts.ItemFunc = DefaultItemFunc
+	}
+
+	doc, err := parseXMLTree(xmlBytes)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidData, err)
+	}
+
+	if opts.Root {
+		if len(doc.children) != 1 {
+			return nil, fmt.Errorf("%w: expected a single root element, found %d", ErrInvalidData, len(doc.children))
+		}
+		root := doc.children[0]
+		if _, typed := root.attrs["type"]; typed || (len(root.children) == 0 && root.text.Len() > 0) {
+			// A top-level scalar is the text of the root element.
+			return nodeValue(root, opts)
+		}
+		return nodeContainer(root, opts)
+	}
+	return nodeContainer(doc, opts)
+}
+
+// parseXMLTree parses xmlBytes into a synthetic node holding the top-level elements.
+func parseXMLTree(xmlBytes []byte) (*xmlNode, error) {
+	doc := &xmlNode{}
+	stack := []*xmlNode{doc}
+
+	decoder := xml.NewDecoder(bytes.NewReader(xmlBytes))
+	for {
+		tok, err := decoder.Token()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			node := &xmlNode{name: t.Name.Local, attrs: make(map[string]string)}
+			for _, attr := range t.Attr {
+				if attr.Name.Space == "" && attr.Name.Local != "xmlns" {
+					node.attrs[attr.Name.Local] = attr.Value
+				}
+			}
+			parent := stack[len(stack)-1]
+			parent.children = append(parent.children, node)
+			stack = append(stack, node)
+		case xml.EndElement:
+			stack = stack[:len(stack)-1]
+		case xml.CharData:
+			stack[len(stack)-1].text.Write(t)
+		}
+	}
+
+	return doc, nil
+}
+
+// nodeValue converts a single element to a Go value.
+func nodeValue(n *xmlNode, opts Options) (any, error) {
+	text := n.text.String()
+
+	switch n.attrs["type"] {
+	case "null":
+		return nil, nil
+	case "bool":
+		return text == "true", nil
+	case "int":
+		if i, err := strconv.ParseInt(text, 10, 64); err == nil {
+			return i, nil
+		}
+		return parseXMLFloat(n.name, text)
+	case "float", "float32", "float64":
+		return parseXMLFloat(n.name, text)
+	case "int8", "int16", "int32", "int64":
+		i, err := strconv.ParseInt(text, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%w: element %s: %v", ErrInvalidData, n.name, err)
+		}
+		return i, nil
+	case "uint", "uint8", "uint16", "uint32", "uint64", "uintptr":
+		u, err := strconv.ParseUint(text, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%w: element %s: %v", ErrInvalidData, n.name, err)
+		}
+		return u, nil
+	case "str":
+		return text, nil
+	case "dict":
+		return nodeMap(n, opts)
+	case "list":
+		return nodeList(n, opts)
+	}
+
+	if len(n.children) == 0 {
+		return text, nil
+	}
+	return nodeContainer(n, opts)
+}
+
+func parseXMLFloat(name, text string) (any, error) {
+	f, err := strconv.ParseFloat(text, 64)
+	if err != nil {
+		return nil, fmt.Errorf("%w: element %s: %v", ErrInvalidData, name, err)
+	}
+	return f, nil
+}
+
+// nodeContainer decodes an untyped element with children as a list or map.
+func nodeContainer(n *xmlNode, opts Options) (any, error) {
+	if len(n.children) == 0 {
+		return map[string]any{}, nil
+	}
+	itemName := opts.ItemFunc(n.name)
+	for _, child := range n.children {
+		if child.name != itemName {
+			return nodeMap(n, opts)
+		}
+	}
+	return nodeList(n, opts)
+}
+
+// nodeMap decodes the children of n as map entries.
+func nodeMap(n *xmlNode, opts Options) (any, error) {
+	result := make(map[string]any, len(n.children))
+	repeated := make(map[string]bool)
+	for _, child := range n.children {
+		val, err := nodeValue(child, opts)
+		if err != nil {
+			return nil, err
+		}
+		existing, seen := result[child.name]
+		switch {
+		case !seen:
+			result[child.name] = val
+		case repeated[child.name]:
+			result[child.name] = append(existing.([]any), val)
+		default:
+			result[child.name] = []any{existing, val}
+			repeated[child.name] = true
+		}
+	}
+	if text := n.text.String(); strings.TrimSpace(text) != "" {
+		// Mixed content keeps its text as @val.
+		result["@val"] = text
+	}
+	return result, nil
+}
+
+// nodeList decodes the children of n as list items.
+func nodeList(n *xmlNode, opts Options) (any, error) {
+	result := make([]any, 0, len(n.children))
+	for _, child := range n.children {
+		val, err := nodeValue(child, opts)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, val)
+	}
+	return result, nil
+}
@@ -0,0 +1,96 @@
+package json2xml
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestXMLToMap(t *testing.T) {
+	data := map[string]any{
+		"name":    "Bike & Co",
+		"gears":   int64(21),
+		"weight":  9.5,
+		"active":  true,
+		"sold":    nil,
+		"colors":  []any{"red", "green"},
+		"owner":   map[string]any{"first": "Ada", "tags": []any{}},
+		"nothing": map[string]any{},
+	}
+
+	t.Run("round trip with type attributes", func(t *testing.T) {
+		opts := DefaultOptions()
+		got, err := XMLToMap(DictToXML(data, opts), opts)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if !reflect.DeepEqual(got, data) {
+			t.Errorf("expected %#v, got %#v", data, got)
+		}
+	})
+
+	t.Run("round trip of pretty-printed output", func(t *testing.T) {
+		opts := DefaultOptions()
+		pretty, err := PrettyPrint(DictToXML(data, opts))
+		if err != nil {
+			t.Fatalf("PrettyPrint returned error: %v", err)
+		}
+		got, err := XMLToMap([]byte(pretty), opts)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if !reflect.DeepEqual(got, data) {
+			t.Errorf("expected %#v, got %#v", data, got)
+		}
+	})
+
+	t.Run("without type attributes", func(t *testing.T) {
+		opts := DefaultOptions()
+		opts.AttrType = false
+		got, err := XMLToMap(DictToXML(map[string]any{"a": 1, "list": []any{"x", "y"}}, opts), opts)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		want := map[string]any{"a": "1", "list": []any{"x", "y"}}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("expected %#v, got %#v", want, got)
+		}
+	})
+
+	t.Run("top-level list without root", func(t *testing.T) {
+		opts := DefaultOptions()
+		opts.Root = false
+		got, err := XMLToMap(DictToXML([]any{int64(1), "two"}, opts), opts)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if want := []any{int64(1), "two"}; !reflect.DeepEqual(got, want) {
+			t.Errorf("expected %#v, got %#v", want, got)
+		}
+	})
+
+	t.Run("repeated names become lists", func(t *testing.T) {
+		opts := DefaultOptions()
+		opts.AttrType = false
+		got, err := XMLToMap([]byte(`<root><c>red</c><c>green</c><c>blue</c><d>x</d></root>`), opts)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		want := map[string]any{"c": []any{"red", "green", "blue"}, "d": "x"}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("expected %#v, got %#v", want, got)
+		}
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		for _, input := range []string{
+			`<root><a>`,
+			`<a></a><b></b>`,
+			`<root><n type="float">abc</n></root>`,
+		} {
+			if _, err := XMLToMap([]byte(input), DefaultOptions()); !errors.Is(err, ErrInvalidData) {
+				t.Errorf("input %q: expected ErrInvalidData, got %v", input, err)
+			}
+		}
+	})
+}
@@ -0,0 +1,307 @@
+package json2xml
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// XSNamespace is the XML Schema namespace used by GenerateXSD.
+const XSNamespace = "http://www.w3.org/2001/XMLSchema"
+
+// xsdNode describes one element of the schema generated by GenerateXSD.
+type xsdNode struct {
+	name string
+	// kind is "simple", "dict", "list", "null" or "any".
+	kind string
+	// simpleType is the xs: type of simple elements.
+	simpleType string
+	// children holds the elements of a dict, or the single item of a list.
+	children []*xsdNode
+	optional bool
+	repeated bool
+}
+
+// xsdSimpleTypes maps GetXMLType names to XML Schema types.
+var xsdSimpleTypes = map[string]string{
+	"str":   "xs:string",
+	"int":   "xs:int",
+	"float": "xs:double",
+	"bool":  "xs:boolean",
+	// Only produced with Options.DetectDates.
+	"date":     "xs:date",
+	"dateTime": "xs:dateTime",
+	// Only produced with Options.DetailedTypes.
+	"int8":    "xs:byte",
+	"int16":   "xs:short",
+	"int32":   "xs:int",
+	"int64":   "xs:long",
+	"uint":    "xs:unsignedLong",
+	"uint8":   "xs:unsignedByte",
+	"uint16":  "xs:unsignedShort",
+	"uint32":  "xs:unsignedInt",
+	"uint64":  "xs:unsignedLong",
+	"uintptr": "xs:unsignedLong",
+	"float32": "xs:float",
+	"float64": "xs:double",
+}
+
+// GenerateXSD returns an XML Schema describing the XML that DictToXML
+// produces for data with opts. Maps become xs:complexType sequences in
+// sorted key order, lists a sequence of unbounded item elements named by
+// ItemFunc, and scalars xs:string, xs:int, xs:double or xs:boolean
+// according to GetXMLType, or xs:integer and xs:decimal for math/big
+// values. The items of a list are merged into one
+// declaration, so keys missing from some objects get minOccurs="0".
+//
+// The schema is derived from this one document and is only as general as
+// the data: nulls are typed as strings unless a sibling value says
+// otherwise, and conflicting shapes fall back to xs:anyType. Options that
+// change the element layout beyond Root, CustomRoot, ItemFunc, AttrType,
+// IDs, ListCountAttr and ItemWrap=false for lists of scalars, as well as
+// the special @attrs, @val and @flat keys, are not reflected. XPathFormat
+// output has a published schema of its own and is rejected with
+// ErrInvalidData, as is a non-object document when Root is false.
+func GenerateXSD(data any, opts Options) ([]byte, error) {
+	if opts.ItemFunc == nil {
+		opts.ItemFunc = DefaultItemFunc
+	}
+	if opts.XPathFormat {
+		return nil, fmt.Errorf("%w: XSD generation does not support XPathFormat", ErrInvalidData)
+	}
+	if err := checkDepth(data, opts); err != nil {
+		return nil, err
+	}
+	if err := checkAllowedKinds(data, opts.AllowedKinds); err != nil {
+		return nil, err
+	}
+
+	var elements []*xsdNode
+	if opts.Root {
+		elements = []*xsdNode{xsdValue(opts.CustomRoot, data, opts)}
+	} else {
+		m, ok := normalizeValue(data).(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("%w: XSD generation without a root element needs an object, got %s", ErrInvalidData, GetXMLType(data))
+		}
+		elements = xsdDict("", m, opts).children
+	}
+
+	var output strings.Builder
+	output.WriteString(defaultXMLDeclaration)
+	fmt.Fprintf(&output, `<xs:schema xmlns:xs="%s" elementFormDefault="qualified">`, XSNamespace)
+	for _, element := range elements {
+		writeXSDElement(&output, element, opts)
+	}
+	output.WriteString(`</xs:schema>`)
+	return []byte(output.String()), nil
+}
+
+// xsdValue describes the element name holding val.
+func xsdValue(name string, val any, opts Options) *xsdNode {
+	if _, ok := handleType(val, opts); ok {
+		return &xsdNode{name: name, kind: "simple", simpleType: "xs:string"}
+	}
+
+	switch v := normalizeValue(val).(type) {
+	case nil:
+		return &xsdNode{name: name, kind: "null"}
+	case *big.Int:
+		// math/big values are unbounded, so they get the unbounded types.
+		return &xsdNode{name: name, kind: "simple", simpleType: "xs:integer"}
+	case *big.Float:
+		return &xsdNode{name: name, kind: "simple", simpleType: "xs:decimal"}
+	case map[string]any:
+		return xsdDict(name, v, opts)
+	case []any:
+		return xsdList(name, v, opts)
+	default:
+		simpleType, ok := xsdSimpleTypes[opts.xmlType(v)]
+		if !ok {
+			simpleType = "xs:string"
+		}
+		return &xsdNode{name: name, kind: "simple", simpleType: simpleType}
+	}
+}
+
+// xsdDict describes a map element with one child per key.
+func xsdDict(name string, m map[string]any, opts Options) *xsdNode {
+	node := &xsdNode{name: name, kind: "dict"}
+	for _, key := range sortedKeys(m) {
+		val := opts.collapse(m[key])
+		if opts.omitted(val) {
+			continue
+		}
+		childName, _ := makeValidXMLName(opts.transformKey(key), make(map[string]any), opts)
+		child := xsdValue(childName, val, opts)
+		if child.kind == "list" && !opts.ItemWrap && xsdPrimitiveItems(child) {
+			// Unwrapped scalars repeat the list's own element.
+			child = child.children[0]
+			child.name = childName
+		}
+		node.children = append(node.children, child)
+	}
+	return node
+}
+
+// xsdList describes a list element whose items are merged into a single
+// repeated item declaration.
+func xsdList(name string, items []any, opts Options) *xsdNode {
+	itemName := strings.TrimSuffix(opts.ItemFunc(name), "@flat")
+	var item *xsdNode
+	for _, v := range items {
+		next := xsdValue(itemName, v, opts)
+		if item == nil {
+			item = next
+		} else {
+			item = mergeXSDNodes(item, next)
+		}
+	}
+
+	node := &xsdNode{name: name, kind: "list"}
+	if item != nil {
+		item.optional = true
+		item.repeated = true
+		node.children = []*xsdNode{item}
+	}
+	return node
+}
+
+// xsdPrimitiveItems reports whether a list node holds scalar items only.
+func xsdPrimitiveItems(list *xsdNode) bool {
+	if len(list.children) == 0 {
+		return false
+	}
+	kind := list.children[0].kind
+	return kind == "simple" || kind == "null"
+}
+
+// mergeXSDNodes combines the declarations of two elements with the same name.
+func mergeXSDNodes(a, b *xsdNode) *xsdNode {
+	switch {
+	case a.kind == "null":
+		return b
+	case b.kind == "null":
+		return a
+	case a.kind != b.kind:
+		return &xsdNode{name: a.name, kind: "any"}
+	}
+
+	switch a.kind {
+	case "simple":
+		if a.simpleType != b.simpleType {
+			switch {
+			case !isXSDNumber(a.simpleType) || !isXSDNumber(b.simpleType):
+				a.simpleType = "xs:string"
+			case isXSDUnbounded(a.simpleType) || isXSDUnbounded(b.simpleType):
+				a.simpleType = "xs:decimal"
+			default:
+				a.simpleType = "xs:double"
+			}
+		}
+	case "dict":
+		a.children = mergeXSDChildren(a.children, b.children)
+	case "list":
+		if len(a.children) == 0 {
+			a.children = b.children
+		} else if len(b.children) > 0 {
+			merged := mergeXSDNodes(a.children[0], b.children[0])
+			merged.optional, merged.repeated = true, true
+			a.children = []*xsdNode{merged}
+		}
+	}
+	return a
+}
+
+// mergeXSDChildren merges two sorted child lists, marking elements that
+// appear in only one of them as optional.
+func mergeXSDChildren(a, b []*xsdNode) []*xsdNode {
+	merged := make([]*xsdNode, 0, len(a)+len(b))
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case j == len(b) || (i < len(a) && a[i].name < b[j].name):
+			a[i].optional = true
+			merged = append(merged, a[i])
+			i++
+		case i == len(a) || b[j].name < a[i].name:
+			b[j].optional = true
+			merged = append(merged, b[j])
+			j++
+		default:
+			optional := a[i].optional || b[j].optional
+			repeated := a[i].repeated || b[j].repeated
+			node := mergeXSDNodes(a[i], b[j])
+			node.optional, node.repeated = optional, repeated
+			merged = append(merged, node)
+			i++
+			j++
+		}
+	}
+	return merged
+}
+
+func isXSDNumber(simpleType string) bool {
+	switch simpleType {
+	case "xs:byte", "xs:short", "xs:int", "xs:long", "xs:float", "xs:double",
+		"xs:unsignedByte", "xs:unsignedShort", "xs:unsignedInt", "xs:unsignedLong",
+		"xs:integer", "xs:decimal":
+		return true
+	}
+	return false
+}
+
+// isXSDUnbounded reports whether simpleType is one of the arbitrary
+// precision types used for math/big values, which xs:double cannot hold.
+func isXSDUnbounded(simpleType string) bool {
+	return simpleType == "xs:integer" || simpleType == "xs:decimal"
+}
+
+// writeXSDElement writes the xs:element declaration for node.
+func writeXSDElement(w *strings.Builder, node *xsdNode, opts Options) {
+	fmt.Fprintf(w, `<xs:element name="%s"`, EscapeXML(node.name))
+	if node.optional {
+		w.WriteString(` minOccurs="0"`)
+	}
+	if node.repeated {
+		w.WriteString(` maxOccurs="unbounded"`)
+	}
+
+	var attrs strings.Builder
+	if opts.AttrType {
+		attrs.WriteString(`<xs:attribute name="type" type="xs:string"/>`)
+	}
+	if opts.IDs {
+		attrs.WriteString(`<xs:attribute name="id" type="xs:string"/>`)
+	}
+
+	simpleType := node.simpleType
+	switch node.kind {
+	case "any":
+		w.WriteString(` type="xs:anyType"/>`)
+		return
+	case "null":
+		simpleType = "xs:string"
+	case "dict", "list":
+		w.WriteString(`><xs:complexType>`)
+		if len(node.children) > 0 {
+			w.WriteString(`<xs:sequence>`)
+			for _, child := range node.children {
+				writeXSDElement(w, child, opts)
+			}
+			w.WriteString(`</xs:sequence>`)
+		}
+		w.WriteString(attrs.String())
+		if node.kind == "list" && opts.ListCountAttr {
+			w.WriteString(`<xs:attribute name="count" type="xs:nonNegativeInteger"/>`)
+		}
+		w.WriteString(`</xs:complexType></xs:element>`)
+		return
+	}
+
+	if attrs.Len() == 0 {
+		fmt.Fprintf(w, ` type="%s"/>`, simpleType)
+		return
+	}
+	fmt.Fprintf(w, `><xs:complexType><xs:simpleContent><xs:extension base="%s">%s</xs:extension></xs:simpleContent></xs:complexType></xs:element>`, simpleType, attrs.String())
+}
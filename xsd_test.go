@@ -0,0 +1,182 @@
+package json2xml
+
+import (
+	"errors"
+	"math/big"
+	"strings"
+	"testing"
+)
+
+func TestGenerateXSD(t *testing.T) {
+	data := map[string]any{
+		"name":   "Bike",
+		"gears":  21,
+		"weight": 9.5,
+		"owner": map[string]any{
+			"first":  "Ada",
+			"active": true,
+		},
+		"parts": []any{
+			map[string]any{"id": 1, "label": "wheel"},
+			map[string]any{"id": 2, "spare": true},
+		},
+	}
+
+	t.Run("nested objects and arrays of objects", func(t *testing.T) {
+		opts := DefaultOptions()
+		opts.AttrType = false
+		xsd, err := GenerateXSD(data, opts)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if err := checkWellFormed(xsd); err != nil {
+			t.Fatalf("schema is not well-formed: %v\n%s", err, xsd)
+		}
+
+		result := string(xsd)
+		expected := []string{
+			`<xs:schema xmlns:xs="http://www.w3.org/2001/XMLSchema" elementFormDefault="qualified">`,
+			`<xs:element name="root"><xs:complexType><xs:sequence><xs:element name="gears" type="xs:int"/>`,
+			`<xs:element name="name" type="xs:string"/>`,
+			`<xs:element name="owner"><xs:complexType><xs:sequence><xs:element name="active" type="xs:boolean"/><xs:element name="first" type="xs:string"/></xs:sequence></xs:complexType></xs:element>`,
+			`<xs:element name="parts"><xs:complexType><xs:sequence><xs:element name="item" minOccurs="0" maxOccurs="unbounded"><xs:complexType><xs:sequence>` +
+				`<xs:element name="id" type="xs:int"/>` +
+				`<xs:element name="label" minOccurs="0" type="xs:string"/>` +
+				`<xs:element name="spare" minOccurs="0" type="xs:boolean"/>` +
+				`</xs:sequence></xs:complexType></xs:element></xs:sequence></xs:complexType></xs:element>`,
+			`<xs:element name="weight" type="xs:double"/>`,
+		}
+		for _, want := range expected {
+			if !strings.Contains(result, want) {
+				t.Errorf("expected schema to contain %s, got %s", want, result)
+			}
+		}
+	})
+
+	t.Run("type attributes", func(t *testing.T) {
+		xsd, err := GenerateXSD(map[string]any{"n": 1, "m": map[string]any{}}, DefaultOptions())
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		result := string(xsd)
+		if !strings.Contains(result, `<xs:element name="n"><xs:complexType><xs:simpleContent><xs:extension base="xs:int"><xs:attribute name="type" type="xs:string"/></xs:extension></xs:simpleContent></xs:complexType></xs:element>`) {
+			t.Errorf("expected scalar with type attribute, got %s", result)
+		}
+		if !strings.Contains(result, `<xs:element name="m"><xs:complexType><xs:attribute name="type" type="xs:string"/></xs:complexType></xs:element>`) {
+			t.Errorf("expected empty map with type attribute, got %s", result)
+		}
+	})
+
+	t.Run("custom root and item func", func(t *testing.T) {
+		opts := DefaultOptions()
+		opts.AttrType = false
+		opts.CustomRoot = "catalog"
+		opts.ItemFunc = func(parent string) string { return parent + "_entry" }
+		xsd, err := GenerateXSD([]any{"a", "b"}, opts)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		want := `<xs:element name="catalog"><xs:complexType><xs:sequence><xs:element name="catalog_entry" minOccurs="0" maxOccurs="unbounded" type="xs:string"/></xs:sequence></xs:complexType></xs:element>`
+		if !strings.Contains(string(xsd), want) {
+			t.Errorf("expected %s, got %s", want, xsd)
+		}
+	})
+
+	t.Run("top-level scalar", func(t *testing.T) {
+		opts := DefaultOptions()
+		opts.AttrType = false
+		xsd, err := GenerateXSD(42, opts)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if !strings.Contains(string(xsd), `<xs:element name="root" type="xs:int"/>`) {
+			t.Errorf("expected a simple root element, got %s", xsd)
+		}
+	})
+
+	t.Run("unwrapped scalar lists repeat the key", func(t *testing.T) {
+		opts := DefaultOptions()
+		opts.AttrType = false
+		opts.ItemWrap = false
+		xsd, err := GenerateXSD(map[string]any{"tag": []any{"a", "b"}}, opts)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		want := `<xs:element name="tag" minOccurs="0" maxOccurs="unbounded" type="xs:string"/>`
+		if !strings.Contains(string(xsd), want) {
+			t.Errorf("expected %s, got %s", want, xsd)
+		}
+	})
+
+	t.Run("mixed item types", func(t *testing.T) {
+		opts := DefaultOptions()
+		opts.AttrType = false
+		xsd, err := GenerateXSD(map[string]any{
+			"nums":  []any{1, 2.5, nil},
+			"mixed": []any{1, "x"},
+			"shape": []any{map[string]any{}, []any{}},
+		}, opts)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		result := string(xsd)
+		for _, want := range []string{
+			`<xs:element name="item" minOccurs="0" maxOccurs="unbounded" type="xs:double"/>`,
+			`<xs:element name="item" minOccurs="0" maxOccurs="unbounded" type="xs:string"/>`,
+			`<xs:element name="item" minOccurs="0" maxOccurs="unbounded" type="xs:anyType"/>`,
+		} {
+			if !strings.Contains(result, want) {
+				t.Errorf("expected schema to contain %s, got %s", want, result)
+			}
+		}
+	})
+
+	t.Run("big numbers", func(t *testing.T) {
+		huge, _ := new(big.Int).SetString("123456789012345678901234567890", 10)
+		opts := DefaultOptions()
+		opts.AttrType = false
+		xsd, err := GenerateXSD(map[string]any{
+			"count": huge,
+			"price": big.NewFloat(1.5),
+			"mixed": []any{1, huge},
+		}, opts)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		result := string(xsd)
+		for _, want := range []string{
+			`<xs:element name="count" type="xs:integer"/>`,
+			`<xs:element name="price" type="xs:decimal"/>`,
+			`<xs:element name="item" minOccurs="0" maxOccurs="unbounded" type="xs:decimal"/>`,
+		} {
+			if !strings.Contains(result, want) {
+				t.Errorf("expected schema to contain %s, got %s", want, result)
+			}
+		}
+	})
+
+	t.Run("without root", func(t *testing.T) {
+		opts := DefaultOptions()
+		opts.Root = false
+		opts.AttrType = false
+		xsd, err := GenerateXSD(map[string]any{"a": "x"}, opts)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if !strings.Contains(string(xsd), `<xs:schema xmlns:xs="http://www.w3.org/2001/XMLSchema" elementFormDefault="qualified"><xs:element name="a" type="xs:string"/></xs:schema>`) {
+			t.Errorf("expected a global element per key, got %s", xsd)
+		}
+
+		if _, err := GenerateXSD([]any{1}, opts); !errors.Is(err, ErrInvalidData) {
+			t.Errorf("expected ErrInvalidData for a list without root, got %v", err)
+		}
+	})
+
+	t.Run("XPath format is rejected", func(t *testing.T) {
+		opts := DefaultOptions()
+		opts.XPathFormat = true
+		if _, err := GenerateXSD(data, opts); !errors.Is(err, ErrInvalidData) {
+			t.Errorf("expected ErrInvalidData, got %v", err)
+		}
+	})
+}
@@ -0,0 +1,46 @@
+package json2xml
+
+import (
+	"bytes"
+	"fmt"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ReadFromYAML parses the first YAML document in data and returns it in
+// the shape ReadFromString produces, so it converts like JSON input:
+// mappings become map[string]any, with non-string keys formatted by
+// fmt.Sprint, and sequences become []any. Integers decode as int and
+// floats as float64.
+func ReadFromYAML(data []byte) (any, error) {
+	var result any
+	if err := yaml.NewDecoder(bytes.NewReader(data)).Decode(&result); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrYAMLRead, err)
+	}
+
+	return normalizeYAML(result), nil
+}
+
+// normalizeYAML converts the map[any]any mappings the YAML decoder returns
+// for non-string keys into map[string]any, recursively.
+func normalizeYAML(val any) any {
+	switch v := val.(type) {
+	case map[string]any:
+		for key, item := range v {
+			v[key] = normalizeYAML(item)
+		}
+		return v
+	case map[any]any:
+		m := make(map[string]any, len(v))
+		for key, item := range v {
+			m[fmt.Sprint(key)] = normalizeYAML(item)
+		}
+		return m
+	case []any:
+		for i, item := range v {
+			v[i] = normalizeYAML(item)
+		}
+		return v
+	}
+	return val
+}
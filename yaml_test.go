@@ -0,0 +1,83 @@
+package json2xml
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReadFromYAML(t *testing.T) {
+	input := []byte(`
+name: Bike
+price: 9.99
+stock: 3
+active: true
+tags: [red, blue]
+dimensions:
+  width: 40
+  parts:
+    - name: wheel
+      count: 2
+    - name: seat
+      count: 1
+codes:
+  1: one
+  true: yes
+nothing: null
+`)
+	data, err := ReadFromYAML(input)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	expected := map[string]any{
+		"name":   "Bike",
+		"price":  9.99,
+		"stock":  3,
+		"active": true,
+		"tags":   []any{"red", "blue"},
+		"dimensions": map[string]any{
+			"width": 40,
+			"parts": []any{
+				map[string]any{"name": "wheel", "count": 2},
+				map[string]any{"name": "seat", "count": 1},
+			},
+		},
+		"codes":   map[string]any{"1": "one", "true": "yes"},
+		"nothing": nil,
+	}
+	if !reflect.DeepEqual(data, expected) {
+		t.Fatalf("expected %#v, got %#v", expected, data)
+	}
+
+	xml := string(DictToXML(data, Options{Root: false, AttrType: true, ItemWrap: true, ItemFunc: DefaultItemFunc}))
+	for _, want := range []string{
+		`<stock type="int">3</stock>`,
+		`<parts type="list"><item type="dict"><count type="int">2</count><name type="str">wheel</name></item>`,
+		`<codes type="dict"><n1 type="str">one</n1><true type="str">yes</true></codes>`,
+	} {
+		if !strings.Contains(xml, want) {
+			t.Errorf("expected %s in %s", want, xml)
+		}
+	}
+
+	t.Run("nested sequences", func(t *testing.T) {
+		data, err := ReadFromYAML([]byte("- [1, 2]\n- {3: three}\n"))
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		expected := []any{[]any{1, 2}, map[string]any{"3": "three"}}
+		if !reflect.DeepEqual(data, expected) {
+			t.Errorf("expected %#v, got %#v", expected, data)
+		}
+	})
+
+	t.Run("invalid YAML", func(t *testing.T) {
+		for _, input := range []string{"", "key: [unclosed", "a: b: c"} {
+			if _, err := ReadFromYAML([]byte(input)); !errors.Is(err, ErrYAMLRead) {
+				t.Errorf("%q: expected ErrYAMLRead, got %v", input, err)
+			}
+		}
+	})
+}